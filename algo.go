@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -10,768 +11,2073 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
 	"hash"
 	"log"
-	"math"
+	mathrand "math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
 func main() {
 
-	for {
+	var err error
+
+	var daemon bool
+	var interval time.Duration
+	var jitter time.Duration
+
+	var ecbclient EcbClient = EcbClient{}
+
+	flag.BoolVar(&daemon, `daemon`, false, `run continuously, one arbitrage cycle per interval`)
+	flag.DurationVar(&interval, `interval`, time.Minute, `delay between arbitrage cycles in daemon mode`)
+	flag.DurationVar(&jitter, `jitter`, 0, `maximum random delay added to each interval`)
+	flag.StringVar(&ecbclient.Url, `ecb`, EcbDailyUrl, `ECB reference rate URL or local XML file`)
+	flag.StringVar(&ecbclient.CachePath, `ecbcache`, `eurofxref-daily.xml`, `ECB reference rate cache file, empty to disable`)
+	flag.DurationVar(&ecbclient.MaxAge, `ecbmaxage`, time.Hour, `maximum age of cached ECB reference rates`)
+
+	var paperengine PaperEngine = PaperEngine{}
+
+	var recorder Recorder = Recorder{}
+
+	flag.StringVar(&recorder.Dir, `record`, ``, `directory for recorded order books and rates, empty to disable`)
+	flag.Int64Var(&recorder.MaxSize, `recordsize`, 64<<20, `rotate recordings after this many bytes`)
+	flag.DurationVar(&recorder.MaxAge, `recordage`, 24*time.Hour, `rotate recordings after this long`)
+
+	flag.StringVar(&paperengine.Path, `paperlog`, `paper.jsonl`, `append-only log of simulated paper trading fills`)
 
-		var err error
+	var ledger Ledger = Ledger{}
 
-		const bitstamphost string = `www.bitstamp.net`
+	flag.StringVar(&ledger.Dir, `ledger`, `ledger`, `directory for the daily arbitrage ledger, empty to disable`)
 
-		const valrhost string = `api.valr.com`
+	var metricsaddress string
 
-		var exchangerates [][]string
+	flag.StringVar(&metricsaddress, `metrics`, ``, `address to serve Prometheus /metrics on, e.g. :9090, empty to disable`)
 
-		if exchangerates, err = ReadCsv(`eurofxref-daily.csv`); err != nil {
+	var cycletimeout time.Duration
 
-			log.Panic(err)
+	flag.DurationVar(&cycletimeout, `cycletimeout`, 5*time.Minute, `cancel exchange requests still running this long after a cycle started, 0 to disable`)
+
+	flag.Parse()
+
+	if flag.NArg() >= 1 && flag.Arg(0) == `convert` {
+
+		if err = RunConvert(flag.Args()[1:]); errors.Is(err, flag.ErrHelp) {
 
 			return
 		}
 
-		var dollareuroexchangerate float64
-		var randeuroexchangerate float64
+		if errors.Is(err, ErrUsage) {
 
-		if dollareuroexchangerate, err = strconv.ParseFloat(exchangerates[0][0], 64); err != nil {
+			os.Exit(2)
+		}
 
-			log.Panic(err)
+		if err != nil {
 
-			return
+			log.Fatal(err)
 		}
 
-		if randeuroexchangerate, err = strconv.ParseFloat(exchangerates[0][1], 64); err != nil {
+		return
+	}
+
+	if flag.NArg() >= 1 && flag.Arg(0) == `backtest` {
 
-			log.Panic(err)
+		if err = RunBacktest(flag.Args()[1:]); errors.Is(err, flag.ErrHelp) {
 
 			return
 		}
 
-		var exchangerate float64 = randeuroexchangerate / dollareuroexchangerate
+		if errors.Is(err, ErrUsage) {
 
-		log.Printf(`dollareuroexchangerate: %+[1]v`, dollareuroexchangerate)
-		log.Printf(`randeuroexchangerate: %+[1]v`, randeuroexchangerate)
-		log.Printf(`exchangerate: %+[1]v`, exchangerate)
+			os.Exit(2)
+		}
+
+		if err != nil {
+
+			log.Fatal(err)
+		}
 
-		var accounts [][]string
+		return
+	}
 
-		if accounts, err = ReadCsv(os.Args[1]); err != nil {
+	if flag.NArg() >= 1 && flag.Arg(0) == `report` {
 
-			log.Panic(err)
+		if err = RunReport(flag.Args()[1:]); errors.Is(err, flag.ErrHelp) {
 
 			return
 		}
 
-		var index int = 0
+		if errors.Is(err, ErrUsage) {
+
+			os.Exit(2)
+		}
 
-		for index = range accounts {
+		if err != nil {
 
-			var account []string = accounts[index]
+			log.Fatal(err)
+		}
 
-			var bitstampkey string = account[0]
-			var bitstampsecret string = account[1]
-			var bitstampcustomer string = account[2]
+		return
+	}
 
-			var valrkey string = account[3]
-			var valrsecret string = account[4]
+	if flag.NArg() != 1 {
 
-			var dollarlimit float64
-			var profitmargin float64
-			var executetrade bool
+		log.Fatal(`usage: algo [-daemon] [-interval duration] [-jitter duration] [-cycletimeout duration] [-ecb url] [-paperlog file] [-record dir] [-ledger dir] [-metrics address] config.json | algo convert [-reverse] accounts.csv | algo backtest config.json recording... | algo report [-format json|csv]`)
+	}
 
-			if dollarlimit, err = strconv.ParseFloat(account[5], 64); err != nil {
+	var configfile WatchedFile = WatchedFile{Name: flag.Arg(0)}
 
-				log.Panic(err)
+	var feecache FeeCache = FeeCache{MaxAge: time.Hour}
 
-				return
-			}
+	var streamregistry StreamRegistry = StreamRegistry{Recorder: &recorder}
 
-			if profitmargin, err = strconv.ParseFloat(account[6], 64); err != nil {
+	defer recorder.Close()
 
-				log.Panic(err)
+	if err = paperengine.Load(); err != nil {
 
-				return
-			}
+		log.Fatal(err)
+	}
 
-			if executetrade, err = strconv.ParseBool(account[7]); err != nil {
+	if metricsaddress != `` {
 
-				log.Panic(err)
+		go ServeMetrics(metricsaddress, DefaultMetrics)
+	}
 
-				return
-			}
+	var config Config
 
-			var bitstampdollarbalance float64 = GetBitstampDollarBalance(bitstampkey, bitstampsecret, bitstampcustomer, bitstamphost)
-			var valrbitcoinbalance float64 = GetValrBitcoinBalance(valrkey, valrsecret, valrhost)
+	var signals chan os.Signal = make(chan os.Signal, 2)
 
-			log.Printf(`bitstampdollarbalance: %+[1]v`, bitstampdollarbalance)
-			log.Printf(`valrbitcoinbalance: %+[1]v`, valrbitcoinbalance)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-			var bitstampdollarlimit = RoundFloat(dollarlimit, 2)
+	var stopping chan struct{} = make(chan struct{})
 
-			var bitstampbuyable Depth = GetBitstampBuyableLiquidity(bitstampkey, bitstampsecret, bitstampcustomer, bitstamphost)
-			var bitstamptradeable Trade = CalculateTrade(bitstampbuyable, bitstampdollarlimit)
+	var requestcontext context.Context
+	var cancelrequests context.CancelFunc
 
-			log.Printf(`bitstamptradeable: %+[1]v`, bitstamptradeable)
+	requestcontext, cancelrequests = context.WithCancel(context.Background())
 
-			var valrrandnotional float64 = bitstamptradeable.NotionalAmount * exchangerate
-			valrrandnotional = RoundFloat(valrrandnotional, 2)
+	defer cancelrequests()
 
-			var valrsellable Depth = GetValrSellableLiquidity(valrkey, valrsecret, valrhost)
+	go func() {
 
-			var valrtradeable Trade = CalculateTrade(valrsellable, valrrandnotional)
+		var received os.Signal = <-signals
 
-			log.Printf(`valrtradeable: %+[1]v`, valrtradeable)
+		log.Printf(`signal: %+[1]v, stopping after the current route`, received)
 
-			if bitstamptradeable.NotionalAmount == bitstampdollarlimit && valrtradeable.NotionalAmount == valrrandnotional && bitstampdollarlimit <= bitstampdollarbalance && valrtradeable.BaseAmount <= valrbitcoinbalance {
+		close(stopping)
 
-				var bitcoinprofitpercent float64 = CalculateProfit(bitstamptradeable.BaseAmount, valrtradeable.BaseAmount)
+		received = <-signals
 
-				log.Printf(`bitcoinprofitpercent: %+[1]v`, bitcoinprofitpercent)
+		log.Printf(`signal: %+[1]v, cancelling exchange requests, live orders still settle`, received)
 
-				if bitcoinprofitpercent >= profitmargin {
+		cancelrequests()
+	}()
 
-					var bitstamplimitprice float64
-					bitstamplimitprice = valrtradeable.QuoteAmount / exchangerate / (1.0 + profitmargin)
-					bitstamplimitprice = RoundFloat(bitstamplimitprice, 0)
+	var cycle int = 0
 
-					var valrlimitprice float64
-					valrlimitprice = bitstamptradeable.QuoteAmount * exchangerate * (1.0 + profitmargin)
-					valrlimitprice = RoundFloat(valrlimitprice, 0)
+	for cycle = 1; ; cycle++ {
 
-					log.Printf(`bitstamplimitprice: %+[1]v`, bitstamplimitprice)
-					log.Printf(`valrlimitprice: %+[1]v`, valrlimitprice)
+		var changed bool
+
+		if changed, err = configfile.Refresh(); err != nil {
+
+			if cycle == 1 {
+
+				log.Fatal(err)
+			}
 
-					var bitstamptrade Trade = Trade{BaseAmount: bitstamptradeable.BaseAmount, QuoteAmount: bitstamplimitprice, NotionalAmount: bitstamptradeable.NotionalAmount}
-					var valrtrade Trade = Trade{BaseAmount: valrtradeable.BaseAmount, QuoteAmount: valrlimitprice, NotionalAmount: valrtradeable.NotionalAmount}
+			log.Printf(`Error('%+[1]v, keeping loaded config')`, err)
 
-					bitstamptrade.QuoteAmount = bitstamplimitprice
-					valrtrade.QuoteAmount = valrlimitprice
+			changed = false
+		}
 
-					log.Printf(`bitstamptrade: %+[1]v`, bitstamptrade)
-					log.Printf(`valrtrade: %+[1]v`, valrtrade)
+		if changed {
 
-					if executetrade {
+			var loaded Config
 
-						var bitstamporder BitstampOrder
+			if loaded, err = LoadConfig(configfile.Name, configfile.Content); err != nil {
 
-						if bitstamporder, err = PostBitstampBuyLimitOrder(
-							bitstampkey,
-							bitstampsecret,
-							bitstampcustomer,
-							bitstamphost,
-							`btcusd`,
-							bitstamptrade.BaseAmount,
-							bitstamptrade.QuoteAmount,
-							false,
-							true,
-							false,
-						); err != nil {
+				if cycle == 1 {
 
-							log.Panic(err)
+					log.Fatal(err)
+				}
 
-							return
-						}
+				log.Printf(`Error('%+[1]v')`, err.Error())
 
-						log.Printf(`bitstamporder: %+[1]v`, bitstamporder)
+			} else if err = ConfigureApiClients(loaded); err != nil {
 
-						var valrorderid ValrOrderId
+				if cycle == 1 {
 
-						if valrorderid, err = PostValrLimitOrder(
-							valrkey,
-							valrsecret,
-							valrhost,
-							ValrLimitOrder{
-								Side:            `SELL`,
-								Quantity:        strconv.FormatFloat(valrtrade.BaseAmount, 'f', 8, 64),
-								Price:           strconv.FormatFloat(valrtrade.QuoteAmount, 'f', 2, 64),
-								Pair:            `BTCZAR`,
-								PostOnly:        `False`,
-								CustomerOrderId: `1234567890`,
-								TimeInForce:     `IOC`,
-							},
-						); err != nil {
+					log.Fatal(err)
+				}
 
-							log.Panic(err)
+				log.Printf(`Error('%+[1]v')`, err.Error())
 
-							return
-						}
+			} else {
 
-						log.Printf(`valrorderid: %+[1]v`, valrorderid)
+				config = loaded
+			}
+		}
 
-						var bitstamporderstatus BitstampOrderStatus
+		var ecbrates EcbRates
 
-						if bitstamporderstatus, err = PostBitstampOrderStatus(
-							bitstampkey,
-							bitstampsecret,
-							bitstampcustomer,
-							bitstamphost,
-							bitstamporder.Id,
-						); err != nil {
+		var summary CycleSummary
 
-							log.Panic(err)
+		if ecbrates, err = ecbclient.GetLatestRates(); err != nil {
 
-							return
-						}
+			if !daemon {
 
-						log.Printf(`bitstamporderstatus: %+[1]v`, bitstamporderstatus)
+				log.Fatal(err)
+			}
 
-						var valrorderstatus ValrOrderStatus
+			log.Printf(`Error('%+[1]v, skipping cycle')`, err)
 
-						if valrorderstatus, err = GetValrOrderStatus(
-							valrkey,
-							valrsecret,
-							valrhost,
-							`btczar`,
-							valrorderid.Id,
-						); err != nil {
+		} else {
 
-							log.Panic(err)
+			var cyclecontext context.Context = requestcontext
+			var cancelcycle context.CancelFunc = func() {}
 
-							return
-						}
+			if cycletimeout > 0 {
 
-						log.Printf(`valrorderstatus: %+[1]v`, valrorderstatus)
-					}
-				}
+				cyclecontext, cancelcycle = context.WithTimeout(requestcontext, cycletimeout)
+			}
+
+			summary, err = RunCycle(cyclecontext, stopping, config, ecbrates, &feecache, &streamregistry, &paperengine, &recorder, &ledger)
+
+			cancelcycle()
+
+			if errors.Is(err, ErrStopping) {
+
+				log.Printf(`stopped: %+[1]v`, err)
+
+				return
+			}
+
+			if errors.Is(err, context.DeadlineExceeded) {
+
+				log.Printf(`Error('cycle timeout: %+[1]v')`, err)
+
+				err = nil
+			}
+
+			if err != nil {
+
+				recorder.Close()
+
+				log.Fatal(err)
 			}
 		}
 
-		// time.Sleep(time.Second)
+		summary.Cycle = cycle
 
-		os.Exit(0)
-	}
-}
+		if !ecbrates.Date.IsZero() {
 
-func RoundFloat(value float64, precision uint) float64 {
-	ratio := math.Pow(10, float64(precision))
-	return math.Round(value*ratio) / ratio
-}
+			MetricFxRateAge.Set(time.Since(ecbrates.Date).Seconds())
+		}
 
-func ReadCsv(filename string) (csvlines [][]string, err error) {
+		MetricLastCycle.Set(float64(time.Now().Unix()))
+		MetricCycleDuration.Set(summary.Elapsed.Seconds())
 
-	csvlines = [][]string{}
+		log.Printf(`summary: %+[1]v`, summary)
 
-	var file *os.File
+		if !daemon {
 
-	if file, err = os.Open(filename); err != nil {
+			return
+		}
 
-		log.Panic(err)
+		var delay time.Duration = interval
 
-		return
-	}
+		if jitter > 0 {
 
-	defer file.Close()
+			delay += time.Duration(mathrand.Int63n(int64(jitter) + 1))
+		}
 
-	if csvlines, err = csv.NewReader(file).ReadAll(); err != nil {
+		select {
 
-		log.Panic(err)
+		case <-time.After(delay):
 
-		return
-	}
+		case <-stopping:
 
-	return
+			return
+		}
+	}
 }
 
-func CalculateProfit(buybitcoinvalue float64, sellbitcoinvalue float64) (bitcoinprofitpercent float64) {
+func RunCycle(ctx context.Context, stopping <-chan struct{}, config Config, ecbrates EcbRates, feecache *FeeCache, streamregistry *StreamRegistry, paperengine *PaperEngine, recorder *Recorder, ledger *Ledger) (summary CycleSummary, err error) {
 
-	bitcoinprofitpercent = 0.0
-	bitcoinprofitpercent += buybitcoinvalue
-	bitcoinprofitpercent -= sellbitcoinvalue
-	bitcoinprofitpercent /= buybitcoinvalue
+	var started time.Time = time.Now()
 
-	return
-}
+	defer func() {
 
-func CalculateTrade(depth Depth, notional float64) (trade Trade) {
+		summary.Elapsed = time.Since(started)
+	}()
 
-	trade = Trade{}
+	var accountindex int = 0
+	var accountlength int = len(config.Accounts)
 
-	var level int = 0
-	var levels int = len(depth.Levels)
+	for accountindex = 0; accountindex < accountlength; accountindex++ {
 
-	var depthlevel Level
-	var lastlevel Level
+		var account AccountConfig = config.Accounts[accountindex]
 
-	for level = 0; level < levels; level += 1 {
+		var strategy StrategyConfig = config.AccountStrategy(account)
 
-		if level == 0 {
+		log.Printf(`account: %+[1]v`, account.Name)
 
-			lastlevel = Level{}
+		summary.Accounts += 1
 
-		} else {
+		var routeindex int = 0
+		var routelength int = len(account.Routes)
 
-			lastlevel = depthlevel
-		}
+		for routeindex = 0; routeindex < routelength; routeindex++ {
 
-		depthlevel = depth.Levels[level]
+			if err = CycleStopped(ctx, stopping); err != nil {
 
-		if depthlevel.NotionalAmount == 0.0 {
+				return
+			}
 
-			depthlevel.NotionalAmount = 0.0
+			var route RouteConfig = account.Routes[routeindex]
 
-			depthlevel.NotionalAmount += depthlevel.BaseAmount
-			depthlevel.NotionalAmount *= depthlevel.QuoteAmount
-			depthlevel.NotionalAmount = RoundFloat(depthlevel.NotionalAmount, 2)
+			var arbitrageresponse ArbitrageResponse
+			var routeerr error
 
-			depthlevel.BaseTotal = 0.0
+			arbitrageresponse, routeerr = RunRoute(ctx, config, account, strategy, route, ecbrates, feecache, streamregistry, paperengine, recorder, ledger)
 
-			depthlevel.BaseTotal += lastlevel.BaseTotal
-			depthlevel.BaseTotal += depthlevel.BaseAmount
+			if routeerr == nil || arbitrageresponse.Executed {
 
-			depthlevel.NotionalTotal = 0.0
+				summary.Add(arbitrageresponse)
+			}
 
-			depthlevel.NotionalTotal += lastlevel.NotionalTotal
-			depthlevel.NotionalTotal += depthlevel.NotionalAmount
+			if routeerr == nil {
 
-			depthlevel.BaseAhead = 0.0
-			depthlevel.BaseAhead += lastlevel.BaseTotal
+				continue
+			}
 
-			depthlevel.NotionalAhead = 0.0
-			depthlevel.NotionalAhead += lastlevel.NotionalTotal
-		}
+			var action string = ErrorAction(routeerr)
 
-		var notionallimitexceeded bool = notional > 0.0 && depthlevel.NotionalTotal > notional
+			summary.Errors += 1
 
-		if notionallimitexceeded {
+			MetricErrors.Add(1, account.Name, ErrorKind(routeerr), action)
 
-			break
-		}
-	}
+			log.Printf(`Error('%[1]v %[2]v->%[3]v: %[4]v, %[5]v')`, account.Name, route.Buy, route.Sell, routeerr, action)
 
-	if level > -1 && level < levels {
+			if action == ActionHalt {
 
-		trade.BaseAmount = depthlevel.BaseTotal
-		trade.QuoteAmount = depthlevel.QuoteAmount
-		trade.NotionalAmount = depthlevel.NotionalTotal
+				SendAlert(strategy.HedgeConfig().Webhook, strings.Join([]string{`halting: account`, account.Name, routeerr.Error()}, ` `))
 
-		var notionallimitexceeded bool = notional > 0.0 && depthlevel.NotionalTotal > notional
+				err = routeerr
 
-		if notionallimitexceeded {
+				return
+			}
 
-			var notionallimitpercent float64 = 0.0
+			if action == ActionSkipAccount {
+
+				break
+			}
+		}
 
-			notionallimitpercent = 0.0
-			notionallimitpercent -= depthlevel.NotionalTotal
-			notionallimitpercent += notional
-			notionallimitpercent += depthlevel.NotionalAmount
-			notionallimitpercent /= depthlevel.NotionalAmount
+		if err = CycleStopped(ctx, stopping); err != nil {
 
-			trade.BaseAmount = 0.0
-			trade.BaseAmount += depthlevel.BaseAmount
-			trade.BaseAmount *= notionallimitpercent
-			trade.BaseAmount += depthlevel.BaseAhead
-			trade.BaseAmount = RoundFloat(trade.BaseAmount, 8)
+			return
+		}
 
-			trade.NotionalAmount = notional
+		if strategy.Paper {
+
+			log.Printf(`paperpnl: %[1]v %+[2]v`, account.Name, paperengine.Pnl(account.Name))
 		}
 	}
 
 	return
 }
 
-func GetBitstampDollarBalance(bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string) (bitstampdollarbalance float64) {
+func CycleStopped(ctx context.Context, stopping <-chan struct{}) (err error) {
 
-	bitstampdollarbalance = 0.0
+	select {
 
-	var err error
+	case <-stopping:
 
-	var bitstampbalance BitstampBalance
+		return ErrStopping
 
-	if bitstampbalance, err = PostBitstampAccountBalance(bitstampkey, bitstampsecret, bitstampcustomer, bitstamphost, `usd`); err != nil {
+	default:
+	}
 
-		log.Panic(err)
+	if ctx == nil {
 
 		return
 	}
 
-	if bitstampdollarbalance, err = strconv.ParseFloat(bitstampbalance.Available, 64); err != nil {
+	if errors.Is(ctx.Err(), context.Canceled) {
 
-		log.Panic(err)
+		err = fmt.Errorf(`%[1]w: %[2]w`, ErrStopping, ctx.Err())
 
 		return
 	}
 
-	bitstampdollarbalance = RoundFloat(bitstampdollarbalance, 2)
+	err = ctx.Err()
 
 	return
 }
 
-func GetValrBitcoinBalance(valrkey string, valrsecret string, valrhost string) (valrbitcoinbalance float64) {
+func RunRoute(ctx context.Context, config Config, account AccountConfig, strategy StrategyConfig, route RouteConfig, ecbrates EcbRates, feecache *FeeCache, streamregistry *StreamRegistry, paperengine *PaperEngine, recorder *Recorder, ledger *Ledger) (arbitrageresponse ArbitrageResponse, err error) {
+
+	var arbitragerequest ArbitrageRequest = ArbitrageRequest{
+		Account:      account.Name,
+		ProfitMargin: strategy.ProfitMargin,
+		ScaleDown:    strategy.ScaleDown,
+		ExecuteTrade: strategy.ExecuteTrade || strategy.Paper,
+		Paper:        strategy.Paper,
+		HedgeConfig:  strategy.HedgeConfig(),
+	}
 
-	valrbitcoinbalance = 0.0
+	if arbitragerequest.BuyExchange, err = NewExchange(config.Venues[route.Buy], account.Credentials[route.Buy], route.BuyPair, streamregistry); err != nil {
 
-	var err error
+		return
+	}
 
-	var valrbalancelist []ValrBalance
+	if arbitragerequest.SellExchange, err = NewExchange(config.Venues[route.Sell], account.Credentials[route.Sell], route.SellPair, streamregistry); err != nil {
 
-	if valrbalancelist, err = GetValrBalanceList(valrkey, valrsecret, valrhost); err != nil {
+		return
+	}
 
-		log.Panic(err)
+	if err = PrepareArbitrage(route, ecbrates, &arbitragerequest); err != nil {
 
 		return
 	}
 
-	var valrbalanceindex int = 0
-	var valrbalancelength int = len(valrbalancelist)
+	recorder.RecordRate(route.LimitCurrency, arbitragerequest.BuyExchange.Pair().QuoteCurrency, arbitragerequest.LimitRate)
+	recorder.RecordRate(arbitragerequest.BuyExchange.Pair().QuoteCurrency, arbitragerequest.SellExchange.Pair().QuoteCurrency, arbitragerequest.ExchangeRate)
 
-	for valrbalanceindex = 0; valrbalanceindex < valrbalancelength; valrbalanceindex++ {
+	if arbitragerequest.BuyFee, err = feecache.GetTakerFee(ctx, config.Venues[route.Buy], account.Credentials[route.Buy], arbitragerequest.BuyExchange); err != nil {
 
-		var valrbalance ValrBalance = valrbalancelist[valrbalanceindex]
+		return
+	}
 
-		if valrbalance.Currency == `BTC` {
+	if arbitragerequest.SellFee, err = feecache.GetTakerFee(ctx, config.Venues[route.Sell], account.Credentials[route.Sell], arbitragerequest.SellExchange); err != nil {
 
-			if valrbitcoinbalance, err = strconv.ParseFloat(valrbalance.Available, 64); err != nil {
+		return
+	}
 
-				log.Panic(err)
+	if recorder.Dir != `` {
 
-				return
-			}
-		}
+		arbitragerequest.BuyExchange = &RecordingExchange{Exchange: arbitragerequest.BuyExchange, Recorder: recorder}
+		arbitragerequest.SellExchange = &RecordingExchange{Exchange: arbitragerequest.SellExchange, Recorder: recorder}
+	}
+
+	if strategy.Paper {
+
+		arbitragerequest.BuyExchange = paperengine.Wrap(account.Name, route.Buy, account.Paper[route.Buy], arbitragerequest.BuyFee, arbitragerequest.BuyExchange)
+		arbitragerequest.SellExchange = paperengine.Wrap(account.Name, route.Sell, account.Paper[route.Sell], arbitragerequest.SellFee, arbitragerequest.SellExchange)
+	}
+
+	arbitrageresponse, err = Arbitrage(ctx, arbitragerequest)
+
+	if err != nil && !arbitrageresponse.Executed {
+
+		return
+	}
+
+	var ledgererr error
+
+	if ledgererr = ledger.Record(NewLedgerEntry(route, arbitragerequest, arbitrageresponse, time.Now())); ledgererr != nil {
+
+		log.Printf(`Error('ledger: %+[1]v')`, ledgererr)
 	}
 
-	valrbitcoinbalance = RoundFloat(valrbitcoinbalance, 8)
+	ObserveArbitrage(arbitragerequest, arbitrageresponse)
 
 	return
 }
 
-func GetBitstampBuyableLiquidity(bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string) (bitstampbuyable Depth) {
+func PrepareArbitrage(route RouteConfig, ecbrates EcbRates, arbitragerequest *ArbitrageRequest) (err error) {
 
-	bitstampbuyable = Depth{
-		Type:          Ask,
-		BaseCurrency:  `btc`,
-		QuoteCurrency: `usd`,
-		Levels:        []Level{},
-	}
+	var buypair Pair = arbitragerequest.BuyExchange.Pair()
+	var sellpair Pair = arbitragerequest.SellExchange.Pair()
 
-	var err error
+	var limitrate float64
+	var exchangerate float64
 
-	var bitstamporderbook BitstampOrderBook
+	if limitrate, err = ecbrates.Rate(route.LimitCurrency, buypair.QuoteCurrency); err != nil {
 
-	if bitstamporderbook, err = GetBitstampOrderBook(bitstampkey, bitstampsecret, bitstampcustomer, bitstamphost, `btcusd`); err != nil {
+		return
+	}
 
-		log.Panic(err)
+	if exchangerate, err = ecbrates.Rate(buypair.QuoteCurrency, sellpair.QuoteCurrency); err != nil {
 
 		return
 	}
 
-	var askindex int = 0
-	var asklength int = len(bitstamporderbook.Asks)
+	arbitragerequest.LimitRate = DecimalFromFloat(limitrate)
+	arbitragerequest.ExchangeRate = DecimalFromFloat(exchangerate)
+	arbitragerequest.BuyLimit = route.Limit.Mul(arbitragerequest.LimitRate).Round(buypair.QuotePrecision)
 
-	for askindex = 0; askindex < asklength; askindex++ {
+	return
+}
 
-		var buylevel Level = Level{}
+func (summary *CycleSummary) Add(arbitrageresponse ArbitrageResponse) {
 
-		if buylevel.BaseAmount, err = strconv.ParseFloat(bitstamporderbook.Asks[askindex][1], 64); err != nil {
+	summary.Evaluated += 1
 
-			log.Panic(err)
+	if arbitrageresponse.Evaluation.Opportunity {
 
-			return
-		}
+		summary.Opportunities += 1
+	}
 
-		if buylevel.QuoteAmount, err = strconv.ParseFloat(bitstamporderbook.Asks[askindex][0], 64); err != nil {
+	if arbitrageresponse.Executed && arbitrageresponse.Paper {
 
-			log.Panic(err)
+		summary.Simulated += 1
 
-			return
-		}
+	} else if arbitrageresponse.Executed {
 
-		bitstampbuyable.Levels = append(bitstampbuyable.Levels, buylevel)
+		summary.Executed += 1
 	}
 
-	return
+	if arbitrageresponse.Hedge.State == HedgeAlerted {
+
+		summary.Unhedged += 1
+	}
 }
 
-func GetValrSellableLiquidity(valrkey string, valrsecret string, valrhost string) (valrsellable Depth) {
+func Arbitrage(ctx context.Context, arbitragerequest ArbitrageRequest) (arbitrageresponse ArbitrageResponse, err error) {
+
+	var buyexchange Exchange = arbitragerequest.BuyExchange
+	var sellexchange Exchange = arbitragerequest.SellExchange
+
+	var buypair Pair = buyexchange.Pair()
+	var sellpair Pair = sellexchange.Pair()
+
+	log.Printf(`arbitrage: buy %[1]v %[2]v, sell %[3]v %[4]v`, buyexchange.Name(), buypair.Symbol, sellexchange.Name(), sellpair.Symbol)
+
+	var buyquotebalance Decimal
+	var sellbasebalance Decimal
+
+	if buyquotebalance, err = buyexchange.GetBalance(ctx, buypair.QuoteCurrency); err != nil {
 
-	valrsellable = Depth{
-		Type:          Bid,
-		BaseCurrency:  `btc`,
-		QuoteCurrency: `zar`,
-		Levels:        []Level{},
+		return
 	}
 
-	var err error
+	if sellbasebalance, err = sellexchange.GetBalance(ctx, sellpair.BaseCurrency); err != nil {
+
+		return
+	}
 
-	var valrorderbook ValrOrderBook
+	log.Printf(`buyquotebalance: %+[1]v`, buyquotebalance)
+	log.Printf(`sellbasebalance: %+[1]v`, sellbasebalance)
 
-	if valrorderbook, err = GetValrOrderBook(valrkey, valrsecret, valrhost, `btczar`); err != nil {
+	var buyable Depth
+	var sellable Depth
 
-		log.Panic(err)
+	if buyable, err = buyexchange.GetDepth(ctx, Ask); err != nil {
 
 		return
 	}
 
-	var bidindex int = 0
-	var bidlength int = len(valrorderbook.Bids)
+	if sellable, err = sellexchange.GetDepth(ctx, Bid); err != nil {
 
-	for bidindex = 0; bidindex < bidlength; bidindex++ {
+		return
+	}
 
-		var selllevel Level = Level{}
+	var evaluation Evaluation = EvaluateArbitrage(arbitragerequest, buyable, sellable, buyquotebalance, sellbasebalance)
 
-		if selllevel.BaseAmount, err = strconv.ParseFloat(valrorderbook.Bids[bidindex].Quantity, 64); err != nil {
+	arbitrageresponse.Evaluation = evaluation
+	arbitrageresponse.Paper = arbitragerequest.Paper
+	arbitrageresponse.BuyQuoteBalance = buyquotebalance
+	arbitrageresponse.SellBaseBalance = sellbasebalance
+	arbitrageresponse.Buyable = buyable
+	arbitrageresponse.Sellable = sellable
 
-			log.Panic(err)
+	if !evaluation.Opportunity || !arbitragerequest.ExecuteTrade {
 
-			return
-		}
+		return
+	}
+
+	if err = ctx.Err(); err != nil {
 
-		if selllevel.QuoteAmount, err = strconv.ParseFloat(valrorderbook.Bids[bidindex].Price, 64); err != nil {
+		return
+	}
 
-			log.Panic(err)
+	var ordercontext context.Context
+	var cancelorders context.CancelFunc
 
-			return
+	ordercontext, cancelorders = context.WithTimeout(context.WithoutCancel(ctx), arbitragerequest.HedgeConfig.Timeout.Duration)
+
+	defer cancelorders()
+
+	arbitrageresponse.ArbitrageId = NewArbitrageId()
+
+	log.Printf(`arbitrageid: %+[1]v`, arbitrageresponse.ArbitrageId)
+
+	var buyorderid string
+
+	if buyorderid, err = PlaceOrder(ordercontext, buyexchange, Order{
+		Side:          Buy,
+		BaseAmount:    evaluation.BuyTrade.BaseAmount,
+		Price:         evaluation.BuyTrade.QuoteAmount,
+		TimeInForce:   `IOC`,
+		ClientOrderId: ClientOrderId(arbitragerequest.Account, arbitrageresponse.ArbitrageId, `buy`),
+	}); err != nil {
+
+		if errors.Is(err, ErrOrderUncertain) {
+
+			err = fmt.Errorf(`%[1]w: buy leg: %[2]w`, ErrInterrupted, err)
 		}
 
-		valrsellable.Levels = append(valrsellable.Levels, selllevel)
+		return
 	}
 
-	return
-}
+	log.Printf(`buyorderid: %+[1]v`, buyorderid)
 
-func GetBitstampOrderBook(bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string) (bitstamporderbook BitstampOrderBook, err error) {
+	arbitrageresponse.Executed = true
 
-	var urlvalues url.Values = url.Values{
-		`group`: []string{strconv.FormatInt(1, 10)},
+	var sellorderid string
+
+	if sellorderid, err = PlaceOrder(ordercontext, sellexchange, Order{
+		Side:          Sell,
+		BaseAmount:    evaluation.SellTrade.BaseAmount,
+		Price:         evaluation.SellTrade.QuoteAmount,
+		TimeInForce:   `IOC`,
+		ClientOrderId: ClientOrderId(arbitragerequest.Account, arbitrageresponse.ArbitrageId, `sell`),
+	}); err != nil {
+
+		log.Printf(`Error('sell leg: %+[1]v')`, err)
+
+		arbitrageresponse.SellOrderStatus = OrderStatus{Status: OrderFailed, BaseAmount: evaluation.SellTrade.BaseAmount, BaseFilled: DecimalZero, BaseRemaining: evaluation.SellTrade.BaseAmount, Reason: err.Error()}
+
+	} else {
+
+		log.Printf(`sellorderid: %+[1]v`, sellorderid)
 	}
 
-	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
-		Key:      bitstampkey,
-		Secret:   bitstampsecret,
-		Customer: bitstampcustomer,
-		Host:     bitstamphost,
-		Method:   http.MethodGet,
-		Path:     strings.Join([]string{``, `api`, `v2`, `order_book`, currencypair, ``}, `/`),
-		Query:    strings.Join([]string{`?`, urlvalues.Encode()}, ``),
-	})
+	if arbitrageresponse.BuyOrderStatus, err = SettleOrderStatus(ordercontext, buyexchange, buyorderid, arbitragerequest.HedgeConfig.Settle.Duration); err != nil {
 
-	if bitstampresponse.Error != `` {
+		err = fmt.Errorf(`%[1]w: buy order %[2]v: %[3]w`, ErrInterrupted, buyorderid, err)
 
-		err = errors.New(bitstampresponse.Error)
+		return
 	}
 
-	if bitstampresponse.Value != `` {
+	log.Printf(`buyorderstatus: %+[1]v`, arbitrageresponse.BuyOrderStatus)
+
+	if sellorderid != `` {
+
+		if arbitrageresponse.SellOrderStatus, err = SettleOrderStatus(ordercontext, sellexchange, sellorderid, arbitragerequest.HedgeConfig.Settle.Duration); err != nil {
+
+			err = fmt.Errorf(`%[1]w: sell order %[2]v: %[3]w`, ErrInterrupted, sellorderid, err)
+
+			return
+		}
+	}
 
-		json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporderbook)
+	log.Printf(`sellorderstatus: %+[1]v`, arbitrageresponse.SellOrderStatus)
+
+	var hedge Hedge = Hedge{
+		HedgeConfig:  arbitragerequest.HedgeConfig,
+		Account:      arbitragerequest.Account,
+		ArbitrageId:  arbitrageresponse.ArbitrageId,
+		BuyExchange:  buyexchange,
+		SellExchange: sellexchange,
+		BuyTrade:     evaluation.BuyTrade,
+		SellTrade:    evaluation.SellTrade,
+		BuyFee:       arbitragerequest.BuyFee,
 	}
 
+	hedge.Run(ordercontext, arbitrageresponse.BuyOrderStatus, arbitrageresponse.SellOrderStatus)
+
+	arbitrageresponse.Hedge = hedge
+
 	return
 }
 
-func PostBitstampAccountBalance(bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string) (bitstampbalance BitstampBalance, err error) {
+func EvaluateArbitrage(arbitragerequest ArbitrageRequest, buyable Depth, sellable Depth, buyquotebalance Decimal, sellbasebalance Decimal) (evaluation Evaluation) {
 
-	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
-		Key:      bitstampkey,
-		Secret:   bitstampsecret,
-		Customer: bitstampcustomer,
-		Host:     bitstamphost,
-		Method:   http.MethodPost,
-		Path:     strings.Join([]string{``, `api`, `v2`, `account_balances`, currencypair, ``}, `/`),
-	})
+	var buypair Pair = arbitragerequest.BuyExchange.Pair()
+	var sellpair Pair = arbitragerequest.SellExchange.Pair()
 
-	if bitstampresponse.Error != `` {
+	var exchangerate Decimal = arbitragerequest.ExchangeRate
+	var profitmargin float64 = arbitragerequest.ProfitMargin
+
+	var buynotional Decimal = arbitragerequest.BuyLimit
+
+	var buytradeable Trade = CalculateTrade(buyable, buynotional)
 
-		err = errors.New(bitstampresponse.Error)
+	log.Printf(`buytradeable: %+[1]v`, buytradeable)
+
+	if buytradeable.Shortfall.Sign() > 0 {
+
+		log.Printf(`shortfall: buy %[1]v of %[2]v %[3]v`, buytradeable.Shortfall, buynotional, buypair.QuoteCurrency)
+
+		buynotional = buytradeable.NotionalAmount
 	}
 
-	if bitstampresponse.Value != `` {
+	var sellnotional Decimal = buynotional.Mul(exchangerate)
+	sellnotional = sellnotional.Round(sellpair.QuotePrecision)
 
-		json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstampbalance)
+	var selltradeable Trade = CalculateTrade(sellable, sellnotional)
+
+	log.Printf(`selltradeable: %+[1]v`, selltradeable)
+
+	if selltradeable.Shortfall.Sign() > 0 {
+
+		log.Printf(`shortfall: sell %[1]v of %[2]v %[3]v`, selltradeable.Shortfall, sellnotional, sellpair.QuoteCurrency)
 	}
 
-	return
-}
+	evaluation.BuyShortfall = buytradeable.Shortfall
+	evaluation.SellShortfall = selltradeable.Shortfall
 
-func PostBitstampAccountBalances(bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string) (bitstampbalance BitstampBalance, err error) {
+	if buytradeable.Shortfall.Sign() > 0 || selltradeable.Shortfall.Sign() > 0 {
 
-	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
-		Key:      bitstampkey,
-		Secret:   bitstampsecret,
-		Customer: bitstampcustomer,
-		Host:     bitstamphost,
-		Method:   http.MethodPost,
-		Path:     strings.Join([]string{``, `api`, `v2`, `account_balances`, ``}, `/`),
+		if arbitragerequest.ScaleDown <= 0 {
+
+			evaluation.BuyTradeable = buytradeable
+			evaluation.SellTradeable = selltradeable
+
+			return
+		}
+
+		buynotional = MinDecimal(buynotional, selltradeable.NotionalAmount.Div(exchangerate, 18).Truncate(buypair.QuotePrecision))
+
+		var minimumnotional Decimal = arbitragerequest.BuyLimit.Mul(DecimalFromFloat(arbitragerequest.ScaleDown))
+
+		if buynotional.Sign() <= 0 || buynotional.LessThan(minimumnotional) {
+
+			log.Printf(`scaledown: %[1]v %[2]v fillable, below %[3]v`, buynotional, buypair.QuoteCurrency, minimumnotional)
+
+			evaluation.BuyTradeable = buytradeable
+			evaluation.SellTradeable = selltradeable
+
+			return
+		}
+
+		buytradeable = CalculateTrade(buyable, buynotional)
+
+		sellnotional = buynotional.Mul(exchangerate)
+		sellnotional = sellnotional.Truncate(sellpair.QuotePrecision)
+
+		selltradeable = CalculateTrade(sellable, sellnotional)
+
+		evaluation.Scaled = true
+
+		log.Printf(`scaledown: buy %[1]v of %[2]v %[3]v`, buynotional, arbitragerequest.BuyLimit, buypair.QuoteCurrency)
+		log.Printf(`buytradeable: %+[1]v`, buytradeable)
+		log.Printf(`selltradeable: %+[1]v`, selltradeable)
+	}
+
+	evaluation.BuyTradeable = buytradeable
+	evaluation.SellTradeable = selltradeable
+
+	var buyquoterequired Decimal = buynotional
+
+	if buypair.FeeInQuote {
+
+		buyquoterequired = buynotional.Mul(DecimalOne.Add(DecimalFromFloat(arbitragerequest.BuyFee))).Round(buypair.QuotePrecision)
+	}
+
+	if !buytradeable.NotionalAmount.Equal(buynotional) || !selltradeable.NotionalAmount.Equal(sellnotional) || buytradeable.Shortfall.Sign() > 0 || selltradeable.Shortfall.Sign() > 0 || buyquoterequired.GreaterThan(buyquotebalance) || selltradeable.BaseAmount.GreaterThan(sellbasebalance) {
+
+		return
+	}
+
+	evaluation.GrossPercent = CalculateProfit(buytradeable.BaseAmount, selltradeable.BaseAmount)
+
+	var buyfeefactor Decimal = buypair.FeeFactor(Buy, arbitragerequest.BuyFee)
+	var sellfeefactor Decimal = sellpair.FeeFactor(Sell, arbitragerequest.SellFee)
+
+	evaluation.GrossBase = buytradeable.BaseAmount.Sub(selltradeable.BaseAmount).Round(buypair.BasePrecision)
+	evaluation.NetBase = buytradeable.BaseAmount.Mul(buyfeefactor).Sub(selltradeable.BaseAmount.Div(sellfeefactor, 18)).Round(buypair.BasePrecision)
+
+	evaluation.NetPercent = evaluation.NetBase.Div(buytradeable.BaseAmount, 18).Float64()
+
+	var sellaverageprice Decimal = selltradeable.NotionalAmount.Div(selltradeable.BaseAmount, 18)
+
+	evaluation.GrossQuote = evaluation.GrossBase.Mul(sellaverageprice).Round(sellpair.QuotePrecision)
+	evaluation.NetQuote = evaluation.NetBase.Mul(sellaverageprice).Round(sellpair.QuotePrecision)
+
+	log.Printf(`bitcoinprofitpercent: gross %+[1]v net %+[2]v`, evaluation.GrossPercent, evaluation.NetPercent)
+	log.Printf(`edge: gross %+[1]v %[3]v %+[2]v %[4]v, net %+[5]v %[3]v %+[6]v %[4]v`, evaluation.GrossBase, evaluation.GrossQuote, buypair.BaseCurrency, sellpair.QuoteCurrency, evaluation.NetBase, evaluation.NetQuote)
+
+	if evaluation.NetPercent < profitmargin {
+
+		return
+	}
+
+	evaluation.Opportunity = true
+
+	var marginfactor Decimal = DecimalOne.Add(DecimalFromFloat(profitmargin))
+
+	var buylimitprice Decimal
+	buylimitprice = selltradeable.QuoteAmount.Mul(sellfeefactor).Mul(buyfeefactor).Div(exchangerate.Mul(marginfactor), buypair.PricePrecision)
+
+	var selllimitprice Decimal
+	selllimitprice = buytradeable.QuoteAmount.Mul(exchangerate).Mul(marginfactor).Div(buyfeefactor.Mul(sellfeefactor), sellpair.PricePrecision)
+
+	log.Printf(`buylimitprice: %+[1]v`, buylimitprice)
+	log.Printf(`selllimitprice: %+[1]v`, selllimitprice)
+
+	evaluation.BuyTrade = Trade{BaseAmount: buytradeable.BaseAmount, QuoteAmount: buylimitprice, NotionalAmount: buytradeable.NotionalAmount}
+	evaluation.SellTrade = Trade{BaseAmount: selltradeable.BaseAmount, QuoteAmount: selllimitprice, NotionalAmount: selltradeable.NotionalAmount}
+
+	log.Printf(`buytrade: %+[1]v`, evaluation.BuyTrade)
+	log.Printf(`selltrade: %+[1]v`, evaluation.SellTrade)
+
+	return
+}
+
+func ReadCsv(filename string) (csvlines [][]string, err error) {
+
+	csvlines = [][]string{}
+
+	var file *os.File
+
+	if file, err = os.Open(filename); err != nil {
+
+		return
+	}
+
+	defer file.Close()
+
+	if csvlines, err = csv.NewReader(file).ReadAll(); err != nil {
+
+		err = ParseError(err)
+
+		return
+	}
+
+	return
+}
+
+func (watchedfile *WatchedFile) Refresh() (changed bool, err error) {
+
+	var fileinfo os.FileInfo
+
+	if fileinfo, err = os.Stat(watchedfile.Name); err != nil {
+
+		return
+	}
+
+	if watchedfile.Content != nil && fileinfo.ModTime().Equal(watchedfile.ModTime) && fileinfo.Size() == watchedfile.Size {
+
+		return
+	}
+
+	if watchedfile.Content, err = os.ReadFile(watchedfile.Name); err != nil {
+
+		return
+	}
+
+	watchedfile.ModTime = fileinfo.ModTime()
+	watchedfile.Size = fileinfo.Size()
+
+	changed = true
+
+	log.Printf(`loaded: %+[1]v`, watchedfile.Name)
+
+	return
+}
+
+func CalculateProfit(buybitcoinvalue Decimal, sellbitcoinvalue Decimal) (bitcoinprofitpercent float64) {
+
+	if buybitcoinvalue.Sign() <= 0 {
+
+		return
+	}
+
+	var bitcoinprofit Decimal = DecimalZero
+
+	bitcoinprofit = bitcoinprofit.Add(buybitcoinvalue)
+	bitcoinprofit = bitcoinprofit.Sub(sellbitcoinvalue)
+
+	bitcoinprofitpercent = bitcoinprofit.Div(buybitcoinvalue, 18).Float64()
+
+	return
+}
+
+func CalculateTrade(depth Depth, notional Decimal) (trade Trade) {
+
+	trade = Trade{}
+
+	if notional.Sign() <= 0 {
+
+		return
+	}
+
+	var level int = 0
+	var levels int = len(depth.Levels)
+
+	var depthlevel Level
+	var lastlevel Level
+
+	for level = 0; level < levels; level += 1 {
+
+		if level == 0 {
+
+			lastlevel = Level{}
+
+		} else {
+
+			lastlevel = depthlevel
+		}
+
+		depthlevel = depth.Levels[level]
+
+		if depthlevel.NotionalAmount.IsZero() {
+
+			depthlevel.NotionalAmount = DecimalZero
+
+			depthlevel.NotionalAmount = depthlevel.NotionalAmount.Add(depthlevel.BaseAmount)
+			depthlevel.NotionalAmount = depthlevel.NotionalAmount.Mul(depthlevel.QuoteAmount)
+			depthlevel.NotionalAmount = depthlevel.NotionalAmount.Round(2)
+
+			depthlevel.BaseTotal = DecimalZero
+
+			depthlevel.BaseTotal = depthlevel.BaseTotal.Add(lastlevel.BaseTotal)
+			depthlevel.BaseTotal = depthlevel.BaseTotal.Add(depthlevel.BaseAmount)
+
+			depthlevel.NotionalTotal = DecimalZero
+
+			depthlevel.NotionalTotal = depthlevel.NotionalTotal.Add(lastlevel.NotionalTotal)
+			depthlevel.NotionalTotal = depthlevel.NotionalTotal.Add(depthlevel.NotionalAmount)
+
+			depthlevel.BaseAhead = DecimalZero
+			depthlevel.BaseAhead = depthlevel.BaseAhead.Add(lastlevel.BaseTotal)
+
+			depthlevel.NotionalAhead = DecimalZero
+			depthlevel.NotionalAhead = depthlevel.NotionalAhead.Add(lastlevel.NotionalTotal)
+		}
+
+		var notionallimitexceeded bool = notional.Sign() > 0 && depthlevel.NotionalTotal.GreaterThan(notional)
+
+		if notionallimitexceeded {
+
+			break
+		}
+	}
+
+	if level > -1 && level < levels {
+
+		trade.BaseAmount = depthlevel.BaseTotal
+		trade.QuoteAmount = depthlevel.QuoteAmount
+		trade.NotionalAmount = depthlevel.NotionalTotal
+
+		var notionallimitexceeded bool = notional.Sign() > 0 && depthlevel.NotionalTotal.GreaterThan(notional)
+
+		if notionallimitexceeded {
+
+			var notionallimitpercent Decimal = DecimalZero
+
+			notionallimitpercent = notionallimitpercent.Sub(depthlevel.NotionalTotal)
+			notionallimitpercent = notionallimitpercent.Add(notional)
+			notionallimitpercent = notionallimitpercent.Add(depthlevel.NotionalAmount)
+			notionallimitpercent = notionallimitpercent.Div(depthlevel.NotionalAmount, 18)
+
+			trade.BaseAmount = DecimalZero
+			trade.BaseAmount = trade.BaseAmount.Add(depthlevel.BaseAmount)
+			trade.BaseAmount = trade.BaseAmount.Mul(notionallimitpercent)
+			trade.BaseAmount = trade.BaseAmount.Add(depthlevel.BaseAhead)
+			trade.BaseAmount = trade.BaseAmount.Truncate(8)
+
+			trade.NotionalAmount = notional
+		}
+
+	} else if levels > 0 {
+
+		trade.BaseAmount = depthlevel.BaseTotal
+		trade.QuoteAmount = depthlevel.QuoteAmount
+		trade.NotionalAmount = depthlevel.NotionalTotal
+		trade.Shortfall = notional.Sub(depthlevel.NotionalTotal)
+
+	} else {
+
+		trade.Shortfall = notional
+	}
+
+	return
+}
+
+func GetBitstampOrderBook(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string) (bitstamporderbook BitstampOrderBook, err error) {
+
+	var urlvalues url.Values = url.Values{
+		`group`: []string{strconv.FormatInt(1, 10)},
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodGet,
+		Path:     strings.Join([]string{``, `api`, `v2`, `order_book`, currencypair, ``}, `/`),
+		Query:    strings.Join([]string{`?`, urlvalues.Encode()}, ``),
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporderbook); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampAccountBalance(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string) (bitstampbalance BitstampBalance, err error) {
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `account_balances`, currencypair, ``}, `/`),
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstampbalance); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampAccountBalances(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string) (bitstampbalance BitstampBalance, err error) {
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `account_balances`, ``}, `/`),
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstampbalance); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampBuyLimitOrder(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string, amount Decimal, price Decimal, day bool, ioc bool, fok bool, clientorderid string) (bitstamporder BitstampOrder, err error) {
+
+	var requestvalues url.Values = url.Values{
+		`amount`:      []string{amount.String()},
+		`price`:       []string{price.String()},
+		`daily_order`: []string{strconv.FormatBool(day)},
+		`ioc_order`:   []string{strconv.FormatBool(ioc)},
+		`fok_order`:   []string{strconv.FormatBool(fok)},
+	}
+
+	if clientorderid != `` {
+
+		requestvalues.Set(`client_order_id`, clientorderid)
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `buy`, currencypair, ``}, `/`),
+		Request:  requestvalues.Encode(),
+		Type:     `application/x-www-form-urlencoded`,
+		Order:    true,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Uncertain {
+
+		err = errors.Join(ErrOrderUncertain, err)
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporder); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampSellLimitOrder(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string, amount Decimal, price Decimal, day bool, ioc bool, fok bool, clientorderid string) (bitstamporder BitstampOrder, err error) {
+
+	var requestvalues url.Values = url.Values{
+		`amount`:      []string{amount.String()},
+		`price`:       []string{price.String()},
+		`daily_order`: []string{strconv.FormatBool(day)},
+		`ioc_order`:   []string{strconv.FormatBool(ioc)},
+		`fok_order`:   []string{strconv.FormatBool(fok)},
+	}
+
+	if clientorderid != `` {
+
+		requestvalues.Set(`client_order_id`, clientorderid)
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `sell`, currencypair, ``}, `/`),
+		Request:  requestvalues.Encode(),
+		Type:     `application/x-www-form-urlencoded`,
+		Order:    true,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Uncertain {
+
+		err = errors.Join(ErrOrderUncertain, err)
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporder); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampOrderStatus(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, id string, clientorderid string) (bitstamporderstatus BitstampOrderStatus, err error) {
+
+	var requestvalues url.Values = url.Values{}
+
+	if id != `` {
+
+		requestvalues.Set(`id`, id)
+	}
+
+	if clientorderid != `` {
+
+		requestvalues.Set(`client_order_id`, clientorderid)
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `order_status`, ``}, `/`),
+		Request:  requestvalues.Encode(),
+		Type:     `application/x-www-form-urlencoded`,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporderstatus); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampCancelOrder(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, id string) (bitstamporder BitstampOrder, err error) {
+
+	var requestvalues url.Values = url.Values{
+		`id`: []string{id},
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `cancel_order`, ``}, `/`),
+		Request:  requestvalues.Encode(),
+		Type:     `application/x-www-form-urlencoded`,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporder); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampBuyMarketOrder(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string, amount Decimal, clientorderid string) (bitstamporder BitstampOrder, err error) {
+
+	var requestvalues url.Values = url.Values{
+		`amount`: []string{amount.String()},
+	}
+
+	if clientorderid != `` {
+
+		requestvalues.Set(`client_order_id`, clientorderid)
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `buy`, `market`, currencypair, ``}, `/`),
+		Request:  requestvalues.Encode(),
+		Type:     `application/x-www-form-urlencoded`,
+		Order:    true,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Uncertain {
+
+		err = errors.Join(ErrOrderUncertain, err)
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporder); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampSellMarketOrder(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string, amount Decimal, clientorderid string) (bitstamporder BitstampOrder, err error) {
+
+	var requestvalues url.Values = url.Values{
+		`amount`: []string{amount.String()},
+	}
+
+	if clientorderid != `` {
+
+		requestvalues.Set(`client_order_id`, clientorderid)
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `sell`, `market`, currencypair, ``}, `/`),
+		Request:  requestvalues.Encode(),
+		Type:     `application/x-www-form-urlencoded`,
+		Order:    true,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Uncertain {
+
+		err = errors.Join(ErrOrderUncertain, err)
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporder); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampBuyInstantOrder(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string, amount Decimal, clientorderid string) (bitstamporder BitstampOrder, err error) {
+
+	var requestvalues url.Values = url.Values{
+		`amount`: []string{amount.String()},
+	}
+
+	if clientorderid != `` {
+
+		requestvalues.Set(`client_order_id`, clientorderid)
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `buy`, `instant`, currencypair, ``}, `/`),
+		Request:  requestvalues.Encode(),
+		Type:     `application/x-www-form-urlencoded`,
+		Order:    true,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Uncertain {
+
+		err = errors.Join(ErrOrderUncertain, err)
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporder); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampSellInstantOrder(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string, amount Decimal, clientorderid string) (bitstamporder BitstampOrder, err error) {
+
+	var requestvalues url.Values = url.Values{
+		`amount`: []string{amount.String()},
+	}
+
+	if clientorderid != `` {
+
+		requestvalues.Set(`client_order_id`, clientorderid)
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `sell`, `instant`, currencypair, ``}, `/`),
+		Request:  requestvalues.Encode(),
+		Type:     `application/x-www-form-urlencoded`,
+		Order:    true,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Uncertain {
+
+		err = errors.Join(ErrOrderUncertain, err)
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporder); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampCancelAllOrders(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string) (bitstampcancelall BitstampCancelAll, err error) {
+
+	var path string = strings.Join([]string{``, `api`, `v2`, `cancel_all_orders`, ``}, `/`)
+
+	if currencypair != `` {
+
+		path = strings.Join([]string{``, `api`, `v2`, `cancel_all_orders`, currencypair, ``}, `/`)
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     path,
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstampcancelall); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampOpenOrders(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string) (bitstampopenorders []BitstampOpenOrder, err error) {
+
+	if currencypair == `` {
+
+		currencypair = `all`
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `open_orders`, currencypair, ``}, `/`),
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstampopenorders); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostBitstampUserTransactions(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string, offset int, limit int, sort string, sincetimestamp int64) (bitstampusertransactions []BitstampUserTransaction, err error) {
+
+	var path string = strings.Join([]string{``, `api`, `v2`, `user_transactions`, ``}, `/`)
+
+	if currencypair != `` {
+
+		path = strings.Join([]string{``, `api`, `v2`, `user_transactions`, currencypair, ``}, `/`)
+	}
+
+	var requestvalues url.Values = url.Values{}
+
+	if offset > 0 {
+
+		requestvalues.Set(`offset`, strconv.Itoa(offset))
+	}
+
+	if limit > 0 {
+
+		requestvalues.Set(`limit`, strconv.Itoa(limit))
+	}
+
+	if sort != `` {
+
+		requestvalues.Set(`sort`, sort)
+	}
+
+	if sincetimestamp > 0 {
+
+		requestvalues.Set(`since_timestamp`, strconv.FormatInt(sincetimestamp, 10))
+	}
+
+	var bitstamprequest BitstampRequest = BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     path,
+	}
+
+	if len(requestvalues) > 0 {
+
+		bitstamprequest.Request = requestvalues.Encode()
+		bitstamprequest.Type = `application/x-www-form-urlencoded`
+	}
+
+	var bitstampresponse BitstampResponse = BitstampApi(bitstamprequest)
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstampusertransactions); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func (bitstampusertransaction *BitstampUserTransaction) UnmarshalJSON(data []byte) (err error) {
+
+	var fields map[string]json.RawMessage
+
+	if err = json.Unmarshal(data, &fields); err != nil {
+
+		return
+	}
+
+	bitstampusertransaction.Amounts = map[string]string{}
+
+	var name string
+	var value json.RawMessage
+
+	for name, value = range fields {
+
+		var text string = strings.Trim(string(value), `"`)
+
+		switch name {
+
+		case `id`:
+
+			bitstampusertransaction.Id, err = strconv.ParseInt(text, 10, 64)
+
+		case `order_id`:
+
+			bitstampusertransaction.OrderId, err = strconv.ParseInt(text, 10, 64)
+
+		case `datetime`:
+
+			bitstampusertransaction.DateTime = text
+
+		case `type`:
+
+			bitstampusertransaction.Type = text
+
+		case `fee`:
+
+			bitstampusertransaction.Fee = text
+
+		default:
+
+			if text != `null` {
+
+				bitstampusertransaction.Amounts[name] = text
+			}
+		}
+
+		if err != nil {
+
+			return
+		}
+	}
+
+	return
+}
+
+func PostBitstampTradingFees(ctx context.Context, bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string) (bitstamptradingfee BitstampTradingFee, err error) {
+
+	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
+		Context:  ctx,
+		Key:      bitstampkey,
+		Secret:   bitstampsecret,
+		Customer: bitstampcustomer,
+		Host:     bitstamphost,
+		Method:   http.MethodPost,
+		Path:     strings.Join([]string{``, `api`, `v2`, `fees`, `trading`, currencypair, ``}, `/`),
+	})
+
+	if bitstampresponse.Error != `` {
+
+		err = bitstampresponse.Err
+	}
+
+	if bitstampresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamptradingfee); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func GetValrBalanceList(ctx context.Context, valrkey string, valrsecret string, valrhost string) (valrbalancelist []ValrBalance, err error) {
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodGet,
+		Path:    strings.Join([]string{``, `v1`, `account`, `balances`}, `/`),
+	})
+
+	if valrresponse.Error != `` {
+
+		err = valrresponse.Err
+	}
+
+	if valrresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrbalancelist); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func GetValrTradeFees(ctx context.Context, valrkey string, valrsecret string, valrhost string) (valrtradefeelist []ValrTradeFee, err error) {
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodGet,
+		Path:    strings.Join([]string{``, `v1`, `account`, `fees`, `trade`}, `/`),
+	})
+
+	if valrresponse.Error != `` {
+
+		err = valrresponse.Err
+	}
+
+	if valrresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrtradefeelist); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func GetValrOrderBook(ctx context.Context, valrkey string, valrsecret string, valrhost string, currencypair string) (valrorderbook ValrOrderBook, err error) {
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodGet,
+		Path:    strings.Join([]string{``, `v1`, `marketdata`, currencypair, `orderbook`}, `/`),
+	})
+
+	if valrresponse.Error != `` {
+
+		err = valrresponse.Err
+	}
+
+	if valrresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderbook); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func GetValrOrderStatus(ctx context.Context, valrkey string, valrsecret string, valrhost string, currencypair string, orderid string) (valrorderstatus ValrOrderStatus, err error) {
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodGet,
+		Path:    strings.Join([]string{``, `v1`, `orders`, currencypair, `orderid`, orderid}, `/`),
+	})
+
+	if valrresponse.Error != `` {
+
+		err = valrresponse.Err
+	}
+
+	if valrresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderstatus); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func GetValrOrderStatusByCustomerOrderId(ctx context.Context, valrkey string, valrsecret string, valrhost string, currencypair string, customerorderid string) (valrorderstatus ValrOrderStatus, err error) {
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodGet,
+		Path:    strings.Join([]string{``, `v1`, `orders`, currencypair, `customerorderid`, customerorderid}, `/`),
+	})
+
+	if valrresponse.Error != `` {
+
+		err = valrresponse.Err
+	}
+
+	if valrresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderstatus); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func PostValrLimitOrder(ctx context.Context, valrkey string, valrsecret string, valrhost string, valrlimitorder ValrLimitOrder) (valrorderid ValrOrderId, err error) {
+
+	var requestbuffer *bytes.Buffer = bytes.NewBuffer([]byte{})
+
+	json.NewEncoder(requestbuffer).Encode(valrlimitorder)
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodPost,
+		Path:    strings.Join([]string{``, `v1`, `orders`, `limit`}, `/`),
+		Request: requestbuffer.String(),
+		Type:    `application/json`,
+		Order:   true,
+	})
+
+	if valrresponse.Error != `` {
+
+		err = valrresponse.Err
+	}
+
+	if valrresponse.Uncertain {
+
+		err = errors.Join(ErrOrderUncertain, err)
+	}
+
+	if valrresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderid); err != nil {
+
+			err = ParseError(err)
+		}
+	}
+
+	return
+}
+
+func DeleteValrOrder(ctx context.Context, valrkey string, valrsecret string, valrhost string, valrcancelorder ValrCancelOrder) (err error) {
+
+	var requestbuffer *bytes.Buffer = bytes.NewBuffer([]byte{})
+
+	json.NewEncoder(requestbuffer).Encode(valrcancelorder)
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodDelete,
+		Path:    strings.Join([]string{``, `v1`, `orders`, `order`}, `/`),
+		Request: requestbuffer.String(),
+		Type:    `application/json`,
 	})
 
-	if bitstampresponse.Error != `` {
-
-		err = errors.New(bitstampresponse.Error)
-	}
-
-	if bitstampresponse.Value != `` {
+	if valrresponse.Error != `` {
 
-		json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstampbalance)
+		err = valrresponse.Err
 	}
 
 	return
 }
 
-func PostBitstampBuyLimitOrder(bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, currencypair string, amount float64, price float64, day bool, ioc bool, fok bool) (bitstamporder BitstampOrder, err error) {
+func PostValrMarketOrder(ctx context.Context, valrkey string, valrsecret string, valrhost string, valrmarketorder ValrMarketOrder) (valrorderid ValrOrderId, err error) {
 
-	var requestvalues url.Values = url.Values{
-		`amount`:      []string{strconv.FormatFloat(amount, 'f', 8, 64)},
-		`price`:       []string{strconv.FormatFloat(price, 'f', 0, 64)},
-		`daily_order`: []string{strconv.FormatBool(day)},
-		`ioc_order`:   []string{strconv.FormatBool(ioc)},
-		`fok_order`:   []string{strconv.FormatBool(fok)},
-	}
+	var requestbuffer *bytes.Buffer = bytes.NewBuffer([]byte{})
 
-	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
-		Key:      bitstampkey,
-		Secret:   bitstampsecret,
-		Customer: bitstampcustomer,
-		Host:     bitstamphost,
-		Method:   http.MethodPost,
-		Path:     strings.Join([]string{``, `api`, `v2`, `buy`, currencypair, ``}, `/`),
-		Request:  requestvalues.Encode(),
-		Type:     `application/x-www-form-urlencoded`,
+	json.NewEncoder(requestbuffer).Encode(valrmarketorder)
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodPost,
+		Path:    strings.Join([]string{``, `v1`, `orders`, `market`}, `/`),
+		Request: requestbuffer.String(),
+		Type:    `application/json`,
+		Order:   true,
 	})
 
-	if bitstampresponse.Error != `` {
+	if valrresponse.Error != `` {
 
-		err = errors.New(bitstampresponse.Error)
+		err = valrresponse.Err
 	}
 
-	if bitstampresponse.Value != `` {
+	if valrresponse.Uncertain {
+
+		err = errors.Join(ErrOrderUncertain, err)
+	}
 
-		json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporder)
+	if valrresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderid); err != nil {
+
+			err = ParseError(err)
+		}
 	}
 
 	return
 }
 
-func PostBitstampOrderStatus(bitstampkey string, bitstampsecret string, bitstampcustomer string, bitstamphost string, id string) (bitstamporderstatus BitstampOrderStatus, err error) {
+func PostValrBatchOrders(ctx context.Context, valrkey string, valrsecret string, valrhost string, valrbatchorders ValrBatchOrders) (valrbatchresponse ValrBatchResponse, err error) {
 
-	var requestvalues url.Values = url.Values{
-		`id`: []string{id},
-	}
+	var requestbuffer *bytes.Buffer = bytes.NewBuffer([]byte{})
 
-	var bitstampresponse BitstampResponse = BitstampApi(BitstampRequest{
-		Key:      bitstampkey,
-		Secret:   bitstampsecret,
-		Customer: bitstampcustomer,
-		Host:     bitstamphost,
-		Method:   http.MethodPost,
-		Path:     strings.Join([]string{``, `api`, `v2`, `order_status`, ``}, `/`),
-		Request:  requestvalues.Encode(),
-		Type:     `application/x-www-form-urlencoded`,
+	json.NewEncoder(requestbuffer).Encode(valrbatchorders)
+
+	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodPost,
+		Path:    strings.Join([]string{``, `v1`, `batch`, `orders`}, `/`),
+		Request: requestbuffer.String(),
+		Type:    `application/json`,
+		Order:   true,
 	})
 
-	if bitstampresponse.Error != `` {
+	if valrresponse.Error != `` {
 
-		err = errors.New(bitstampresponse.Error)
+		err = valrresponse.Err
 	}
 
-	if bitstampresponse.Value != `` {
+	if valrresponse.Uncertain {
 
-		json.NewDecoder(bytes.NewBufferString(bitstampresponse.Value)).Decode(&bitstamporderstatus)
+		err = errors.Join(ErrOrderUncertain, err)
+	}
+
+	if valrresponse.Value != `` {
+
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrbatchresponse); err != nil {
+
+			err = ParseError(err)
+		}
 	}
 
 	return
 }
 
-func GetValrBalanceList(valrkey string, valrsecret string, valrhost string) (valrbalancelist []ValrBalance, err error) {
+func DeleteValrAllOrdersForPair(ctx context.Context, valrkey string, valrsecret string, valrhost string, currencypair string) (valrcancelledorders []ValrCancelledOrder, err error) {
 
 	var valrresponse ValrResponse = ValrApi(ValrRequest{
-		Key:    valrkey,
-		Secret: valrsecret,
-		Host:   valrhost,
-		Method: http.MethodGet,
-		Path:   strings.Join([]string{``, `v1`, `account`, `balances`}, `/`),
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodDelete,
+		Path:    strings.Join([]string{``, `v1`, `orders`, currencypair}, `/`),
 	})
 
 	if valrresponse.Error != `` {
 
-		err = errors.New(valrresponse.Error)
+		err = valrresponse.Err
 	}
 
 	if valrresponse.Value != `` {
 
-		json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrbalancelist)
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrcancelledorders); err != nil {
+
+			err = ParseError(err)
+		}
 	}
 
 	return
 }
 
-func GetValrOrderBook(valrkey string, valrsecret string, valrhost string, currencypair string) (valrorderbook ValrOrderBook, err error) {
+func GetValrOpenOrders(ctx context.Context, valrkey string, valrsecret string, valrhost string) (valropenorders []ValrOpenOrder, err error) {
 
 	var valrresponse ValrResponse = ValrApi(ValrRequest{
-		Key:    valrkey,
-		Secret: valrsecret,
-		Host:   valrhost,
-		Method: http.MethodGet,
-		Path:   strings.Join([]string{``, `v1`, `marketdata`, currencypair, `orderbook`}, `/`),
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodGet,
+		Path:    strings.Join([]string{``, `v1`, `orders`, `open`}, `/`),
 	})
 
 	if valrresponse.Error != `` {
 
-		err = errors.New(valrresponse.Error)
+		err = valrresponse.Err
 	}
 
 	if valrresponse.Value != `` {
 
-		json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderbook)
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valropenorders); err != nil {
+
+			err = ParseError(err)
+		}
 	}
 
 	return
 }
 
-func GetValrOrderStatus(valrkey string, valrsecret string, valrhost string, currencypair string, orderid string) (valrorderstatus ValrOrderStatus, err error) {
+func GetValrOrderHistory(ctx context.Context, valrkey string, valrsecret string, valrhost string, skip int, limit int) (valrorderhistory []ValrOrderHistory, err error) {
+
+	var queryvalues url.Values = url.Values{}
+
+	if skip > 0 {
+
+		queryvalues.Set(`skip`, strconv.Itoa(skip))
+	}
+
+	if limit > 0 {
+
+		queryvalues.Set(`limit`, strconv.Itoa(limit))
+	}
+
+	var query string = ``
+
+	if len(queryvalues) > 0 {
+
+		query = strings.Join([]string{`?`, queryvalues.Encode()}, ``)
+	}
 
 	var valrresponse ValrResponse = ValrApi(ValrRequest{
-		Key:    valrkey,
-		Secret: valrsecret,
-		Host:   valrhost,
-		Method: http.MethodGet,
-		Path:   strings.Join([]string{``, `v1`, `orders`, currencypair, `orderid`, orderid}, `/`),
+		Context: ctx,
+		Key:     valrkey,
+		Secret:  valrsecret,
+		Host:    valrhost,
+		Method:  http.MethodGet,
+		Path:    strings.Join([]string{``, `v1`, `orders`, `history`}, `/`),
+		Query:   query,
 	})
 
 	if valrresponse.Error != `` {
 
-		err = errors.New(valrresponse.Error)
+		err = valrresponse.Err
 	}
 
 	if valrresponse.Value != `` {
 
-		json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderstatus)
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderhistory); err != nil {
+
+			err = ParseError(err)
+		}
 	}
 
 	return
 }
 
-func PostValrLimitOrder(valrkey string, valrsecret string, valrhost string, valrlimitorder ValrLimitOrder) (valrorderid ValrOrderId, err error) {
+func GetValrTradeHistory(ctx context.Context, valrkey string, valrsecret string, valrhost string, currencypair string, skip int, limit int) (valrtradehistory []ValrTrade, err error) {
 
-	var requestbuffer *bytes.Buffer = bytes.NewBuffer([]byte{})
+	var queryvalues url.Values = url.Values{}
 
-	json.NewEncoder(requestbuffer).Encode(valrlimitorder)
+	if skip > 0 {
+
+		queryvalues.Set(`skip`, strconv.Itoa(skip))
+	}
+
+	if limit > 0 {
+
+		queryvalues.Set(`limit`, strconv.Itoa(limit))
+	}
+
+	var query string = ``
+
+	if len(queryvalues) > 0 {
+
+		query = strings.Join([]string{`?`, queryvalues.Encode()}, ``)
+	}
 
 	var valrresponse ValrResponse = ValrApi(ValrRequest{
+		Context: ctx,
 		Key:     valrkey,
 		Secret:  valrsecret,
 		Host:    valrhost,
-		Method:  http.MethodPost,
-		Path:    strings.Join([]string{``, `v1`, `orders`, `limit`}, `/`),
-		Request: requestbuffer.String(),
-		Type:    `application/json`,
+		Method:  http.MethodGet,
+		Path:    strings.Join([]string{``, `v1`, `account`, currencypair, `tradehistory`}, `/`),
+		Query:   query,
 	})
 
 	if valrresponse.Error != `` {
 
-		err = errors.New(valrresponse.Error)
+		err = valrresponse.Err
 	}
 
 	if valrresponse.Value != `` {
 
-		json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrorderid)
+		if err = json.NewDecoder(bytes.NewBufferString(valrresponse.Value)).Decode(&valrtradehistory); err != nil {
+
+			err = ParseError(err)
+		}
 	}
 
 	return
@@ -779,17 +2085,64 @@ func PostValrLimitOrder(valrkey string, valrsecret string, valrhost string, valr
 
 func BitstampApi(bitstamprequest BitstampRequest) (bitstampresponse BitstampResponse) {
 
+	var tokenbucket *TokenBucket = ApiLimiters.Get(`bitstamp`, bitstamprequest.Host)
+
+	var attempt int = 0
+
+	for attempt = 0; ; attempt++ {
+
+		if err := tokenbucket.Wait(bitstamprequest.Context); err != nil {
+
+			bitstampresponse.Error = err.Error()
+			bitstampresponse.Err = NewApiError(`bitstamp`, bitstamprequest.Method, bitstamprequest.Path, 0, bitstampresponse.Error, true)
+
+			return
+		}
+
+		var apiattempt ApiAttempt
+
+		bitstampresponse, apiattempt = BitstampAttempt(bitstamprequest)
+
+		if !RetryApi(bitstamprequest.Context, `bitstamp`, bitstamprequest.Method, bitstamprequest.Path, bitstamprequest.Order, attempt, apiattempt, tokenbucket) {
+
+			return
+		}
+	}
+}
+
+func BitstampAttempt(bitstamprequest BitstampRequest) (bitstampresponse BitstampResponse, apiattempt ApiAttempt) {
+
 	var err error
 
+	var started time.Time = time.Now()
+
+	defer func() {
+
+		ObserveApiCall(`bitstamp`, bitstamprequest.Method, bitstamprequest.Path, apiattempt.Status, bitstampresponse.Error != ``, time.Since(started))
+	}()
+
 	var requestbuffer *bytes.Buffer = bytes.NewBufferString(bitstamprequest.Request)
 
-	var httpendpoint string = strings.ToLower(strings.Join([]string{`https://`, bitstamprequest.Host, bitstamprequest.Path, bitstamprequest.Query}, ``))
+	var scheme string
+	var host string
+
+	scheme, host = ApiHost(bitstamprequest.Host)
+
+	var httpendpoint string = strings.ToLower(strings.Join([]string{scheme, host, bitstamprequest.Path, bitstamprequest.Query}, ``))
 
 	var httprequest *http.Request
 
-	if httprequest, err = http.NewRequest(bitstamprequest.Method, httpendpoint, requestbuffer); err != nil {
+	var requestcontext context.Context = bitstamprequest.Context
+
+	if requestcontext == nil {
+
+		requestcontext = context.Background()
+	}
+
+	if httprequest, err = http.NewRequestWithContext(requestcontext, bitstamprequest.Method, httpendpoint, requestbuffer); err != nil {
 
 		bitstampresponse.Error = err.Error()
+		bitstampresponse.Err = NewApiError(`bitstamp`, bitstamprequest.Method, bitstamprequest.Path, 0, bitstampresponse.Error, false)
 
 		log.Printf(`Error('%+[1]v')`, bitstampresponse.Error)
 
@@ -832,7 +2185,7 @@ func BitstampApi(bitstamprequest BitstampRequest) (bitstampresponse BitstampResp
 
 	hash.Write([]byte(authorisation))
 	hash.Write([]byte(bitstamprequest.Method))
-	hash.Write([]byte(bitstamprequest.Host))
+	hash.Write([]byte(host))
 	hash.Write([]byte(bitstamprequest.Path))
 	hash.Write([]byte(bitstamprequest.Query))
 	hash.Write([]byte(bitstamprequest.Type))
@@ -843,7 +2196,7 @@ func BitstampApi(bitstamprequest BitstampRequest) (bitstampresponse BitstampResp
 
 	var signature string = strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))
 
-	if version == `v2` {
+	if version == `v2` && bitstamprequest.Key != `` {
 
 		httprequest.Header.Set(`X-Auth`, authorisation)
 		httprequest.Header.Set(`X-Auth-Signature`, signature)
@@ -854,13 +2207,17 @@ func BitstampApi(bitstamprequest BitstampRequest) (bitstampresponse BitstampResp
 
 	//log.Printf(`httprequest:%+[1]v`, httprequest)
 
-	var httpclient *http.Client = new(http.Client)
+	var httpclient *http.Client = ApiClients.Get(`bitstamp`, bitstamprequest.Host)
 
 	var httpresponse *http.Response
 
 	if httpresponse, err = httpclient.Do(httprequest); err != nil {
 
 		bitstampresponse.Error = err.Error()
+		bitstampresponse.Err = NewApiError(`bitstamp`, bitstamprequest.Method, bitstamprequest.Path, 0, bitstampresponse.Error, true)
+		bitstampresponse.Uncertain = true
+
+		apiattempt.Transport = true
 
 		log.Printf(`Error('%+[1]v')`, bitstampresponse.Error)
 
@@ -869,6 +2226,9 @@ func BitstampApi(bitstamprequest BitstampRequest) (bitstampresponse BitstampResp
 
 	//log.Printf(`httpresponse: %+[1]v`, httpresponse)
 
+	apiattempt.Status = httpresponse.StatusCode
+	apiattempt.RetryAfter = ParseRetryAfter(httpresponse.Header.Get(`Retry-After`), time.Now())
+
 	defer httpresponse.Body.Close()
 
 	var responsebuffer *bytes.Buffer = new(bytes.Buffer)
@@ -877,9 +2237,15 @@ func BitstampApi(bitstamprequest BitstampRequest) (bitstampresponse BitstampResp
 
 	//log.Printf(`responsebuffer: %+[1]v`, responsebuffer.String())
 
-	if httpresponse.StatusCode != 200 && httpresponse.StatusCode != 202 {
+	var bitstamperror BitstampError
+
+	json.Unmarshal(responsebuffer.Bytes(), &bitstamperror)
+
+	if httpresponse.StatusCode != 200 && httpresponse.StatusCode != 202 || bitstamperror.Status == `error` {
 
 		bitstampresponse.Error = responsebuffer.String()
+		bitstampresponse.Err = NewApiError(`bitstamp`, bitstamprequest.Method, bitstamprequest.Path, httpresponse.StatusCode, bitstampresponse.Error, false)
+		bitstampresponse.Uncertain = httpresponse.StatusCode >= 500
 
 		log.Printf(`Error('%+[1]v')`, bitstampresponse.Error)
 
@@ -893,17 +2259,64 @@ func BitstampApi(bitstamprequest BitstampRequest) (bitstampresponse BitstampResp
 
 func ValrApi(valrrequest ValrRequest) (valrresponse ValrResponse) {
 
+	var tokenbucket *TokenBucket = ApiLimiters.Get(`valr`, valrrequest.Host)
+
+	var attempt int = 0
+
+	for attempt = 0; ; attempt++ {
+
+		if err := tokenbucket.Wait(valrrequest.Context); err != nil {
+
+			valrresponse.Error = err.Error()
+			valrresponse.Err = NewApiError(`valr`, valrrequest.Method, valrrequest.Path, 0, valrresponse.Error, true)
+
+			return
+		}
+
+		var apiattempt ApiAttempt
+
+		valrresponse, apiattempt = ValrAttempt(valrrequest)
+
+		if !RetryApi(valrrequest.Context, `valr`, valrrequest.Method, valrrequest.Path, valrrequest.Order, attempt, apiattempt, tokenbucket) {
+
+			return
+		}
+	}
+}
+
+func ValrAttempt(valrrequest ValrRequest) (valrresponse ValrResponse, apiattempt ApiAttempt) {
+
 	var err error
 
+	var started time.Time = time.Now()
+
+	defer func() {
+
+		ObserveApiCall(`valr`, valrrequest.Method, valrrequest.Path, apiattempt.Status, valrresponse.Error != ``, time.Since(started))
+	}()
+
 	var requestbuffer *bytes.Buffer = bytes.NewBufferString(valrrequest.Request)
 
-	var httpendpoint string = strings.ToLower(strings.Join([]string{`https://`, valrrequest.Host, valrrequest.Path, valrrequest.Query}, ``))
+	var scheme string
+	var host string
+
+	scheme, host = ApiHost(valrrequest.Host)
+
+	var httpendpoint string = strings.ToLower(strings.Join([]string{scheme, host, valrrequest.Path, valrrequest.Query}, ``))
 
 	var httprequest *http.Request
 
-	if httprequest, err = http.NewRequest(valrrequest.Method, httpendpoint, requestbuffer); err != nil {
+	var requestcontext context.Context = valrrequest.Context
+
+	if requestcontext == nil {
+
+		requestcontext = context.Background()
+	}
+
+	if httprequest, err = http.NewRequestWithContext(requestcontext, valrrequest.Method, httpendpoint, requestbuffer); err != nil {
 
 		valrresponse.Error = err.Error()
+		valrresponse.Err = NewApiError(`valr`, valrrequest.Method, valrrequest.Path, 0, valrresponse.Error, false)
 
 		log.Printf(`Error('%+[1]v')`, valrresponse.Error)
 
@@ -919,14 +2332,7 @@ func ValrApi(valrrequest ValrRequest) (valrresponse ValrResponse) {
 
 	var timestamp string = strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
 
-	var hash hash.Hash = hmac.New(sha512.New, []byte(valrrequest.Secret))
-
-	hash.Write([]byte(timestamp))
-	hash.Write([]byte(valrrequest.Method))
-	hash.Write([]byte(valrrequest.Path))
-	hash.Write(requestbuffer.Bytes())
-
-	var signature string = hex.EncodeToString(hash.Sum(nil))
+	var signature string = ValrSignature(valrrequest.Secret, timestamp, valrrequest.Method, httprequest.URL.RequestURI(), requestbuffer.Bytes())
 
 	httprequest.Header.Set(`X-VALR-API-KEY`, valrrequest.Key)
 	httprequest.Header.Set(`X-VALR-SIGNATURE`, signature)
@@ -934,13 +2340,17 @@ func ValrApi(valrrequest ValrRequest) (valrresponse ValrResponse) {
 
 	//log.Printf(`httprequest:%+[1]v`, httprequest)
 
-	var httpclient *http.Client = new(http.Client)
+	var httpclient *http.Client = ApiClients.Get(`valr`, valrrequest.Host)
 
 	var httpresponse *http.Response
 
 	if httpresponse, err = httpclient.Do(httprequest); err != nil {
 
 		valrresponse.Error = err.Error()
+		valrresponse.Err = NewApiError(`valr`, valrrequest.Method, valrrequest.Path, 0, valrresponse.Error, true)
+		valrresponse.Uncertain = true
+
+		apiattempt.Transport = true
 
 		log.Printf(`Error('%+[1]v')`, valrresponse.Error)
 
@@ -949,6 +2359,9 @@ func ValrApi(valrrequest ValrRequest) (valrresponse ValrResponse) {
 
 	//log.Printf(`httpresponse: %+[1]v`, httpresponse)
 
+	apiattempt.Status = httpresponse.StatusCode
+	apiattempt.RetryAfter = ParseRetryAfter(httpresponse.Header.Get(`Retry-After`), time.Now())
+
 	defer httpresponse.Body.Close()
 
 	var responsebuffer *bytes.Buffer = new(bytes.Buffer)
@@ -960,6 +2373,8 @@ func ValrApi(valrrequest ValrRequest) (valrresponse ValrResponse) {
 	if httpresponse.StatusCode != 200 && httpresponse.StatusCode != 202 {
 
 		valrresponse.Error = responsebuffer.String()
+		valrresponse.Err = NewApiError(`valr`, valrrequest.Method, valrrequest.Path, httpresponse.StatusCode, valrresponse.Error, false)
+		valrresponse.Uncertain = httpresponse.StatusCode >= 500
 
 		log.Printf(`Error('%+[1]v')`, valrresponse.Error)
 
@@ -971,12 +2386,90 @@ func ValrApi(valrrequest ValrRequest) (valrresponse ValrResponse) {
 	return
 }
 
+func ValrSignature(valrsecret string, timestamp string, method string, path string, body []byte) string {
+
+	var hash hash.Hash = hmac.New(sha512.New, []byte(valrsecret))
+
+	hash.Write([]byte(timestamp))
+	hash.Write([]byte(method))
+	hash.Write([]byte(path))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
 const (
 	Undefined = 0
 	Bid       = 1
 	Ask       = 2
 )
 
+type CycleSummary struct {
+	Cycle         int
+	Accounts      int
+	Evaluated     int
+	Opportunities int
+	Executed      int
+	Simulated     int
+	Unhedged      int
+	Errors        int
+	Elapsed       time.Duration
+}
+
+type WatchedFile struct {
+	Name    string
+	ModTime time.Time
+	Size    int64
+	Content []byte
+}
+
+type ArbitrageRequest struct {
+	Account      string
+	BuyExchange  Exchange
+	SellExchange Exchange
+	BuyLimit     Decimal
+	LimitRate    Decimal
+	ExchangeRate Decimal
+	BuyFee       float64
+	SellFee      float64
+	ProfitMargin float64
+	ScaleDown    float64
+	ExecuteTrade bool
+	Paper        bool
+	HedgeConfig  HedgeConfig
+}
+
+type ArbitrageResponse struct {
+	Evaluation      Evaluation
+	ArbitrageId     string
+	Executed        bool
+	Paper           bool
+	BuyQuoteBalance Decimal
+	SellBaseBalance Decimal
+	Buyable         Depth
+	Sellable        Depth
+	BuyOrderStatus  OrderStatus
+	SellOrderStatus OrderStatus
+	Hedge           Hedge
+}
+
+type Evaluation struct {
+	BuyTradeable  Trade
+	SellTradeable Trade
+	BuyTrade      Trade
+	SellTrade     Trade
+	GrossPercent  float64
+	NetPercent    float64
+	GrossBase     Decimal
+	NetBase       Decimal
+	GrossQuote    Decimal
+	NetQuote      Decimal
+	BuyShortfall  Decimal
+	SellShortfall Decimal
+	Scaled        bool
+	Opportunity   bool
+}
+
 type Depth struct {
 	Type          int
 	BaseCurrency  string
@@ -985,22 +2478,24 @@ type Depth struct {
 }
 
 type Level struct {
-	BaseAmount     float64
-	BaseAhead      float64
-	BaseTotal      float64
-	QuoteAmount    float64
-	NotionalAmount float64
-	NotionalAhead  float64
-	NotionalTotal  float64
+	BaseAmount     Decimal
+	BaseAhead      Decimal
+	BaseTotal      Decimal
+	QuoteAmount    Decimal
+	NotionalAmount Decimal
+	NotionalAhead  Decimal
+	NotionalTotal  Decimal
 }
 
 type Trade struct {
-	BaseAmount     float64
-	QuoteAmount    float64
-	NotionalAmount float64
+	BaseAmount     Decimal
+	QuoteAmount    Decimal
+	NotionalAmount Decimal
+	Shortfall      Decimal
 }
 
 type BitstampRequest struct {
+	Context  context.Context
 	Key      string
 	Secret   string
 	Customer string
@@ -1010,14 +2505,18 @@ type BitstampRequest struct {
 	Query    string
 	Request  string
 	Type     string
+	Order    bool
 }
 
 type BitstampResponse struct {
-	Value string
-	Error string
+	Value     string
+	Error     string
+	Err       error
+	Uncertain bool
 }
 
 type ValrRequest struct {
+	Context context.Context
 	Key     string
 	Secret  string
 	Host    string
@@ -1026,11 +2525,19 @@ type ValrRequest struct {
 	Query   string
 	Request string
 	Type    string
+	Order   bool
 }
 
 type ValrResponse struct {
-	Value string
-	Error string
+	Value     string
+	Error     string
+	Err       error
+	Uncertain bool
+}
+
+type BitstampError struct {
+	Status string          `json:"status"`
+	Reason json.RawMessage `json:"reason"`
 }
 
 type BitstampBalance struct {
@@ -1049,6 +2556,31 @@ type BitstampOrder struct {
 	ClientOrderId string `json:"client_order_id"`
 }
 
+type BitstampCancelAll struct {
+	Canceled []BitstampCancelledOrder `json:"canceled"`
+	Success  bool                     `json:"success"`
+}
+
+type BitstampCancelledOrder struct {
+	Id           int64  `json:"id"`
+	Amount       string `json:"amount"`
+	Price        string `json:"price"`
+	Type         int    `json:"type"`
+	CurrencyPair string `json:"currency_pair"`
+}
+
+type BitstampOpenOrder struct {
+	Id             string `json:"id"`
+	DateTime       string `json:"datetime"`
+	Type           string `json:"type"`
+	Price          string `json:"price"`
+	Amount         string `json:"amount"`
+	AmountAtCreate string `json:"amount_at_create"`
+	CurrencyPair   string `json:"currency_pair"`
+	Market         string `json:"market"`
+	ClientOrderId  string `json:"client_order_id"`
+}
+
 type BitstampOrderBook struct {
 	Timestamp      string     `json:"timestamp"`
 	Microtimestamp string     `json:"microtimestamp"`
@@ -1064,6 +2596,15 @@ type BitstampOrderStatus struct {
 	ClientOrderId   string                `json:"client_order_id"`
 }
 
+type BitstampTradingFee struct {
+	CurrencyPair string `json:"currency_pair"`
+	Market       string `json:"market"`
+	Fees         struct {
+		Maker string `json:"maker"`
+		Taker string `json:"taker"`
+	} `json:"fees"`
+}
+
 type BitstampTransaction struct {
 	Tid      string `json:"tid"`
 	Usd      string `json:"usd"`
@@ -1074,6 +2615,15 @@ type BitstampTransaction struct {
 	Type     string `json:"type"`
 }
 
+type BitstampUserTransaction struct {
+	Id       int64
+	DateTime string
+	Type     string
+	Fee      string
+	OrderId  int64
+	Amounts  map[string]string
+}
+
 type ValrBalance struct {
 	Currency  string `json:"currency"`
 	Available string `json:"available"`
@@ -1082,6 +2632,12 @@ type ValrBalance struct {
 	UpdatedAt string `json:"updatedAt"`
 }
 
+type ValrTradeFee struct {
+	CurrencyPair    string  `json:"currencyPair"`
+	MakerPercentage float64 `json:"makerPercentage"`
+	TakerPercentage float64 `json:"takerPercentage"`
+}
+
 type ValrLimitOrder struct {
 	Side            string `json:"side"`
 	Quantity        string `json:"quantity"`
@@ -1092,6 +2648,99 @@ type ValrLimitOrder struct {
 	TimeInForce     string `json:"timeInForce"`
 }
 
+type ValrCancelOrder struct {
+	OrderId         string `json:"orderId,omitempty"`
+	CustomerOrderId string `json:"customerOrderId,omitempty"`
+	Pair            string `json:"pair"`
+}
+
+type ValrMarketOrder struct {
+	Side            string `json:"side"`
+	Pair            string `json:"pair"`
+	BaseAmount      string `json:"baseAmount,omitempty"`
+	QuoteAmount     string `json:"quoteAmount,omitempty"`
+	CustomerOrderId string `json:"customerOrderId,omitempty"`
+}
+
+type ValrBatchOrders struct {
+	Requests []ValrBatchOrder `json:"requests"`
+}
+
+type ValrBatchOrder struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+type ValrBatchResponse struct {
+	BatchId  int64              `json:"batchId"`
+	Outcomes []ValrBatchOutcome `json:"outcomes"`
+}
+
+type ValrBatchOutcome struct {
+	Accepted        bool   `json:"accepted"`
+	OrderId         string `json:"orderId"`
+	CustomerOrderId string `json:"customerOrderId"`
+	Error           struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type ValrCancelledOrder struct {
+	OrderId         string `json:"orderId"`
+	CustomerOrderId string `json:"customerOrderId"`
+}
+
+type ValrOpenOrder struct {
+	OrderId           string `json:"orderId"`
+	Side              string `json:"side"`
+	RemainingQuantity string `json:"remainingQuantity"`
+	Price             string `json:"price"`
+	CurrencyPair      string `json:"currencyPair"`
+	CreatedAt         string `json:"createdAt"`
+	OriginalQuantity  string `json:"originalQuantity"`
+	FilledPercentage  string `json:"filledPercentage"`
+	CustomerOrderId   string `json:"customerOrderId"`
+	UpdatedAt         string `json:"updatedAt"`
+	Status            string `json:"status"`
+	Type              string `json:"type"`
+	TimeInForce       string `json:"timeInForce"`
+}
+
+type ValrOrderHistory struct {
+	OrderId           string `json:"orderId"`
+	CustomerOrderId   string `json:"customerOrderId"`
+	OrderStatusType   string `json:"orderStatusType"`
+	CurrencyPair      string `json:"currencyPair"`
+	AveragePrice      string `json:"averagePrice"`
+	OriginalPrice     string `json:"originalPrice"`
+	RemainingQuantity string `json:"remainingQuantity"`
+	OriginalQuantity  string `json:"originalQuantity"`
+	Total             string `json:"total"`
+	TotalFee          string `json:"totalFee"`
+	FeeCurrency       string `json:"feeCurrency"`
+	OrderSide         string `json:"orderSide"`
+	OrderType         string `json:"orderType"`
+	FailedReason      string `json:"failedReason"`
+	OrderUpdatedAt    string `json:"orderUpdatedAt"`
+	OrderCreatedAt    string `json:"orderCreatedAt"`
+	TimeInForce       string `json:"timeInForce"`
+}
+
+type ValrTrade struct {
+	Id              string `json:"id"`
+	OrderId         string `json:"orderId"`
+	CustomerOrderId string `json:"customerOrderId"`
+	Price           string `json:"price"`
+	Quantity        string `json:"quantity"`
+	CurrencyPair    string `json:"currencyPair"`
+	TradedAt        string `json:"tradedAt"`
+	Side            string `json:"side"`
+	SequenceId      int64  `json:"sequenceId"`
+	Fee             string `json:"fee"`
+	FeeCurrency     string `json:"feeCurrency"`
+}
+
 type ValrOrder struct {
 	Side         string `json:"side"`
 	Quantity     string `json:"quantity"`
@@ -1114,9 +2763,13 @@ type ValrOrderStatus struct {
 	OrderId           string `json:"orderId"`
 	OrderStatusType   string `json:"orderStatusType"`
 	CurrencyPair      string `json:"currencyPair"`
+	AveragePrice      string `json:"averagePrice"`
 	OriginalPrice     string `json:"originalPrice"`
 	RemainingQuantity string `json:"remainingQuantity"`
 	OriginalQuantity  string `json:"originalQuantity"`
+	Total             string `json:"total"`
+	TotalFee          string `json:"totalFee"`
+	FeeCurrency       string `json:"feeCurrency"`
 	OrderSide         string `json:"orderSide"`
 	OrderType         string `json:"orderType"`
 	FailedReason      string `json:"failedReason"`
@@ -0,0 +1,1319 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const PropertySeed int64 = 1
+
+const PropertyIterations int = 1000
+
+type TradeCase struct {
+	Name     string
+	Levels   [][]string
+	Notional string
+	Want     Trade
+}
+
+type ProfitCase struct {
+	Name     string
+	Buy      string
+	Sell     string
+	Want     float64
+	Accuracy float64
+}
+
+type EvaluationCase struct {
+	Name            string
+	Asks            [][]string
+	Bids            [][]string
+	Limit           string
+	Rate            string
+	ScaleDown       float64
+	WantOpportunity bool
+	WantScaled      bool
+	WantNotional    string
+	WantShortfall   string
+}
+
+type FeeCase struct {
+	Name            string
+	FeeInQuote      bool
+	QuoteBalance    string
+	WantOpportunity bool
+	WantBuyPrice    string
+	WantSellPrice   string
+}
+
+type HedgeCase struct {
+	Name         string
+	Reverse      bool
+	BuyFilled    string
+	SellFilled   string
+	WantState    string
+	WantResidual string
+}
+
+type LedgerQueryCase struct {
+	Name    string
+	Account string
+	From    string
+	To      string
+	Want    []int
+}
+
+type SimulateFillCase struct {
+	Name         string
+	Side         string
+	Levels       [][]string
+	BaseAmount   string
+	Price        string
+	WantFilled   string
+	WantNotional string
+}
+
+var TradeCases []TradeCase = []TradeCase{
+	{
+		Name:     `empty depth`,
+		Levels:   [][]string{},
+		Notional: `100`,
+		Want:     Trade{Shortfall: MustParseDecimal(`100`)},
+	},
+	{
+		Name:     `zero notional`,
+		Levels:   [][]string{{`100`, `1`}},
+		Notional: `0`,
+		Want:     Trade{},
+	},
+	{
+		Name:     `partial first level`,
+		Levels:   [][]string{{`100`, `2`}, {`110`, `1`}},
+		Notional: `50`,
+		Want:     Trade{BaseAmount: MustParseDecimal(`0.5`), QuoteAmount: MustParseDecimal(`100`), NotionalAmount: MustParseDecimal(`50`)},
+	},
+	{
+		Name:     `partial second level`,
+		Levels:   [][]string{{`100`, `1`}, {`110`, `1`}, {`120`, `1`}},
+		Notional: `155`,
+		Want:     Trade{BaseAmount: MustParseDecimal(`1.5`), QuoteAmount: MustParseDecimal(`110`), NotionalAmount: MustParseDecimal(`155`)},
+	},
+	{
+		Name:     `notional on a level boundary`,
+		Levels:   [][]string{{`100`, `1`}, {`110`, `1`}},
+		Notional: `100`,
+		Want:     Trade{BaseAmount: MustParseDecimal(`1`), QuoteAmount: MustParseDecimal(`110`), NotionalAmount: MustParseDecimal(`100`)},
+	},
+	{
+		Name:     `base rounded to 8 places`,
+		Levels:   [][]string{{`3`, `1`}},
+		Notional: `1`,
+		Want:     Trade{BaseAmount: MustParseDecimal(`0.33333333`), QuoteAmount: MustParseDecimal(`3`), NotionalAmount: MustParseDecimal(`1`)},
+	},
+	{
+		Name:     `level notional rounded to cents`,
+		Levels:   [][]string{{`60000.5`, `0.00000333`}, {`60001`, `1`}},
+		Notional: `100`,
+		Want:     Trade{BaseAmount: MustParseDecimal(`0.00166663`), QuoteAmount: MustParseDecimal(`60001`), NotionalAmount: MustParseDecimal(`100`)},
+	},
+	{
+		Name:     `insufficient depth`,
+		Levels:   [][]string{{`100`, `1`}, {`110`, `1`}},
+		Notional: `500`,
+		Want:     Trade{BaseAmount: MustParseDecimal(`2`), QuoteAmount: MustParseDecimal(`110`), NotionalAmount: MustParseDecimal(`210`), Shortfall: MustParseDecimal(`290`)},
+	},
+	{
+		Name:     `notional equal to the whole book`,
+		Levels:   [][]string{{`100`, `1`}, {`110`, `1`}},
+		Notional: `210`,
+		Want:     Trade{BaseAmount: MustParseDecimal(`2`), QuoteAmount: MustParseDecimal(`110`), NotionalAmount: MustParseDecimal(`210`)},
+	},
+	{
+		Name:     `bid side`,
+		Levels:   [][]string{{`1300000`, `0.001`}, {`1299000`, `1`}},
+		Notional: `1818.18`,
+		Want:     Trade{BaseAmount: MustParseDecimal(`0.00139890`), QuoteAmount: MustParseDecimal(`1299000`), NotionalAmount: MustParseDecimal(`1818.18`)},
+	},
+}
+
+var ProfitCases []ProfitCase = []ProfitCase{
+	{Name: `profit`, Buy: `1`, Sell: `0.99`, Want: 0.01},
+	{Name: `break even`, Buy: `0.5`, Sell: `0.5`, Want: 0},
+	{Name: `loss`, Buy: `1`, Sell: `1.02`, Want: -0.02},
+	{Name: `small amounts`, Buy: `0.00166656`, Sell: `0.00139860`, Want: 0.16078629032258066, Accuracy: 1e-15},
+	{Name: `sell nothing`, Buy: `2`, Sell: `0`, Want: 1},
+	{Name: `buy nothing`, Buy: `0`, Sell: `0.5`, Want: 0},
+	{Name: `negative buy`, Buy: `-1`, Sell: `0.5`, Want: 0},
+}
+
+var EvaluationCases []EvaluationCase = []EvaluationCase{
+	{
+		Name:          `buy shortfall skipped`,
+		Asks:          [][]string{{`60000`, `0.001`}},
+		Bids:          [][]string{{`1300000`, `1`}},
+		Limit:         `100`,
+		Rate:          `18.18`,
+		WantNotional:  `0`,
+		WantShortfall: `40`,
+	},
+	{
+		Name:            `buy shortfall scaled down`,
+		Asks:            [][]string{{`60000`, `0.001`}},
+		Bids:            [][]string{{`1300000`, `1`}},
+		Limit:           `100`,
+		Rate:            `18.18`,
+		ScaleDown:       0.5,
+		WantOpportunity: true,
+		WantScaled:      true,
+		WantNotional:    `60`,
+		WantShortfall:   `40`,
+	},
+	{
+		Name:          `buy shortfall below scaledown`,
+		Asks:          [][]string{{`60000`, `0.001`}},
+		Bids:          [][]string{{`1300000`, `1`}},
+		Limit:         `100`,
+		Rate:          `18.18`,
+		ScaleDown:     0.7,
+		WantNotional:  `0`,
+		WantShortfall: `40`,
+	},
+	{
+		Name:            `sell shortfall scaled down`,
+		Asks:            [][]string{{`60000`, `1`}},
+		Bids:            [][]string{{`1300000`, `0.0005`}},
+		Limit:           `100`,
+		Rate:            `18.18`,
+		ScaleDown:       0.25,
+		WantOpportunity: true,
+		WantScaled:      true,
+		WantNotional:    `35.75`,
+		WantShortfall:   `0`,
+	},
+	{
+		Name:            `enough liquidity`,
+		Asks:            [][]string{{`60000`, `1`}},
+		Bids:            [][]string{{`1300000`, `1`}},
+		Limit:           `100`,
+		Rate:            `18.18`,
+		ScaleDown:       0.5,
+		WantOpportunity: true,
+		WantNotional:    `100`,
+		WantShortfall:   `0`,
+	},
+}
+
+var FeeCases []FeeCase = []FeeCase{
+	{Name: `buy fee in quote`, FeeInQuote: true, QuoteBalance: `1000`, WantOpportunity: true, WantBuyPrice: `70447`, WantSellPrice: `1107222`},
+	{Name: `buy fee in base`, FeeInQuote: false, QuoteBalance: `1000`, WantOpportunity: true, WantBuyPrice: `70445`, WantSellPrice: `1107240`},
+	{Name: `buy fee in quote exceeds balance`, FeeInQuote: true, QuoteBalance: `100`},
+	{Name: `buy fee in base within balance`, FeeInQuote: false, QuoteBalance: `100`, WantOpportunity: true, WantBuyPrice: `70445`, WantSellPrice: `1107240`},
+}
+
+var HedgeCases []HedgeCase = []HedgeCase{
+	{Name: `forward filled`, BuyFilled: `0.02`, SellFilled: `0.018`, WantState: HedgeBalanced, WantResidual: `0`},
+	{Name: `reverse filled`, Reverse: true, BuyFilled: `0.02`, SellFilled: `0.018`, WantState: HedgeBalanced, WantResidual: `0`},
+	{Name: `forward sell partial`, BuyFilled: `0.02`, SellFilled: `0.01`, WantState: HedgeAlerted, WantResidual: `0.008`},
+	{Name: `forward buy partial`, BuyFilled: `0.01`, SellFilled: `0.018`, WantState: HedgeAlerted, WantResidual: `-0.01`},
+	{Name: `reverse buy partial net of base fee`, Reverse: true, BuyFilled: `0.01`, SellFilled: `0.018`, WantState: HedgeAlerted, WantResidual: `-0.00999`},
+}
+
+var LedgerQueryEntries []LedgerEntry = []LedgerEntry{
+	{Time: time.Date(2026, 10, 15, 23, 59, 0, 0, time.UTC), Account: `first`},
+	{Time: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), Account: `first`},
+	{Time: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), Account: `second`},
+	{Time: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), Account: `first`},
+}
+
+var LedgerQueryCases []LedgerQueryCase = []LedgerQueryCase{
+	{Name: `everything`, Want: []int{0, 1, 2, 3}},
+	{Name: `one day`, From: `2026-10-16`, To: `2026-10-16`, Want: []int{1, 2}},
+	{Name: `one day one account`, Account: `first`, From: `2026-10-16`, To: `2026-10-16`, Want: []int{1}},
+	{Name: `exclusive instant`, From: `2026-10-16`, To: `2026-10-16T12:00:00Z`, Want: []int{1}},
+	{Name: `open start`, To: `2026-10-15`, Want: []int{0}},
+	{Name: `open end`, From: `2026-10-16T12:00:00Z`, Want: []int{2, 3}},
+	{Name: `empty range`, From: `2026-10-18`, Want: []int{}},
+}
+
+var ReportEntries []LedgerEntry = []LedgerEntry{
+	{
+		Account:      `first`,
+		BuySymbol:    `btcusd`,
+		SellSymbol:   `btczar`,
+		ExchangeRate: MustParseDecimal(`18`),
+		ProfitMargin: 0.5,
+		Opportunity:  true,
+		Executed:     true,
+		NetPercent:   1,
+		HedgeState:   HedgeBalanced,
+		Realised:     MustParseDecimal(`90`),
+		RealisedIn:   `zar`,
+		Orders: []LedgerOrder{
+			{Leg: `buy`, Symbol: `btcusd`, BaseAmount: MustParseDecimal(`0.02`), BaseFilled: MustParseDecimal(`0.02`), Notional: MustParseDecimal(`1000`), Fee: MustParseDecimal(`4`), FeeCurrency: `usd`},
+			{Leg: `sell`, Symbol: `btczar`, BaseAmount: MustParseDecimal(`0.018`), BaseFilled: MustParseDecimal(`0.018`), Notional: MustParseDecimal(`19000`), Fee: MustParseDecimal(`19`), FeeCurrency: `zar`},
+		},
+	},
+	{Account: `first`, BuySymbol: `btcusd`, SellSymbol: `btczar`, RealisedIn: `zar`},
+	{Account: `first`, Paper: true, Executed: true, Realised: MustParseDecimal(`1000`), RealisedIn: `zar`},
+	{
+		Account:           `second`,
+		BuySymbol:         `btcusd`,
+		SellSymbol:        `btczar`,
+		ExchangeRate:      MustParseDecimal(`18`),
+		ProfitMargin:      0.5,
+		Opportunity:       true,
+		Executed:          true,
+		NetPercent:        2,
+		HedgeState:        HedgeAlerted,
+		EstimatedRealised: DecimalPointer(MustParseDecimal(`36`)),
+		RealisedIn:        `zar`,
+		Orders: []LedgerOrder{
+			{Leg: `buy`, Symbol: `btcusd`, BaseAmount: MustParseDecimal(`0.02`), BaseFilled: MustParseDecimal(`0.01`), Notional: MustParseDecimal(`500`), Fee: MustParseDecimal(`2`), FeeCurrency: `usd`},
+			{Leg: `sell`, Symbol: `btczar`, BaseAmount: MustParseDecimal(`0.018`), BaseFilled: MustParseDecimal(`0.018`), Notional: MustParseDecimal(`19000`), Fee: MustParseDecimal(`19`), FeeCurrency: `zar`},
+		},
+	},
+}
+
+var SimulateFillCases []SimulateFillCase = []SimulateFillCase{
+	{Name: `empty depth`, Side: Buy, Levels: [][]string{}, BaseAmount: `1`, Price: `100`, WantFilled: `0`, WantNotional: `0`},
+	{Name: `buy within limit`, Side: Buy, Levels: [][]string{{`100`, `1`}, {`110`, `1`}}, BaseAmount: `1.5`, Price: `110`, WantFilled: `1.5`, WantNotional: `155`},
+	{Name: `buy limit cuts off second level`, Side: Buy, Levels: [][]string{{`100`, `1`}, {`110`, `1`}}, BaseAmount: `1.5`, Price: `105`, WantFilled: `1`, WantNotional: `100`},
+	{Name: `buy limit below best ask`, Side: Buy, Levels: [][]string{{`100`, `1`}}, BaseAmount: `1`, Price: `99`, WantFilled: `0`, WantNotional: `0`},
+	{Name: `buy exhausts depth`, Side: Buy, Levels: [][]string{{`100`, `0.25`}, {`101`, `0.25`}}, BaseAmount: `1`, Price: `200`, WantFilled: `0.5`, WantNotional: `50.25`},
+	{Name: `sell limit cuts off second level`, Side: Sell, Levels: [][]string{{`100`, `1`}, {`90`, `2`}}, BaseAmount: `2`, Price: `95`, WantFilled: `1`, WantNotional: `100`},
+	{Name: `sell limit above best bid`, Side: Sell, Levels: [][]string{{`100`, `1`}}, BaseAmount: `1`, Price: `101`, WantFilled: `0`, WantNotional: `0`},
+	{Name: `sell exhausts depth`, Side: Sell, Levels: [][]string{{`100`, `1`}, {`90`, `0.5`}}, BaseAmount: `2`, Price: `80`, WantFilled: `1.5`, WantNotional: `145`},
+	{Name: `sell stops at amount`, Side: Sell, Levels: [][]string{{`100`, `1`}, {`90`, `2`}}, BaseAmount: `0.4`, Price: `80`, WantFilled: `0.4`, WantNotional: `40`},
+}
+
+const EcbDocument string = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender><gesmes:name>European Central Bank</gesmes:name></gesmes:Sender>
+	<Cube>
+		<Cube time="2026-10-16"><Cube currency="USD" rate="%[1]v"/><Cube currency="ZAR" rate="20.5"/></Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+type UncertainExchange struct {
+	Exchange
+	Posts      int
+	Lookups    int
+	FoundAfter int
+}
+
+func (uncertainexchange *UncertainExchange) Name() string {
+
+	return `uncertain`
+}
+
+func (uncertainexchange *UncertainExchange) PostLimitOrder(ctx context.Context, order Order) (orderid string, err error) {
+
+	uncertainexchange.Posts += 1
+
+	err = fmt.Errorf(`%[1]w: timeout`, ErrOrderUncertain)
+
+	return
+}
+
+func (uncertainexchange *UncertainExchange) GetOrderStatusByClientOrderId(ctx context.Context, clientorderid string) (orderstatus OrderStatus, err error) {
+
+	uncertainexchange.Lookups += 1
+
+	if uncertainexchange.FoundAfter > 0 && uncertainexchange.Lookups >= uncertainexchange.FoundAfter {
+
+		orderstatus = OrderStatus{Id: `42`, ClientOrderId: clientorderid}
+
+		return
+	}
+
+	err = ErrOrderNotFound
+
+	return
+}
+
+func CaseDepth(levels [][]string) (depth Depth) {
+
+	depth = Depth{Levels: []Level{}}
+
+	var levelindex int = 0
+	var levellength int = len(levels)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		depth.Levels = append(depth.Levels, Level{
+			QuoteAmount: MustParseDecimal(levels[levelindex][0]),
+			BaseAmount:  MustParseDecimal(levels[levelindex][1]),
+		})
+	}
+
+	return
+}
+
+func SameTrade(first Trade, second Trade) bool {
+
+	return first.BaseAmount.Equal(second.BaseAmount) && first.QuoteAmount.Equal(second.QuoteAmount) && first.NotionalAmount.Equal(second.NotionalAmount) && first.Shortfall.Equal(second.Shortfall)
+}
+
+func TestCalculateTrade(t *testing.T) {
+
+	var caseindex int = 0
+	var caselength int = len(TradeCases)
+
+	for caseindex = 0; caseindex < caselength; caseindex++ {
+
+		var tradecase TradeCase = TradeCases[caseindex]
+
+		var trade Trade = CalculateTrade(CaseDepth(tradecase.Levels), MustParseDecimal(tradecase.Notional))
+
+		if !SameTrade(trade, tradecase.Want) {
+
+			t.Errorf(`%[1]v: got %+[2]v, want %+[3]v`, tradecase.Name, trade, tradecase.Want)
+		}
+	}
+}
+
+func TestCalculateProfit(t *testing.T) {
+
+	var caseindex int = 0
+	var caselength int = len(ProfitCases)
+
+	for caseindex = 0; caseindex < caselength; caseindex++ {
+
+		var profitcase ProfitCase = ProfitCases[caseindex]
+
+		var profit float64 = CalculateProfit(MustParseDecimal(profitcase.Buy), MustParseDecimal(profitcase.Sell))
+
+		var difference float64 = profit - profitcase.Want
+
+		if difference > profitcase.Accuracy || -difference > profitcase.Accuracy {
+
+			t.Errorf(`%[1]v: got %[2]v, want %[3]v`, profitcase.Name, profit, profitcase.Want)
+		}
+	}
+}
+
+func TestEvaluateArbitrageShortfall(t *testing.T) {
+
+	var caseindex int = 0
+	var caselength int = len(EvaluationCases)
+
+	for caseindex = 0; caseindex < caselength; caseindex++ {
+
+		var evaluationcase EvaluationCase = EvaluationCases[caseindex]
+
+		var arbitragerequest ArbitrageRequest = ArbitrageRequest{
+			BuyExchange:  &BitstampExchange{CurrencyPair: BitstampBtcUsd},
+			SellExchange: &ValrExchange{CurrencyPair: ValrBtcZar},
+			BuyLimit:     MustParseDecimal(evaluationcase.Limit),
+			ExchangeRate: MustParseDecimal(evaluationcase.Rate),
+			ScaleDown:    evaluationcase.ScaleDown,
+		}
+
+		var evaluation Evaluation = EvaluateArbitrage(arbitragerequest, CaseDepth(evaluationcase.Asks), CaseDepth(evaluationcase.Bids), MustParseDecimal(`1000000`), MustParseDecimal(`100`))
+
+		if evaluation.Opportunity != evaluationcase.WantOpportunity || evaluation.Scaled != evaluationcase.WantScaled {
+
+			t.Errorf(`%[1]v: opportunity %[2]v scaled %[3]v, want %[4]v %[5]v`, evaluationcase.Name, evaluation.Opportunity, evaluation.Scaled, evaluationcase.WantOpportunity, evaluationcase.WantScaled)
+		}
+
+		if !evaluation.BuyTrade.NotionalAmount.Equal(MustParseDecimal(evaluationcase.WantNotional)) {
+
+			t.Errorf(`%[1]v: buy notional %[2]v, want %[3]v`, evaluationcase.Name, evaluation.BuyTrade.NotionalAmount, evaluationcase.WantNotional)
+		}
+
+		if !evaluation.BuyShortfall.Equal(MustParseDecimal(evaluationcase.WantShortfall)) {
+
+			t.Errorf(`%[1]v: buy shortfall %[2]v, want %[3]v`, evaluationcase.Name, evaluation.BuyShortfall, evaluationcase.WantShortfall)
+		}
+
+		if evaluation.Opportunity && (evaluation.BuyTradeable.Shortfall.Sign() != 0 || evaluation.SellTradeable.Shortfall.Sign() != 0) {
+
+			t.Errorf(`%[1]v: scaled trades still short: buy %[2]v sell %[3]v`, evaluationcase.Name, evaluation.BuyTradeable.Shortfall, evaluation.SellTradeable.Shortfall)
+		}
+	}
+}
+
+func TestEvaluateArbitrageFees(t *testing.T) {
+
+	var caseindex int = 0
+	var caselength int = len(FeeCases)
+
+	for caseindex = 0; caseindex < caselength; caseindex++ {
+
+		var feecase FeeCase = FeeCases[caseindex]
+
+		var buypair Pair = BitstampBtcUsd
+
+		buypair.FeeInQuote = feecase.FeeInQuote
+
+		var arbitragerequest ArbitrageRequest = ArbitrageRequest{
+			BuyExchange:  &BitstampExchange{CurrencyPair: buypair},
+			SellExchange: &ValrExchange{CurrencyPair: ValrBtcZar},
+			BuyLimit:     MustParseDecimal(`100`),
+			BuyFee:       0.004,
+			SellFee:      0.001,
+			ExchangeRate: MustParseDecimal(`18.18`),
+			ProfitMargin: 0.01,
+		}
+
+		var evaluation Evaluation = EvaluateArbitrage(arbitragerequest, CaseDepth([][]string{{`60000`, `1`}}), CaseDepth([][]string{{`1300000`, `1`}}), MustParseDecimal(feecase.QuoteBalance), MustParseDecimal(`100`))
+
+		if evaluation.Opportunity != feecase.WantOpportunity {
+
+			t.Errorf(`%[1]v: opportunity %[2]v, want %[3]v`, feecase.Name, evaluation.Opportunity, feecase.WantOpportunity)
+		}
+
+		if !feecase.WantOpportunity {
+
+			continue
+		}
+
+		if !evaluation.BuyTrade.QuoteAmount.Equal(MustParseDecimal(feecase.WantBuyPrice)) || !evaluation.SellTrade.QuoteAmount.Equal(MustParseDecimal(feecase.WantSellPrice)) {
+
+			t.Errorf(`%[1]v: limit prices %[2]v %[3]v, want %[4]v %[5]v`, feecase.Name, evaluation.BuyTrade.QuoteAmount, evaluation.SellTrade.QuoteAmount, feecase.WantBuyPrice, feecase.WantSellPrice)
+		}
+	}
+}
+
+func TestHedgeResidual(t *testing.T) {
+
+	var caseindex int = 0
+	var caselength int = len(HedgeCases)
+
+	for caseindex = 0; caseindex < caselength; caseindex++ {
+
+		var hedgecase HedgeCase = HedgeCases[caseindex]
+
+		var hedge Hedge = Hedge{
+			HedgeConfig:  DefaultHedgeConfig,
+			BuyExchange:  &BitstampExchange{CurrencyPair: BitstampBtcUsd},
+			SellExchange: &ValrExchange{CurrencyPair: ValrBtcZar},
+			BuyTrade:     Trade{BaseAmount: MustParseDecimal(`0.02`)},
+			SellTrade:    Trade{BaseAmount: MustParseDecimal(`0.018`)},
+			BuyFee:       0.001,
+		}
+
+		if hedgecase.Reverse {
+
+			hedge.BuyExchange = &ValrExchange{CurrencyPair: ValrBtcZar}
+			hedge.SellExchange = &BitstampExchange{CurrencyPair: BitstampBtcUsd}
+		}
+
+		hedge.Run(context.Background(), OrderStatus{BaseFilled: MustParseDecimal(hedgecase.BuyFilled)}, OrderStatus{BaseFilled: MustParseDecimal(hedgecase.SellFilled)})
+
+		if hedge.State != hedgecase.WantState || !hedge.Residual.Equal(MustParseDecimal(hedgecase.WantResidual)) || len(hedge.Orders) != 0 {
+
+			t.Errorf(`%[1]v: state %[2]v residual %[3]v, want %[4]v %[5]v`, hedgecase.Name, hedge.State, hedge.Residual, hedgecase.WantState, hedgecase.WantResidual)
+		}
+	}
+}
+
+func TestSimulateFill(t *testing.T) {
+
+	var caseindex int = 0
+	var caselength int = len(SimulateFillCases)
+
+	for caseindex = 0; caseindex < caselength; caseindex++ {
+
+		var simulatefillcase SimulateFillCase = SimulateFillCases[caseindex]
+
+		var basefilled Decimal
+		var notional Decimal
+
+		basefilled, notional = SimulateFill(CaseDepth(simulatefillcase.Levels), simulatefillcase.Side, MustParseDecimal(simulatefillcase.BaseAmount), MustParseDecimal(simulatefillcase.Price))
+
+		if !basefilled.Equal(MustParseDecimal(simulatefillcase.WantFilled)) || !notional.Equal(MustParseDecimal(simulatefillcase.WantNotional)) {
+
+			t.Errorf(`%[1]v: filled %[2]v for %[3]v, want %[4]v for %[5]v`, simulatefillcase.Name, basefilled, notional, simulatefillcase.WantFilled, simulatefillcase.WantNotional)
+		}
+	}
+}
+
+func TestPaperRecordOrderIds(t *testing.T) {
+
+	var paperengine PaperEngine = PaperEngine{}
+
+	if err := paperengine.Load(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	var now time.Time = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	var orderids chan string = make(chan string, 50)
+
+	var waitgroup sync.WaitGroup
+
+	var index int = 0
+
+	for index = 0; index < 50; index++ {
+
+		waitgroup.Add(1)
+
+		go func() {
+
+			defer waitgroup.Done()
+
+			var orderid string
+			var err error
+
+			if orderid, err = paperengine.Record(PaperFill{Time: now, Account: `paper`, Venue: `bitstamp`, Symbol: `btcusd`, Side: Buy, Status: OrderFilled}); err != nil {
+
+				t.Error(err)
+			}
+
+			orderids <- orderid
+		}()
+	}
+
+	waitgroup.Wait()
+
+	close(orderids)
+
+	var seen map[string]bool = map[string]bool{}
+
+	for orderid := range orderids {
+
+		if seen[orderid] {
+
+			t.Errorf(`order id %[1]v allocated twice`, orderid)
+		}
+
+		seen[orderid] = true
+	}
+
+	if len(paperengine.Orders) != 50 || paperengine.Fills != 50 {
+
+		t.Errorf(`%[1]v orders after %[2]v fills, want 50`, len(paperengine.Orders), paperengine.Fills)
+	}
+}
+
+func TestLedgerQuery(t *testing.T) {
+
+	var ledger Ledger = Ledger{Dir: t.TempDir()}
+
+	var entries []LedgerEntry = LedgerQueryEntries
+
+	var entryindex int = 0
+	var entrylength int = len(entries)
+
+	for entryindex = 0; entryindex < entrylength; entryindex++ {
+
+		if err := ledger.Record(entries[entryindex]); err != nil {
+
+			t.Fatal(err)
+		}
+	}
+
+	var queryindex int = 0
+	var querylength int = len(LedgerQueryCases)
+
+	for queryindex = 0; queryindex < querylength; queryindex++ {
+
+		var from time.Time
+		var to time.Time
+		var err error
+
+		if from, err = ParseReportTime(LedgerQueryCases[queryindex].From, false); err != nil {
+
+			t.Fatal(err)
+		}
+
+		if to, err = ParseReportTime(LedgerQueryCases[queryindex].To, true); err != nil {
+
+			t.Fatal(err)
+		}
+
+		var ledgerentries []LedgerEntry
+
+		if ledgerentries, err = ledger.Query(LedgerQueryCases[queryindex].Account, from, to); err != nil {
+
+			t.Fatal(err)
+		}
+
+		var got []time.Time = []time.Time{}
+		var want []time.Time = []time.Time{}
+
+		for entryindex = 0; entryindex < len(ledgerentries); entryindex++ {
+
+			got = append(got, ledgerentries[entryindex].Time)
+		}
+
+		for _, wantindex := range LedgerQueryCases[queryindex].Want {
+
+			want = append(want, entries[wantindex].Time)
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+
+			t.Errorf(`%[1]v: got %[2]v, want %[3]v`, LedgerQueryCases[queryindex].Name, got, want)
+		}
+	}
+}
+
+func DecimalPointer(decimal Decimal) *Decimal {
+
+	return &decimal
+}
+
+func CheckReportRow(t *testing.T, reportrow *ReportRow, counts []int, realised map[string]string, estimated map[string]string, volume map[string]string, fees map[string]string, fillratio float64, averageedge float64) {
+
+	var got []int = []int{reportrow.Cycles, reportrow.Opportunities, reportrow.Executed, reportrow.Unhedged, reportrow.Estimated}
+
+	if fmt.Sprint(got) != fmt.Sprint(counts) {
+
+		t.Errorf(`%[1]v: cycles, opportunities, executed, unhedged, estimated %[2]v, want %[3]v`, reportrow.Account, got, counts)
+	}
+
+	var amounts map[string]map[string]Decimal = map[string]map[string]Decimal{`realised`: reportrow.Realised, `estimatedrealised`: reportrow.EstimatedRealised, `volume`: reportrow.Volume, `fees`: reportrow.Fees}
+	var wants map[string]map[string]string = map[string]map[string]string{`realised`: realised, `estimatedrealised`: estimated, `volume`: volume, `fees`: fees}
+
+	for name, want := range wants {
+
+		if len(amounts[name]) != len(want) {
+
+			t.Errorf(`%[1]v: %[2]v %[3]v, want %[4]v`, reportrow.Account, name, amounts[name], want)
+
+			continue
+		}
+
+		for currency, amount := range want {
+
+			if !amounts[name][currency].Equal(MustParseDecimal(amount)) {
+
+				t.Errorf(`%[1]v: %[2]v %[3]v %[4]v, want %[5]v`, reportrow.Account, name, currency, amounts[name][currency], amount)
+			}
+		}
+	}
+
+	if math.Abs(reportrow.FillRatio-fillratio) > 1e-9 || math.Abs(reportrow.AverageEdge-averageedge) > 1e-9 || math.Abs(reportrow.AverageOverMargin-(averageedge-0.5)) > 1e-9 {
+
+		t.Errorf(`%[1]v: fill ratio %[2]v average edge %[3]v over margin %[4]v, want %[5]v %[6]v`, reportrow.Account, reportrow.FillRatio, reportrow.AverageEdge, reportrow.AverageOverMargin, fillratio, averageedge)
+	}
+}
+
+func TestNewReport(t *testing.T) {
+
+	var report Report = NewReport(ReportEntries, false)
+
+	if len(report.Accounts) != 2 || report.Accounts[0].Account != `first` || report.Accounts[1].Account != `second` {
+
+		t.Fatalf(`accounts %+[1]v, want first and second`, report.Accounts)
+	}
+
+	CheckReportRow(t, report.Accounts[0], []int{2, 1, 1, 0, 0},
+		map[string]string{`zar`: `90`, `usd`: `5`},
+		map[string]string{},
+		map[string]string{`btc`: `0.038`, `usd`: `1000`, `zar`: `19000`},
+		map[string]string{`usd`: `4`, `zar`: `19`},
+		1, 1)
+
+	CheckReportRow(t, report.Accounts[1], []int{1, 1, 1, 1, 1},
+		map[string]string{},
+		map[string]string{`zar`: `36`, `usd`: `2`},
+		map[string]string{`btc`: `0.028`, `usd`: `500`, `zar`: `19000`},
+		map[string]string{`usd`: `2`, `zar`: `19`},
+		0.028/0.038, 2)
+
+	CheckReportRow(t, report.Total, []int{3, 2, 2, 1, 1},
+		map[string]string{`zar`: `90`, `usd`: `5`},
+		map[string]string{`zar`: `36`, `usd`: `2`},
+		map[string]string{`btc`: `0.066`, `usd`: `1500`, `zar`: `38000`},
+		map[string]string{`usd`: `6`, `zar`: `38`},
+		0.066/0.076, 1.5)
+
+	var paper Report = NewReport(ReportEntries, true)
+
+	if len(paper.Accounts) != 1 || !paper.Total.Realised[`zar`].Equal(MustParseDecimal(`1000`)) || paper.Total.Cycles != 1 {
+
+		t.Errorf(`paper report %+[1]v, want only the paper cycle`, paper.Total)
+	}
+}
+
+func TestReportCsv(t *testing.T) {
+
+	var report Report = NewReport(ReportEntries, false)
+
+	var builder strings.Builder
+
+	if err := report.WriteCsv(&builder); err != nil {
+
+		t.Fatal(err)
+	}
+
+	var lines []string = strings.Split(strings.TrimSpace(builder.String()), "\n")
+
+	var want []string = []string{
+		`account,cycles,opportunities,executed,unhedged,estimated,realised_usd,realised_zar,estimatedrealised_usd,estimatedrealised_zar,volume_btc,volume_usd,volume_zar,fees_usd,fees_zar,fillratio,averageedge,averagemargin,averageovermargin`,
+		`first,2,1,1,0,0,5.00,90,0,0,0.038,1000,19000,4,19,1.0000,1.0000,0.5000,0.5000`,
+		`second,1,1,1,1,1,0,0,2.00,36,0.028,500,19000,2,19,0.7368,2.0000,0.5000,1.5000`,
+		`total,3,2,2,1,1,5.00,90,2.00,36,0.066,1500,38000,6,38,0.8684,1.5000,0.5000,1.0000`,
+	}
+
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+
+		t.Errorf("csv\n%[1]v\nwant\n%[2]v", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func RecordingLines(t *testing.T, dir string) (plain []int, compressed []int) {
+
+	var filenames []string
+
+	filenames, _ = filepath.Glob(filepath.Join(dir, `books-*`))
+
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+
+		var content []byte
+		var err error
+
+		if content, err = os.ReadFile(filename); err != nil {
+
+			t.Fatal(err)
+		}
+
+		if !strings.HasSuffix(filename, `.gz`) {
+
+			plain = append(plain, strings.Count(string(content), "\n"))
+
+			continue
+		}
+
+		var reader *gzip.Reader
+
+		if reader, err = gzip.NewReader(bytes.NewReader(content)); err != nil {
+
+			t.Fatal(err)
+		}
+
+		if content, err = io.ReadAll(reader); err != nil {
+
+			t.Fatal(err)
+		}
+
+		compressed = append(compressed, strings.Count(string(content), "\n"))
+	}
+
+	return
+}
+
+func WaitRecordings(t *testing.T, dir string, wantcompressed int) (plain []int, compressed []int) {
+
+	var deadline time.Time = time.Now().Add(5 * time.Second)
+
+	for {
+
+		plain, compressed = RecordingLines(t, dir)
+
+		if len(compressed) >= wantcompressed && len(plain) <= 1 || time.Now().After(deadline) {
+
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRecorderRotateSize(t *testing.T) {
+
+	var recorder Recorder = Recorder{Dir: t.TempDir()}
+
+	var rate Decimal = MustParseDecimal(`18.5`)
+
+	var line []byte
+
+	line, _ = json.Marshal(BookRecord{Time: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), Kind: RecordRate, From: `usd`, To: `zar`, Rate: &rate})
+
+	recorder.MaxSize = int64(3 * (len(line) + 1))
+
+	var index int = 0
+
+	for index = 0; index < 7; index++ {
+
+		recorder.Record(BookRecord{Time: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), Kind: RecordRate, From: `usd`, To: `zar`, Rate: &rate})
+	}
+
+	if err := recorder.Close(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	var plain []int
+	var compressed []int
+
+	plain, compressed = WaitRecordings(t, recorder.Dir, 2)
+
+	if fmt.Sprint(compressed) != `[3 3]` || fmt.Sprint(plain) != `[1]` {
+
+		t.Errorf(`compressed %[1]v plain %[2]v lines, want two full compressed files and one open file`, compressed, plain)
+	}
+}
+
+func TestRecorderRotateAge(t *testing.T) {
+
+	var recorder Recorder = Recorder{Dir: t.TempDir(), MaxAge: time.Hour}
+
+	recorder.RecordRate(`usd`, `zar`, MustParseDecimal(`18.5`))
+	recorder.RecordRate(`usd`, `zar`, MustParseDecimal(`18.6`))
+
+	recorder.Mutex.Lock()
+
+	recorder.Opened = recorder.Opened.Add(-time.Hour)
+
+	recorder.Mutex.Unlock()
+
+	recorder.RecordRate(`usd`, `zar`, MustParseDecimal(`18.7`))
+
+	if err := recorder.Close(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	var plain []int
+	var compressed []int
+
+	plain, compressed = WaitRecordings(t, recorder.Dir, 1)
+
+	if fmt.Sprint(compressed) != `[2]` || fmt.Sprint(plain) != `[1]` {
+
+		t.Errorf(`compressed %[1]v plain %[2]v lines, want the expired file compressed and one open file`, compressed, plain)
+	}
+}
+
+func TestParseEcbRatesInvalid(t *testing.T) {
+
+	var rates []string = []string{`0`, `-1.1`, `NaN`, `+Inf`}
+
+	var rateindex int = 0
+	var ratelength int = len(rates)
+
+	for rateindex = 0; rateindex < ratelength; rateindex++ {
+
+		if _, err := ParseEcbRates([]byte(fmt.Sprintf(EcbDocument, rates[rateindex]))); err == nil {
+
+			t.Errorf(`rate %[1]v: parsed, want an error`, rates[rateindex])
+		}
+	}
+
+	var ecbrates []EcbRates
+	var err error
+
+	if ecbrates, err = ParseEcbRates([]byte(fmt.Sprintf(EcbDocument, `1.1`))); err != nil {
+
+		t.Fatal(err)
+	}
+
+	var rate float64
+
+	if rate, err = ecbrates[0].Rate(`usd`, `zar`); err != nil || math.Abs(rate-20.5/1.1) > 1e-12 {
+
+		t.Errorf(`usd to zar %[1]v %[2]v, want %[3]v`, rate, err, 20.5/1.1)
+	}
+}
+
+func TestEcbRatesRateInvalid(t *testing.T) {
+
+	var ecbrates EcbRates = EcbRates{Rates: map[string]float64{`EUR`: 1, `USD`: 0, `ZAR`: math.NaN(), `GBP`: math.Inf(1)}}
+
+	var pairs [][2]string = [][2]string{{`eur`, `usd`}, {`usd`, `eur`}, {`eur`, `zar`}, {`gbp`, `eur`}, {`eur`, `jpy`}}
+
+	var pairindex int = 0
+	var pairlength int = len(pairs)
+
+	for pairindex = 0; pairindex < pairlength; pairindex++ {
+
+		if rate, err := ecbrates.Rate(pairs[pairindex][0], pairs[pairindex][1]); err == nil {
+
+			t.Errorf(`%[1]v to %[2]v: rate %[3]v, want an error`, pairs[pairindex][0], pairs[pairindex][1], rate)
+		}
+	}
+}
+
+func TestPlaceOrderUncertain(t *testing.T) {
+
+	var lookupdelay time.Duration = OrderLookupDelay
+	var lookuptimeout time.Duration = OrderLookupTimeout
+
+	OrderLookupDelay = time.Millisecond
+	OrderLookupTimeout = 50 * time.Millisecond
+
+	defer func() {
+
+		OrderLookupDelay = lookupdelay
+		OrderLookupTimeout = lookuptimeout
+	}()
+
+	var order Order = Order{Side: Buy, BaseAmount: MustParseDecimal(`0.01`), Price: MustParseDecimal(`50000`), TimeInForce: `IOC`, ClientOrderId: `trader-1-buy`}
+
+	var slow *UncertainExchange = &UncertainExchange{FoundAfter: 5}
+
+	var orderid string
+	var err error
+
+	if orderid, err = PlaceOrder(context.Background(), slow, order); err != nil || orderid != `42` || slow.Posts != 1 {
+
+		t.Errorf(`slow index: order %[1]v error %[2]v after %[3]v posts, want order 42 from one post`, orderid, err, slow.Posts)
+	}
+
+	var missing *UncertainExchange = &UncertainExchange{}
+
+	if orderid, err = PlaceOrder(context.Background(), missing, order); !errors.Is(err, ErrOrderUncertain) || orderid != `` || missing.Posts != 1 || missing.Lookups < 2 {
+
+		t.Errorf(`never indexed: order %[1]v error %[2]v after %[3]v posts and %[4]v lookups, want uncertain from one post`, orderid, err, missing.Posts, missing.Lookups)
+	}
+}
+
+func TestCommandUsage(t *testing.T) {
+
+	var commands []func([]string) error = []func([]string) error{RunBacktest, RunBacktest, RunReport, RunReport, RunReport, RunConvert, RunConvert}
+
+	var arguments [][]string = [][]string{{`config.json`}, {`-bogus`, `config.json`, `recordings`}, {`-format`, `xml`}, {`extra`}, {`-bogus`}, {}, {`-reverse`, `first.csv`, `second.csv`}}
+
+	var commandindex int = 0
+	var commandlength int = len(commands)
+
+	for commandindex = 0; commandindex < commandlength; commandindex++ {
+
+		if err := commands[commandindex](arguments[commandindex]); !errors.Is(err, ErrUsage) {
+
+			t.Errorf(`%[1]v: got %[2]v, want a usage error`, arguments[commandindex], err)
+		}
+	}
+}
+
+func TestConvertCsvConfig(t *testing.T) {
+
+	var accounts [][]string = [][]string{{`bitstampkey`, `bitstampsecret`, `customer`, `valrkey`, `valrsecret`, `1000`, `0.5`, `true`}}
+
+	var config Config
+	var err error
+
+	if config, err = ConvertCsvConfig(accounts, false); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if routes := config.Accounts[0].Routes; len(routes) != 1 || routes[0].Buy != `bitstamp` || routes[0].Sell != `valr` || !routes[0].Limit.Equal(MustParseDecimal(`1000`)) {
+
+		t.Errorf(`routes %+[1]v, want only bitstamp to valr`, routes)
+	}
+
+	if config, err = ConvertCsvConfig(accounts, true); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if routes := config.Accounts[0].Routes; len(routes) != 2 || routes[1].Buy != `valr` || routes[1].Sell != `bitstamp` {
+
+		t.Errorf(`routes %+[1]v, want bitstamp to valr and valr to bitstamp`, routes)
+	}
+}
+
+func TestBacktestRatesAt(t *testing.T) {
+
+	var backtest Backtest = Backtest{EcbRates: []EcbRates{
+		{Date: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), Rates: map[string]float64{`ZAR`: 20.6}},
+		{Date: time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), Rates: map[string]float64{`ZAR`: 20.5}},
+	}}
+
+	var moments []time.Time = []time.Time{
+		time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC),
+	}
+
+	var wants []float64 = []float64{20.5, 20.6, 20.6}
+
+	var momentindex int = 0
+	var momentlength int = len(moments)
+
+	for momentindex = 0; momentindex < momentlength; momentindex++ {
+
+		if ecbrates, err := backtest.RatesAt(moments[momentindex]); err != nil || ecbrates.Rates[`ZAR`] != wants[momentindex] {
+
+			t.Errorf(`%[1]v: zar %[2]v %[3]v, want %[4]v`, moments[momentindex], ecbrates.Rates[`ZAR`], err, wants[momentindex])
+		}
+	}
+
+	if _, err := backtest.RatesAt(time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)); err == nil {
+
+		t.Errorf(`rates before the first publication, want an error`)
+	}
+}
+
+func RandomDepth(random *mathrand.Rand) (depth Depth, basetotal Decimal, notionaltotal Decimal) {
+
+	depth = Depth{Levels: []Level{}}
+
+	basetotal = DecimalZero
+	notionaltotal = DecimalZero
+
+	var levellength int = 1 + random.Intn(10)
+
+	var price int64 = 1 + random.Int63n(100000)
+
+	var levelindex int = 0
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		var level Level = Level{
+			QuoteAmount: NewDecimal(price*100+random.Int63n(100), 2),
+			BaseAmount:  NewDecimal(1+random.Int63n(200000000), 8),
+		}
+
+		depth.Levels = append(depth.Levels, level)
+
+		basetotal = basetotal.Add(level.BaseAmount)
+		notionaltotal = notionaltotal.Add(level.BaseAmount.Mul(level.QuoteAmount).Round(2))
+
+		price += 1 + random.Int63n(100)
+	}
+
+	return
+}
+
+func RandomNotional(random *mathrand.Rand, notionaltotal Decimal) Decimal {
+
+	var cents int64 = notionaltotal.Mul(NewDecimal(100, 0)).Truncate(0).Coefficient().Int64()
+
+	if cents <= 1 {
+
+		return NewDecimal(1, 2)
+	}
+
+	return NewDecimal(1+random.Int63n(cents-1), 2)
+}
+
+func ExpectedTrade(depth Depth, notional Decimal) (trade Trade, found bool) {
+
+	var baseahead Decimal = DecimalZero
+	var notionalahead Decimal = DecimalZero
+
+	var levelindex int = 0
+	var levellength int = len(depth.Levels)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		var level Level = depth.Levels[levelindex]
+
+		var levelnotional Decimal = level.BaseAmount.Mul(level.QuoteAmount).Round(2)
+
+		if notionalahead.Add(levelnotional).GreaterThan(notional) {
+
+			var fraction Decimal = notional.Sub(notionalahead).Div(levelnotional, 18)
+
+			trade = Trade{
+				BaseAmount:     baseahead.Add(level.BaseAmount.Mul(fraction)).Truncate(8),
+				QuoteAmount:    level.QuoteAmount,
+				NotionalAmount: notional,
+			}
+
+			found = true
+
+			return
+		}
+
+		baseahead = baseahead.Add(level.BaseAmount)
+		notionalahead = notionalahead.Add(levelnotional)
+	}
+
+	return
+}
+
+func RandomBooks(t *testing.T, property func(random *mathrand.Rand, depth Depth, basetotal Decimal, notionaltotal Decimal) bool) {
+
+	var random *mathrand.Rand = mathrand.New(mathrand.NewSource(PropertySeed))
+
+	var iteration int = 0
+
+	for iteration = 0; iteration < PropertyIterations; iteration++ {
+
+		var depth Depth
+		var basetotal Decimal
+		var notionaltotal Decimal
+
+		depth, basetotal, notionaltotal = RandomDepth(random)
+
+		if !property(random, depth, basetotal, notionaltotal) {
+
+			t.Logf(`iteration %[1]v, seed %[2]v, book %+[3]v`, iteration, PropertySeed, depth.Levels)
+
+			return
+		}
+	}
+}
+
+func TestCalculateTradeNotionalLimit(t *testing.T) {
+
+	RandomBooks(t, func(random *mathrand.Rand, depth Depth, basetotal Decimal, notionaltotal Decimal) bool {
+
+		var notional Decimal = RandomNotional(random, notionaltotal)
+
+		var trade Trade = CalculateTrade(depth, notional)
+
+		if trade.NotionalAmount.GreaterThan(notional) || !trade.NotionalAmount.Equal(notional) {
+
+			t.Errorf(`notional %[1]v, want the limit %[2]v`, trade.NotionalAmount, notional)
+
+			return false
+		}
+
+		if trade.Shortfall.Sign() != 0 {
+
+			t.Errorf(`shortfall %[1]v for %[2]v inside the book`, trade.Shortfall, notional)
+
+			return false
+		}
+
+		if trade.BaseAmount.GreaterThan(basetotal) || trade.BaseAmount.Sign() < 0 {
+
+			t.Errorf(`base %[1]v outside 0 to %[2]v`, trade.BaseAmount, basetotal)
+
+			return false
+		}
+
+		var tolerance Decimal = NewDecimal(int64(len(depth.Levels)), 2)
+
+		if trade.NotionalAmount.GreaterThan(trade.BaseAmount.Add(NewDecimal(1, 8)).Mul(trade.QuoteAmount).Add(tolerance)) {
+
+			t.Errorf(`notional %[1]v above base %[2]v at the last level price %[3]v`, trade.NotionalAmount, trade.BaseAmount, trade.QuoteAmount)
+
+			return false
+		}
+
+		return true
+	})
+}
+
+func TestCalculateTradeInterpolation(t *testing.T) {
+
+	RandomBooks(t, func(random *mathrand.Rand, depth Depth, basetotal Decimal, notionaltotal Decimal) bool {
+
+		var notional Decimal = RandomNotional(random, notionaltotal)
+
+		var trade Trade = CalculateTrade(depth, notional)
+
+		var expected Trade
+		var found bool
+
+		if expected, found = ExpectedTrade(depth, notional); !found || !SameTrade(trade, expected) {
+
+			t.Errorf(`notional %[1]v: got %+[2]v, interpolated %+[3]v`, notional, trade, expected)
+
+			return false
+		}
+
+		return true
+	})
+}
+
+func TestCalculateTradeMonotone(t *testing.T) {
+
+	RandomBooks(t, func(random *mathrand.Rand, depth Depth, basetotal Decimal, notionaltotal Decimal) bool {
+
+		var notional Decimal = RandomNotional(random, notionaltotal)
+		var larger Decimal = MinDecimal(notional.Add(RandomNotional(random, notionaltotal)), notionaltotal.Sub(NewDecimal(1, 2)))
+
+		if !larger.GreaterThan(notional) {
+
+			return true
+		}
+
+		var trade Trade = CalculateTrade(depth, notional)
+		var largertrade Trade = CalculateTrade(depth, larger)
+
+		if largertrade.BaseAmount.LessThan(trade.BaseAmount) {
+
+			t.Errorf(`base %[1]v for notional %[2]v is below %[3]v for %[4]v`, largertrade.BaseAmount, larger, trade.BaseAmount, notional)
+
+			return false
+		}
+
+		return true
+	})
+}
+
+func TestCalculateTradeInsufficientDepth(t *testing.T) {
+
+	RandomBooks(t, func(random *mathrand.Rand, depth Depth, basetotal Decimal, notionaltotal Decimal) bool {
+
+		var excess Decimal = NewDecimal(1+random.Int63n(100000), 2)
+
+		var whole Trade = Trade{
+			BaseAmount:     basetotal,
+			QuoteAmount:    depth.Levels[len(depth.Levels)-1].QuoteAmount,
+			NotionalAmount: notionaltotal,
+			Shortfall:      excess,
+		}
+
+		var insufficient Trade = CalculateTrade(depth, notionaltotal.Add(excess))
+
+		if !SameTrade(insufficient, whole) {
+
+			t.Errorf(`insufficient depth gave %+[1]v, want the whole book %+[2]v`, insufficient, whole)
+
+			return false
+		}
+
+		whole.Shortfall = DecimalZero
+
+		var exact Trade = CalculateTrade(depth, notionaltotal)
+
+		if !SameTrade(exact, whole) {
+
+			t.Errorf(`the whole book notional gave %+[1]v, want %+[2]v`, exact, whole)
+
+			return false
+		}
+
+		var notional Decimal = RandomNotional(random, notionaltotal)
+
+		var empty Trade = CalculateTrade(Depth{}, notional)
+
+		if !SameTrade(empty, Trade{Shortfall: notional}) {
+
+			t.Errorf(`empty depth gave %+[1]v for %[2]v`, empty, notional)
+
+			return false
+		}
+
+		return true
+	})
+}
+
+func TestCalculateProfitSign(t *testing.T) {
+
+	RandomBooks(t, func(random *mathrand.Rand, depth Depth, basetotal Decimal, notionaltotal Decimal) bool {
+
+		var buy Decimal = CalculateTrade(depth, RandomNotional(random, notionaltotal)).BaseAmount.Add(NewDecimal(1, 8))
+		var sell Decimal = NewDecimal(random.Int63n(buy.Mul(NewDecimal(200000000, 0)).Truncate(0).Coefficient().Int64()+1), 8)
+
+		var profit float64 = CalculateProfit(buy, sell)
+
+		if (profit > 0) != sell.LessThan(buy) || (profit < 0) != sell.GreaterThan(buy) || profit > 1 {
+
+			t.Errorf(`profit %[1]v for buy %[2]v sell %[3]v`, profit, buy, sell)
+
+			return false
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,761 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReplayBook struct {
+	Depths    map[int]Depth
+	Updated   map[int]time.Time
+	OrderBook *OrderBook
+}
+
+type ReplayExchange struct {
+	Exchange     string
+	CurrencyPair Pair
+	ReplayBook   *ReplayBook
+}
+
+type Backtest struct {
+	Config      Config
+	EcbRates    []EcbRates
+	Step        time.Duration
+	PaperEngine *PaperEngine
+	Books       map[string]*ReplayBook
+	Now         time.Time
+	Trades      *csv.Writer
+	Pnl         *csv.Writer
+	Summary     BacktestSummary
+}
+
+type BacktestSummary struct {
+	From          time.Time
+	To            time.Time
+	Records       int
+	Steps         int
+	Evaluated     int
+	Opportunities int
+	Executed      int
+	Hits          int
+	HitRate       float64
+	Hedged        int
+	Unhedged      int
+	Pnl           map[string]map[string]Decimal
+}
+
+var ErrReplayUnsupported error = errors.New(`backtest: not available on a replayed exchange`)
+
+func RunBacktest(arguments []string) (err error) {
+
+	var flagset *flag.FlagSet = flag.NewFlagSet(`backtest`, flag.ContinueOnError)
+
+	var ecbclient EcbClient = EcbClient{}
+
+	var step time.Duration
+	var out string
+	var quiet bool
+
+	flagset.StringVar(&ecbclient.Url, `ecb`, EcbHistoryUrl, `ECB historical reference rate URL or local XML file`)
+	flagset.StringVar(&ecbclient.CachePath, `ecbcache`, `eurofxref-hist.xml`, `ECB historical reference rate cache file, empty to disable`)
+	flagset.DurationVar(&ecbclient.MaxAge, `ecbmaxage`, 24*time.Hour, `maximum age of cached ECB historical reference rates`)
+	flagset.DurationVar(&step, `step`, time.Minute, `simulated delay between arbitrage cycles`)
+	flagset.StringVar(&out, `out`, `backtest`, `output directory for fills.jsonl, trades.csv and pnl.csv`)
+	flagset.BoolVar(&quiet, `quiet`, false, `discard logs, including replay errors`)
+
+	flagset.Usage = func() {
+
+		fmt.Fprintln(flagset.Output(), `usage: algo backtest [-ecb url] [-step duration] [-out dir] [-quiet] config.json recording...`)
+
+		flagset.PrintDefaults()
+	}
+
+	if err = flagset.Parse(arguments); err != nil {
+
+		if !errors.Is(err, flag.ErrHelp) {
+
+			err = fmt.Errorf(`%[1]w: %[2]w`, ErrUsage, err)
+		}
+
+		return
+	}
+
+	if flagset.NArg() < 2 {
+
+		flagset.Usage()
+
+		err = fmt.Errorf(`%[1]w: backtest needs a config file and at least one recording`, ErrUsage)
+
+		return
+	}
+
+	var backtest Backtest = Backtest{Step: step, Books: map[string]*ReplayBook{}}
+
+	var content []byte
+
+	if content, err = os.ReadFile(flagset.Arg(0)); err != nil {
+
+		return
+	}
+
+	if backtest.Config, err = LoadConfig(flagset.Arg(0), content); err != nil {
+
+		return
+	}
+
+	if backtest.EcbRates, err = ecbclient.GetRates(); err != nil {
+
+		return
+	}
+
+	var recordings []string
+
+	if recordings, err = ListRecordings(flagset.Args()[1:]); err != nil {
+
+		return
+	}
+
+	if err = os.MkdirAll(out, 0o755); err != nil {
+
+		return
+	}
+
+	var fillspath string = filepath.Join(out, `fills.jsonl`)
+
+	if err = os.Remove(fillspath); err != nil && !errors.Is(err, os.ErrNotExist) {
+
+		return
+	}
+
+	backtest.PaperEngine = &PaperEngine{Path: fillspath, Clock: func() time.Time { return backtest.Now }}
+
+	if err = backtest.PaperEngine.Load(); err != nil {
+
+		return
+	}
+
+	var tradesfile *os.File
+	var pnlfile *os.File
+
+	if tradesfile, err = os.Create(filepath.Join(out, `trades.csv`)); err != nil {
+
+		return
+	}
+
+	defer tradesfile.Close()
+
+	if pnlfile, err = os.Create(filepath.Join(out, `pnl.csv`)); err != nil {
+
+		return
+	}
+
+	defer pnlfile.Close()
+
+	backtest.Trades = csv.NewWriter(tradesfile)
+	backtest.Pnl = csv.NewWriter(pnlfile)
+
+	backtest.Trades.Write([]string{`time`, `account`, `buy`, `buypair`, `sell`, `sellpair`, `netpercent`, `netbase`, `buyprice`, `buyamount`, `buystatus`, `buyfilled`, `sellprice`, `sellamount`, `sellstatus`, `sellfilled`})
+	backtest.Pnl.Write([]string{`time`, `account`, `currency`, `pnl`})
+
+	if quiet {
+
+		log.SetOutput(io.Discard)
+
+		defer log.SetOutput(os.Stderr)
+	}
+
+	if err = ReplayRecordings(recordings, backtest.Replay); err != nil {
+
+		return
+	}
+
+	if !backtest.Now.IsZero() {
+
+		if err = backtest.Cycle(); err != nil {
+
+			return
+		}
+	}
+
+	backtest.Trades.Flush()
+	backtest.Pnl.Flush()
+
+	if err = errors.Join(backtest.Trades.Error(), backtest.Pnl.Error()); err != nil {
+
+		return
+	}
+
+	backtest.Summary.To = backtest.Now
+
+	if backtest.Summary.Executed > 0 {
+
+		backtest.Summary.HitRate = float64(backtest.Summary.Hits) / float64(backtest.Summary.Executed)
+	}
+
+	backtest.Summary.Pnl = map[string]map[string]Decimal{}
+
+	var accountindex int = 0
+	var accountlength int = len(backtest.Config.Accounts)
+
+	for accountindex = 0; accountindex < accountlength; accountindex++ {
+
+		var name string = backtest.Config.Accounts[accountindex].Name
+
+		backtest.Summary.Pnl[name] = backtest.PaperEngine.Pnl(name)
+	}
+
+	var encoder *json.Encoder = json.NewEncoder(os.Stdout)
+
+	encoder.SetIndent(``, "\t")
+
+	err = encoder.Encode(backtest.Summary)
+
+	return
+}
+
+func ListRecordings(paths []string) (recordings []string, err error) {
+
+	var pathindex int = 0
+	var pathlength int = len(paths)
+
+	for pathindex = 0; pathindex < pathlength; pathindex++ {
+
+		var fileinfo os.FileInfo
+
+		if fileinfo, err = os.Stat(paths[pathindex]); err != nil {
+
+			return
+		}
+
+		if !fileinfo.IsDir() {
+
+			recordings = append(recordings, paths[pathindex])
+
+			continue
+		}
+
+		var matches []string
+
+		if matches, err = filepath.Glob(filepath.Join(paths[pathindex], `books-*.jsonl*`)); err != nil {
+
+			return
+		}
+
+		sort.Strings(matches)
+
+		recordings = append(recordings, matches...)
+	}
+
+	return
+}
+
+func ReplayRecordings(recordings []string, replay func(BookRecord) error) (err error) {
+
+	var recordingindex int = 0
+	var recordinglength int = len(recordings)
+
+	for recordingindex = 0; recordingindex < recordinglength; recordingindex++ {
+
+		if err = ReplayRecording(recordings[recordingindex], replay); err != nil {
+
+			return
+		}
+	}
+
+	return
+}
+
+func ReplayRecording(recording string, replay func(BookRecord) error) (err error) {
+
+	var file *os.File
+
+	if file, err = os.Open(recording); err != nil {
+
+		return
+	}
+
+	defer file.Close()
+
+	var reader io.Reader = file
+
+	if strings.HasSuffix(recording, `.gz`) {
+
+		var gzipreader *gzip.Reader
+
+		if gzipreader, err = gzip.NewReader(file); err != nil {
+
+			return
+		}
+
+		defer gzipreader.Close()
+
+		reader = gzipreader
+	}
+
+	var scanner *bufio.Scanner = bufio.NewScanner(reader)
+
+	scanner.Buffer(make([]byte, 1024*1024), WebsocketMaxMessage)
+
+	var line int = 0
+
+	for scanner.Scan() {
+
+		line += 1
+
+		var bookrecord BookRecord
+
+		if err = json.Unmarshal(scanner.Bytes(), &bookrecord); err != nil {
+
+			err = errors.New(strings.Join([]string{recording, strconv.Itoa(line), err.Error()}, `: `))
+
+			return
+		}
+
+		if err = replay(bookrecord); err != nil {
+
+			return
+		}
+	}
+
+	err = scanner.Err()
+
+	return
+}
+
+func (backtest *Backtest) Replay(bookrecord BookRecord) (err error) {
+
+	if backtest.Summary.Records == 0 {
+
+		backtest.Summary.From = bookrecord.Time
+	}
+
+	backtest.Summary.Records += 1
+
+	if backtest.Now.IsZero() {
+
+		backtest.Now = bookrecord.Time.Truncate(backtest.Step).Add(backtest.Step)
+	}
+
+	if !bookrecord.Time.Before(backtest.Now) {
+
+		if err = backtest.Cycle(); err != nil {
+
+			return
+		}
+
+		backtest.Now = bookrecord.Time.Truncate(backtest.Step).Add(backtest.Step)
+	}
+
+	if bookrecord.Kind == RecordRate {
+
+		return
+	}
+
+	var bookkey string = strings.Join([]string{bookrecord.Venue, bookrecord.Symbol}, `/`)
+
+	var replaybook *ReplayBook
+	var found bool
+
+	if replaybook, found = backtest.Books[bookkey]; !found {
+
+		replaybook = &ReplayBook{Depths: map[int]Depth{}, Updated: map[int]time.Time{}, OrderBook: NewOrderBook()}
+
+		backtest.Books[bookkey] = replaybook
+	}
+
+	var sides map[int][]RecordLevel = map[int][]RecordLevel{
+		Bid: bookrecord.Bids,
+		Ask: bookrecord.Asks,
+	}
+
+	var depthtype int
+	var recordlevels []RecordLevel
+
+	switch bookrecord.Kind {
+
+	case RecordDepth:
+
+		for depthtype, recordlevels = range sides {
+
+			if recordlevels == nil {
+
+				continue
+			}
+
+			var depth Depth = Depth{Type: depthtype}
+
+			var levelindex int = 0
+			var levellength int = len(recordlevels)
+
+			for levelindex = 0; levelindex < levellength; levelindex++ {
+
+				depth.Levels = append(depth.Levels, recordlevels[levelindex].Level())
+			}
+
+			replaybook.Depths[depthtype] = depth
+			replaybook.Updated[depthtype] = bookrecord.Time
+		}
+
+	case RecordSnapshot, RecordDiff:
+
+		var orderbook *OrderBook = replaybook.OrderBook
+
+		if bookrecord.Kind == RecordSnapshot {
+
+			orderbook.Bids = map[string]Level{}
+			orderbook.Asks = map[string]Level{}
+			orderbook.Synced = true
+
+		} else if !orderbook.Synced {
+
+			return
+		}
+
+		for depthtype, recordlevels = range sides {
+
+			var levelindex int = 0
+			var levellength int = len(recordlevels)
+
+			for levelindex = 0; levelindex < levellength; levelindex++ {
+
+				orderbook.Set(depthtype, recordlevels[levelindex][0], recordlevels[levelindex][1])
+			}
+		}
+
+		orderbook.Updated = bookrecord.Time
+	}
+
+	return
+}
+
+func (backtest *Backtest) Cycle() (err error) {
+
+	backtest.Summary.Steps += 1
+
+	var ctx context.Context = context.Background()
+
+	var ecbrates EcbRates
+
+	if ecbrates, err = backtest.RatesAt(backtest.Now); err != nil {
+
+		return
+	}
+
+	var config Config = backtest.Config
+
+	var accountindex int = 0
+	var accountlength int = len(config.Accounts)
+
+	for accountindex = 0; accountindex < accountlength; accountindex++ {
+
+		var account AccountConfig = config.Accounts[accountindex]
+
+		var strategy StrategyConfig = config.AccountStrategy(account)
+
+		var routeindex int = 0
+		var routelength int = len(account.Routes)
+
+		for routeindex = 0; routeindex < routelength; routeindex++ {
+
+			var route RouteConfig = account.Routes[routeindex]
+
+			var arbitragerequest ArbitrageRequest = ArbitrageRequest{
+				Account:      account.Name,
+				ProfitMargin: strategy.ProfitMargin,
+				ScaleDown:    strategy.ScaleDown,
+				ExecuteTrade: true,
+				Paper:        true,
+				HedgeConfig:  strategy.HedgeConfig(),
+			}
+
+			var buyexchange *ReplayExchange
+			var sellexchange *ReplayExchange
+
+			if buyexchange, err = backtest.Exchange(config.Venues[route.Buy], route.BuyPair); err != nil {
+
+				return
+			}
+
+			if sellexchange, err = backtest.Exchange(config.Venues[route.Sell], route.SellPair); err != nil {
+
+				return
+			}
+
+			if _, err = buyexchange.GetDepth(ctx, Ask); err != nil {
+
+				err = nil
+
+				continue
+			}
+
+			if _, err = sellexchange.GetDepth(ctx, Bid); err != nil {
+
+				err = nil
+
+				continue
+			}
+
+			if arbitragerequest.BuyFee, err = BacktestTakerFee(config.Venues[route.Buy], account.Credentials[route.Buy], route.Buy); err != nil {
+
+				return
+			}
+
+			if arbitragerequest.SellFee, err = BacktestTakerFee(config.Venues[route.Sell], account.Credentials[route.Sell], route.Sell); err != nil {
+
+				return
+			}
+
+			arbitragerequest.BuyExchange = backtest.PaperEngine.Wrap(account.Name, route.Buy, account.Paper[route.Buy], arbitragerequest.BuyFee, buyexchange)
+			arbitragerequest.SellExchange = backtest.PaperEngine.Wrap(account.Name, route.Sell, account.Paper[route.Sell], arbitragerequest.SellFee, sellexchange)
+
+			if err = PrepareArbitrage(route, ecbrates, &arbitragerequest); err != nil {
+
+				return
+			}
+
+			var arbitrageresponse ArbitrageResponse
+
+			if arbitrageresponse, err = Arbitrage(ctx, arbitragerequest); err != nil {
+
+				if ErrorAction(err) == ActionHalt {
+
+					return
+				}
+
+				log.Printf(`Error('%+[1]v')`, err)
+
+				err = nil
+
+				if !arbitrageresponse.Executed {
+
+					continue
+				}
+			}
+
+			backtest.Summary.Evaluated += 1
+
+			if arbitrageresponse.Evaluation.Opportunity {
+
+				backtest.Summary.Opportunities += 1
+			}
+
+			if !arbitrageresponse.Executed {
+
+				continue
+			}
+
+			backtest.Summary.Executed += 1
+
+			if arbitrageresponse.BuyOrderStatus.Status == OrderFilled && arbitrageresponse.SellOrderStatus.Status == OrderFilled {
+
+				backtest.Summary.Hits += 1
+			}
+
+			switch arbitrageresponse.Hedge.State {
+
+			case HedgeHedged:
+
+				backtest.Summary.Hedged += 1
+
+			case HedgeAlerted:
+
+				backtest.Summary.Unhedged += 1
+			}
+
+			backtest.Trades.Write([]string{
+				backtest.Now.Format(time.RFC3339),
+				account.Name,
+				route.Buy,
+				route.BuyPair,
+				route.Sell,
+				route.SellPair,
+				strconv.FormatFloat(arbitrageresponse.Evaluation.NetPercent, 'f', -1, 64),
+				arbitrageresponse.Evaluation.NetBase.String(),
+				arbitrageresponse.Evaluation.BuyTrade.QuoteAmount.String(),
+				arbitrageresponse.Evaluation.BuyTrade.BaseAmount.String(),
+				arbitrageresponse.BuyOrderStatus.Status,
+				arbitrageresponse.BuyOrderStatus.BaseFilled.String(),
+				arbitrageresponse.Evaluation.SellTrade.QuoteAmount.String(),
+				arbitrageresponse.Evaluation.SellTrade.BaseAmount.String(),
+				arbitrageresponse.SellOrderStatus.Status,
+				arbitrageresponse.SellOrderStatus.BaseFilled.String(),
+			})
+		}
+
+		var pnl map[string]Decimal = backtest.PaperEngine.Pnl(account.Name)
+
+		var currencies []string = make([]string, 0, len(pnl))
+
+		for currency := range pnl {
+
+			currencies = append(currencies, currency)
+		}
+
+		sort.Strings(currencies)
+
+		var currencyindex int = 0
+		var currencylength int = len(currencies)
+
+		for currencyindex = 0; currencyindex < currencylength; currencyindex++ {
+
+			backtest.Pnl.Write([]string{backtest.Now.Format(time.RFC3339), account.Name, currencies[currencyindex], pnl[currencies[currencyindex]].String()})
+		}
+	}
+
+	return
+}
+
+func (backtest *Backtest) RatesAt(moment time.Time) (ecbrates EcbRates, err error) {
+
+	var rateindex int = 0
+	var ratelength int = len(backtest.EcbRates)
+
+	for rateindex = 0; rateindex < ratelength; rateindex++ {
+
+		if !backtest.EcbRates[rateindex].Published().After(moment) {
+
+			ecbrates = backtest.EcbRates[rateindex]
+
+			return
+		}
+	}
+
+	err = errors.New(strings.Join([]string{`backtest: no ECB reference rates published before`, moment.Format(time.RFC3339)}, ` `))
+
+	return
+}
+
+func (backtest *Backtest) Exchange(venue VenueConfig, symbol string) (replayexchange *ReplayExchange, err error) {
+
+	var pair Pair
+	var found bool
+
+	if pair, found = ExchangePairs[venue.Exchange][symbol]; !found {
+
+		err = errors.New(strings.Join([]string{`backtest: unknown pair`, venue.Exchange, symbol}, ` `))
+
+		return
+	}
+
+	var bookkey string = strings.Join([]string{venue.Exchange, pair.Symbol}, `/`)
+
+	var replaybook *ReplayBook
+
+	if replaybook, found = backtest.Books[bookkey]; !found {
+
+		replaybook = &ReplayBook{Depths: map[int]Depth{}, Updated: map[int]time.Time{}, OrderBook: NewOrderBook()}
+
+		backtest.Books[bookkey] = replaybook
+	}
+
+	replayexchange = &ReplayExchange{Exchange: venue.Exchange, CurrencyPair: pair, ReplayBook: replaybook}
+
+	return
+}
+
+func BacktestTakerFee(venue VenueConfig, credential CredentialConfig, venuename string) (taker float64, err error) {
+
+	if venue.Fees == nil {
+
+		err = errors.New(strings.Join([]string{`backtest: venue`, venuename, `needs static fees`}, ` `))
+
+		return
+	}
+
+	_, taker = venue.Fees.Rates(credential.Volume)
+
+	return
+}
+
+func (replayexchange *ReplayExchange) Name() string {
+
+	return replayexchange.Exchange
+}
+
+func (replayexchange *ReplayExchange) Pair() Pair {
+
+	return replayexchange.CurrencyPair
+}
+
+func (replayexchange *ReplayExchange) GetDepth(ctx context.Context, depthtype int) (depth Depth, err error) {
+
+	var replaybook *ReplayBook = replayexchange.ReplayBook
+
+	var orderbook *OrderBook = replaybook.OrderBook
+
+	var recorded bool
+
+	depth, recorded = replaybook.Depths[depthtype]
+
+	if orderbook.Synced && (!recorded || orderbook.Updated.After(replaybook.Updated[depthtype])) {
+
+		depth = Depth{Type: depthtype, Levels: orderbook.Levels(depthtype)}
+
+	} else if !recorded {
+
+		err = ErrStaleOrderBook
+
+		return
+	}
+
+	depth.BaseCurrency = replayexchange.CurrencyPair.BaseCurrency
+	depth.QuoteCurrency = replayexchange.CurrencyPair.QuoteCurrency
+
+	return
+}
+
+func (replayexchange *ReplayExchange) GetBalance(ctx context.Context, currency string) (balance Decimal, err error) {
+
+	err = ErrReplayUnsupported
+
+	return
+}
+
+func (replayexchange *ReplayExchange) PostLimitOrder(ctx context.Context, order Order) (orderid string, err error) {
+
+	err = ErrReplayUnsupported
+
+	return
+}
+
+func (replayexchange *ReplayExchange) CancelOrder(ctx context.Context, orderid string) (err error) {
+
+	err = ErrReplayUnsupported
+
+	return
+}
+
+func (replayexchange *ReplayExchange) GetOrderStatus(ctx context.Context, orderid string) (orderstatus OrderStatus, err error) {
+
+	err = ErrReplayUnsupported
+
+	return
+}
+
+func (replayexchange *ReplayExchange) GetOrderStatusByClientOrderId(ctx context.Context, clientorderid string) (orderstatus OrderStatus, err error) {
+
+	err = ErrReplayUnsupported
+
+	return
+}
+
+func (replayexchange *ReplayExchange) GetFees(ctx context.Context) (feeschedule FeeSchedule, err error) {
+
+	err = ErrReplayUnsupported
+
+	return
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const BitstampStreamUrl string = `wss://ws.bitstamp.net`
+
+type BitstampStream struct {
+	Url          string
+	Host         string
+	CurrencyPair Pair
+	Channel      string
+	StaleAfter   time.Duration
+	OrderBook    *OrderBook
+	Recorder     *Recorder
+}
+
+type BitstampStreamMessage struct {
+	Event   string          `json:"event"`
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type BitstampStreamSubscription struct {
+	Event string `json:"event"`
+	Data  struct {
+		Channel string `json:"channel"`
+	} `json:"data"`
+}
+
+type BitstampStreamBook struct {
+	Timestamp      string     `json:"timestamp"`
+	Microtimestamp string     `json:"microtimestamp"`
+	Bids           [][]string `json:"bids"`
+	Asks           [][]string `json:"asks"`
+}
+
+func (bitstampstream *BitstampStream) Start() {
+
+	if bitstampstream.Url == `` {
+
+		bitstampstream.Url = BitstampStreamUrl
+	}
+
+	if bitstampstream.StaleAfter == 0 {
+
+		bitstampstream.StaleAfter = 30 * time.Second
+	}
+
+	if bitstampstream.Channel == `` {
+
+		bitstampstream.Channel = `diff_order_book`
+	}
+
+	go RunStream(strings.Join([]string{`bitstamp`, bitstampstream.CurrencyPair.Symbol}, ` `), bitstampstream.OrderBook, bitstampstream.Stream)
+}
+
+func (bitstampstream *BitstampStream) GetDepth(depthtype int) (depth Depth, err error) {
+
+	depth, err = bitstampstream.OrderBook.Depth(depthtype, bitstampstream.CurrencyPair, bitstampstream.StaleAfter)
+
+	return
+}
+
+func (bitstampstream *BitstampStream) Stream() (err error) {
+
+	var websocketconn *WebsocketConn
+
+	if websocketconn, err = DialWebsocket(bitstampstream.Url, nil, 10*time.Second); err != nil {
+
+		return
+	}
+
+	defer websocketconn.Close()
+
+	var channel string = strings.Join([]string{bitstampstream.Channel, bitstampstream.CurrencyPair.Symbol}, `_`)
+
+	var subscription BitstampStreamSubscription = BitstampStreamSubscription{Event: `bts:subscribe`}
+
+	subscription.Data.Channel = channel
+
+	var request []byte
+
+	if request, err = json.Marshal(subscription); err != nil {
+
+		return
+	}
+
+	if err = websocketconn.WriteMessage(WebsocketText, request); err != nil {
+
+		return
+	}
+
+	var heartbeat []byte = []byte(`{"event":"bts:heartbeat"}`)
+
+	var stop chan struct{} = make(chan struct{})
+
+	defer close(stop)
+
+	go func() {
+
+		var ticker *time.Ticker = time.NewTicker(bitstampstream.StaleAfter / 3)
+
+		defer ticker.Stop()
+
+		for {
+
+			select {
+
+			case <-stop:
+
+				return
+
+			case <-ticker.C:
+
+				websocketconn.WriteMessage(WebsocketText, heartbeat)
+			}
+		}
+	}()
+
+	var appliedmicrotimestamp int64 = -1
+
+	for {
+
+		websocketconn.SetReadDeadline(time.Now().Add(bitstampstream.StaleAfter))
+
+		var payload []byte
+
+		if _, payload, err = websocketconn.ReadMessage(); err != nil {
+
+			return
+		}
+
+		var message BitstampStreamMessage
+
+		if err = json.Unmarshal(payload, &message); err != nil {
+
+			return
+		}
+
+		switch message.Event {
+
+		case `bts:subscription_succeeded`:
+
+			log.Printf(`bitstamp stream: subscribed %[1]v`, message.Channel)
+
+			if bitstampstream.Channel != `diff_order_book` {
+
+				continue
+			}
+
+			if appliedmicrotimestamp, err = bitstampstream.Snapshot(); err != nil {
+
+				return
+			}
+
+		case `bts:heartbeat`:
+
+			bitstampstream.OrderBook.Mutex.Lock()
+
+			if bitstampstream.OrderBook.Synced {
+
+				bitstampstream.OrderBook.Updated = time.Now()
+			}
+
+			bitstampstream.OrderBook.Mutex.Unlock()
+
+		case `bts:request_reconnect`:
+
+			err = errors.New(`reconnect requested`)
+
+			return
+
+		case `bts:error`:
+
+			err = errors.New(string(message.Data))
+
+			return
+
+		case `data`:
+
+			var bitstampstreambook BitstampStreamBook
+
+			if err = json.Unmarshal(message.Data, &bitstampstreambook); err != nil {
+
+				return
+			}
+
+			var microtimestamp int64
+
+			if microtimestamp, err = strconv.ParseInt(bitstampstreambook.Microtimestamp, 10, 64); err != nil {
+
+				return
+			}
+
+			if bitstampstream.Channel == `diff_order_book` && microtimestamp <= appliedmicrotimestamp {
+
+				continue
+			}
+
+			if err = bitstampstream.Apply(bitstampstreambook, bitstampstream.Channel != `diff_order_book`); err != nil {
+
+				return
+			}
+
+			appliedmicrotimestamp = microtimestamp
+		}
+	}
+}
+
+func (bitstampstream *BitstampStream) Snapshot() (microtimestamp int64, err error) {
+
+	var bitstamporderbook BitstampOrderBook
+
+	if bitstamporderbook, err = GetBitstampOrderBook(context.Background(), ``, ``, ``, bitstampstream.Host, bitstampstream.CurrencyPair.Symbol); err != nil {
+
+		return
+	}
+
+	if microtimestamp, err = strconv.ParseInt(bitstamporderbook.Microtimestamp, 10, 64); err != nil {
+
+		return
+	}
+
+	err = bitstampstream.Apply(BitstampStreamBook{
+		Timestamp:      bitstamporderbook.Timestamp,
+		Microtimestamp: bitstamporderbook.Microtimestamp,
+		Bids:           bitstamporderbook.Bids,
+		Asks:           bitstamporderbook.Asks,
+	}, true)
+
+	return
+}
+
+func (bitstampstream *BitstampStream) Apply(bitstampstreambook BitstampStreamBook, snapshot bool) (err error) {
+
+	var orderbook *OrderBook = bitstampstream.OrderBook
+
+	orderbook.Mutex.Lock()
+
+	defer orderbook.Mutex.Unlock()
+
+	if snapshot {
+
+		orderbook.Bids = map[string]Level{}
+		orderbook.Asks = map[string]Level{}
+	}
+
+	var sides map[int][][]string = map[int][][]string{
+		Bid: bitstampstreambook.Bids,
+		Ask: bitstampstreambook.Asks,
+	}
+
+	var recorded map[int][]Level = map[int][]Level{}
+
+	var depthtype int
+	var entries [][]string
+
+	for depthtype, entries = range sides {
+
+		var entryindex int = 0
+		var entrylength int = len(entries)
+
+		for entryindex = 0; entryindex < entrylength; entryindex++ {
+
+			var price Decimal
+			var amount Decimal
+
+			if len(entries[entryindex]) < 2 {
+
+				err = errors.New(strings.Join([]string{`bitstamp stream: malformed level`, strings.Join(entries[entryindex], ` `)}, ` `))
+
+				return
+			}
+
+			if price, err = ParseDecimal(entries[entryindex][0]); err != nil {
+
+				return
+			}
+
+			if amount, err = ParseDecimal(entries[entryindex][1]); err != nil {
+
+				return
+			}
+
+			orderbook.Set(depthtype, price, amount)
+
+			recorded[depthtype] = append(recorded[depthtype], Level{QuoteAmount: price, BaseAmount: amount})
+		}
+	}
+
+	var microtimestamp int64
+
+	microtimestamp, _ = strconv.ParseInt(bitstampstreambook.Microtimestamp, 10, 64)
+
+	var kind string = RecordDiff
+
+	if snapshot {
+
+		kind = RecordSnapshot
+	}
+
+	bitstampstream.Recorder.Record(BookRecord{
+		Kind:     kind,
+		Venue:    `bitstamp`,
+		Symbol:   bitstampstream.CurrencyPair.Symbol,
+		Sequence: microtimestamp,
+		Bids:     RecordLevels(recorded[Bid]),
+		Asks:     RecordLevels(recorded[Ask]),
+	})
+
+	orderbook.Synced = true
+	orderbook.Updated = time.Now()
+
+	return
+}
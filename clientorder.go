@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ClientOrderIdLength int = 50
+
+var OrderLookupDelay time.Duration = time.Second
+
+var OrderLookupTimeout time.Duration = 30 * time.Second
+
+var ErrOrderUncertain error = errors.New(`order placement outcome unknown`)
+
+var ErrOrderNotFound error = errors.New(`order not found`)
+
+func NewArbitrageId() string {
+
+	var nonce []byte = make([]byte, 4)
+
+	rand.Reader.Read(nonce)
+
+	return strings.Join([]string{strconv.FormatInt(time.Now().UTC().UnixMilli(), 36), hex.EncodeToString(nonce)}, ``)
+}
+
+func ClientOrderId(account string, arbitrageid string, leg string) (clientorderid string) {
+
+	var prefix []byte = []byte{}
+
+	var index int = 0
+	var length int = len(account)
+
+	for index = 0; index < length && len(prefix) < 16; index++ {
+
+		var character byte = account[index]
+
+		if character >= 'A' && character <= 'Z' {
+
+			character += 'a' - 'A'
+		}
+
+		if character >= 'a' && character <= 'z' || character >= '0' && character <= '9' {
+
+			prefix = append(prefix, character)
+		}
+	}
+
+	clientorderid = strings.Join([]string{string(prefix), arbitrageid, leg}, `-`)
+
+	clientorderid = strings.TrimLeft(clientorderid, `-`)
+
+	if len(clientorderid) > ClientOrderIdLength {
+
+		clientorderid = clientorderid[len(clientorderid)-ClientOrderIdLength:]
+	}
+
+	return
+}
+
+func PlaceOrder(ctx context.Context, exchange Exchange, order Order) (orderid string, err error) {
+
+	if orderid, err = exchange.PostLimitOrder(ctx, order); err == nil || order.ClientOrderId == `` || !errors.Is(err, ErrOrderUncertain) {
+
+		return
+	}
+
+	log.Printf(`Error('%[1]v %[2]v: %[3]v, looking up %[4]v')`, exchange.Name(), order.Side, err, order.ClientOrderId)
+
+	var deadline time.Time = time.Now().Add(OrderLookupTimeout)
+
+	for {
+
+		var orderstatus OrderStatus
+		var lookuperr error
+
+		if lookuperr = Sleep(ctx, OrderLookupDelay); lookuperr != nil {
+
+			err = errors.Join(err, lookuperr)
+
+			return
+		}
+
+		if orderstatus, lookuperr = exchange.GetOrderStatusByClientOrderId(ctx, order.ClientOrderId); lookuperr == nil {
+
+			log.Printf(`deduplicated: %[1]v is order %[2]v`, order.ClientOrderId, orderstatus.Id)
+
+			orderid = orderstatus.Id
+			err = nil
+
+			return
+		}
+
+		if !time.Now().Before(deadline) {
+
+			err = errors.Join(err, lookuperr)
+
+			return
+		}
+
+		log.Printf(`Error('%[1]v lookup %[2]v: %[3]v')`, exchange.Name(), order.ClientOrderId, lookuperr)
+	}
+}
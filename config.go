@@ -0,0 +1,729 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Venues   map[string]VenueConfig `json:"venues"`
+	Strategy StrategyConfig         `json:"strategy"`
+	Accounts []AccountConfig        `json:"accounts"`
+}
+
+type VenueConfig struct {
+	Exchange   string       `json:"exchange"`
+	Host       string       `json:"host"`
+	Fees       *FeeSchedule `json:"fees,omitempty"`
+	FetchFees  bool         `json:"fetchfees,omitempty"`
+	Stream     bool         `json:"stream,omitempty"`
+	StreamUrl  string       `json:"streamurl,omitempty"`
+	StaleAfter Duration     `json:"staleafter,omitempty"`
+	Proxy      string       `json:"proxy,omitempty"`
+	Timeout    Duration     `json:"timeout,omitempty"`
+}
+
+type StrategyConfig struct {
+	ProfitMargin float64      `json:"profitmargin"`
+	ScaleDown    float64      `json:"scaledown,omitempty"`
+	ExecuteTrade bool         `json:"executetrade"`
+	Paper        bool         `json:"paper,omitempty"`
+	Hedge        *HedgeConfig `json:"hedge,omitempty"`
+}
+
+type AccountConfig struct {
+	Name        string                        `json:"name"`
+	Credentials map[string]CredentialConfig   `json:"credentials"`
+	Routes      []RouteConfig                 `json:"routes"`
+	Strategy    *StrategyConfig               `json:"strategy,omitempty"`
+	Paper       map[string]map[string]Decimal `json:"paper,omitempty"`
+}
+
+type CredentialConfig struct {
+	Key      string  `json:"key"`
+	Secret   string  `json:"secret"`
+	Customer string  `json:"customer,omitempty"`
+	Volume   float64 `json:"volume,omitempty"`
+}
+
+type RouteConfig struct {
+	Buy           string  `json:"buy"`
+	BuyPair       string  `json:"buypair"`
+	Sell          string  `json:"sell"`
+	SellPair      string  `json:"sellpair"`
+	Limit         Decimal `json:"limit"`
+	LimitCurrency string  `json:"limitcurrency"`
+}
+
+type Duration struct {
+	time.Duration
+}
+
+type ConfigError struct {
+	Filename string
+	Line     int
+	Column   int
+	Path     string
+	Message  string
+}
+
+func (configerror *ConfigError) Error() string {
+
+	var location string = fmt.Sprintf(`%[1]v:%[2]v:%[3]v`, configerror.Filename, configerror.Line, configerror.Column)
+
+	if configerror.Path == `` {
+
+		return strings.Join([]string{location, configerror.Message}, `: `)
+	}
+
+	return strings.Join([]string{location, configerror.Path, configerror.Message}, `: `)
+}
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+
+	return json.Marshal(duration.String())
+}
+
+func (duration *Duration) UnmarshalJSON(data []byte) (err error) {
+
+	var text string
+
+	if err = json.Unmarshal(data, &text); err != nil {
+
+		return
+	}
+
+	duration.Duration, err = time.ParseDuration(text)
+
+	return
+}
+
+var DefaultVenues map[string]VenueConfig = map[string]VenueConfig{
+	`bitstamp`: {Exchange: `bitstamp`, Host: `www.bitstamp.net`, Fees: &FeeSchedule{Maker: 0.003, Taker: 0.004}},
+	`valr`:     {Exchange: `valr`, Host: `api.valr.com`, Fees: &FeeSchedule{Maker: 0.0, Taker: 0.001}},
+}
+
+func LoadConfig(filename string, content []byte) (config Config, err error) {
+
+	if strings.EqualFold(filepath.Ext(filename), `.csv`) {
+
+		log.Printf(`config: %+[1]v is a legacy accounts csv, use 'algo convert' to migrate it`, filename)
+
+		var accounts [][]string
+
+		if accounts, err = csv.NewReader(bytes.NewReader(content)).ReadAll(); err != nil {
+
+			return
+		}
+
+		config, err = ConvertCsvConfig(accounts, false)
+
+		return
+	}
+
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(content))
+
+	decoder.DisallowUnknownFields()
+
+	if err = decoder.Decode(&config); err != nil {
+
+		var offset int64 = decoder.InputOffset()
+
+		var syntaxerror *json.SyntaxError
+		var typeerror *json.UnmarshalTypeError
+
+		var path string
+
+		if errors.As(err, &syntaxerror) {
+
+			offset = syntaxerror.Offset
+
+		} else if errors.As(err, &typeerror) {
+
+			offset = typeerror.Offset
+			path = typeerror.Field
+		}
+
+		var line int
+		var column int
+
+		line, column = ConfigLineColumn(content, offset)
+
+		err = &ConfigError{Filename: filename, Line: line, Column: column, Path: path, Message: err.Error()}
+
+		return
+	}
+
+	if config.Venues == nil {
+
+		config.Venues = DefaultVenues
+	}
+
+	var positions map[string]int64
+
+	if positions, err = ConfigPositions(content); err != nil {
+
+		return
+	}
+
+	err = ValidateConfig(filename, content, positions, config)
+
+	return
+}
+
+func ValidateConfig(filename string, content []byte, positions map[string]int64, config Config) (err error) {
+
+	var configerrors []error
+
+	var reported map[string]bool = map[string]bool{}
+
+	var report = func(path string, message string) {
+
+		if reported[strings.Join([]string{path, message}, `: `)] {
+
+			return
+		}
+
+		reported[strings.Join([]string{path, message}, `: `)] = true
+
+		var located string = path
+
+		var offset int64
+		var found bool
+
+		for {
+
+			if offset, found = positions[located]; found || located == `` {
+
+				break
+			}
+
+			var separator int = strings.LastIndexAny(located, `.[`)
+
+			if separator < 0 {
+
+				separator = 0
+			}
+
+			located = located[:separator]
+		}
+
+		var line int
+		var column int
+
+		line, column = ConfigLineColumn(content, offset)
+
+		configerrors = append(configerrors, &ConfigError{Filename: filename, Line: line, Column: column, Path: path, Message: message})
+	}
+
+	var venuename string
+	var venue VenueConfig
+
+	for venuename, venue = range config.Venues {
+
+		if _, found := ExchangePairs[venue.Exchange]; !found {
+
+			report(strings.Join([]string{`venues`, venuename, `exchange`}, `.`), fmt.Sprintf(`unknown exchange %[1]q`, venue.Exchange))
+		}
+
+		if venue.Host == `` {
+
+			report(strings.Join([]string{`venues`, venuename, `host`}, `.`), `host is required`)
+
+		} else if scheme, _ := ApiHost(venue.Host); scheme != `https://` && scheme != `http://` {
+
+			report(strings.Join([]string{`venues`, venuename, `host`}, `.`), fmt.Sprintf(`unsupported scheme in host %[1]q`, venue.Host))
+		}
+
+		if venue.StaleAfter.Duration < 0 {
+
+			report(strings.Join([]string{`venues`, venuename, `staleafter`}, `.`), `staleafter must not be negative`)
+		}
+
+		if venue.Timeout.Duration < 0 {
+
+			report(strings.Join([]string{`venues`, venuename, `timeout`}, `.`), `timeout must not be negative`)
+		}
+
+		if venue.Proxy != `` {
+
+			if proxyurl, proxyerr := url.Parse(venue.Proxy); proxyerr != nil || proxyurl.Scheme == `` || proxyurl.Host == `` {
+
+				report(strings.Join([]string{`venues`, venuename, `proxy`}, `.`), fmt.Sprintf(`invalid proxy url %[1]q`, venue.Proxy))
+			}
+		}
+
+		if venue.Fees == nil && !venue.FetchFees {
+
+			report(strings.Join([]string{`venues`, venuename}, `.`), `fees or fetchfees is required`)
+		}
+
+		if venue.Fees != nil {
+
+			var feetiers []FeeTier = append([]FeeTier{{Maker: venue.Fees.Maker, Taker: venue.Fees.Taker}}, venue.Fees.Tiers...)
+
+			var tierindex int = 0
+			var tierlength int = len(feetiers)
+
+			for tierindex = 0; tierindex < tierlength; tierindex++ {
+
+				var feetier FeeTier = feetiers[tierindex]
+
+				if feetier.Maker <= -1.0 || feetier.Maker >= 1.0 || feetier.Taker < 0.0 || feetier.Taker >= 1.0 {
+
+					report(strings.Join([]string{`venues`, venuename, `fees`}, `.`), `fee rates must be fractions, taker in [0, 1) and maker in (-1, 1)`)
+				}
+			}
+		}
+	}
+
+	ValidateStrategy(`strategy`, config.Strategy, report)
+
+	if len(config.Accounts) == 0 {
+
+		report(`accounts`, `at least one account is required`)
+	}
+
+	var names map[string]bool = map[string]bool{}
+
+	var accountindex int = 0
+	var accountlength int = len(config.Accounts)
+
+	for accountindex = 0; accountindex < accountlength; accountindex++ {
+
+		var account AccountConfig = config.Accounts[accountindex]
+
+		var accountpath string = fmt.Sprintf(`accounts[%[1]v]`, accountindex)
+
+		if account.Name == `` {
+
+			report(strings.Join([]string{accountpath, `name`}, `.`), `name is required`)
+
+		} else if names[account.Name] {
+
+			report(strings.Join([]string{accountpath, `name`}, `.`), fmt.Sprintf(`duplicate account name %[1]q`, account.Name))
+		}
+
+		names[account.Name] = true
+
+		if account.Strategy != nil {
+
+			ValidateStrategy(strings.Join([]string{accountpath, `strategy`}, `.`), *account.Strategy, report)
+		}
+
+		var papervenue string
+		var paperbalances map[string]Decimal
+
+		for papervenue, paperbalances = range account.Paper {
+
+			if _, found := config.Venues[papervenue]; !found {
+
+				report(strings.Join([]string{accountpath, `paper`, papervenue}, `.`), fmt.Sprintf(`unknown venue %[1]q`, papervenue))
+			}
+
+			var currency string
+			var balance Decimal
+
+			for currency, balance = range paperbalances {
+
+				if balance.Sign() < 0 {
+
+					report(strings.Join([]string{accountpath, `paper`, papervenue, currency}, `.`), `paper balance must not be negative`)
+				}
+			}
+		}
+
+		if len(account.Routes) == 0 {
+
+			report(strings.Join([]string{accountpath, `routes`}, `.`), `at least one route is required`)
+		}
+
+		var routeindex int = 0
+		var routelength int = len(account.Routes)
+
+		for routeindex = 0; routeindex < routelength; routeindex++ {
+
+			var route RouteConfig = account.Routes[routeindex]
+
+			var routepath string = fmt.Sprintf(`%[1]v.routes[%[2]v]`, accountpath, routeindex)
+
+			var legs [][3]string = [][3]string{
+				{`buy`, route.Buy, route.BuyPair},
+				{`sell`, route.Sell, route.SellPair},
+			}
+
+			var leg [3]string
+
+			for _, leg = range legs {
+
+				var found bool
+
+				if venue, found = config.Venues[leg[1]]; !found {
+
+					report(strings.Join([]string{routepath, leg[0]}, `.`), fmt.Sprintf(`unknown venue %[1]q`, leg[1]))
+
+					continue
+				}
+
+				if _, found = ExchangePairs[venue.Exchange][leg[2]]; !found {
+
+					report(strings.Join([]string{routepath, strings.Join([]string{leg[0], `pair`}, ``)}, `.`), fmt.Sprintf(`unknown %[1]v pair %[2]q`, venue.Exchange, leg[2]))
+				}
+
+				var credential CredentialConfig
+
+				if credential, found = account.Credentials[leg[1]]; !found || credential.Key == `` || credential.Secret == `` {
+
+					report(strings.Join([]string{accountpath, `credentials`}, `.`), fmt.Sprintf(`key and secret are required for venue %[1]q`, leg[1]))
+
+				} else if venue.Exchange == `bitstamp` && credential.Customer == `` {
+
+					report(strings.Join([]string{accountpath, `credentials`, leg[1]}, `.`), `customer is required for bitstamp`)
+				}
+			}
+
+			if route.Buy == route.Sell && route.BuyPair == route.SellPair {
+
+				report(routepath, `buy and sell legs are identical`)
+			}
+
+			if route.Limit.Sign() <= 0 {
+
+				report(strings.Join([]string{routepath, `limit`}, `.`), `limit must be positive`)
+			}
+
+			if route.LimitCurrency == `` {
+
+				report(strings.Join([]string{routepath, `limitcurrency`}, `.`), `limitcurrency is required`)
+			}
+		}
+	}
+
+	err = errors.Join(configerrors...)
+
+	return
+}
+
+func ValidateStrategy(path string, strategy StrategyConfig, report func(string, string)) {
+
+	if strategy.ProfitMargin < 0.0 || strategy.ProfitMargin >= 1.0 {
+
+		report(strings.Join([]string{path, `profitmargin`}, `.`), `profitmargin must be in [0, 1)`)
+	}
+
+	if strategy.ScaleDown < 0.0 || strategy.ScaleDown > 1.0 {
+
+		report(strings.Join([]string{path, `scaledown`}, `.`), `scaledown must be in [0, 1]`)
+	}
+
+	if strategy.Hedge != nil {
+
+		if strategy.Hedge.Mode != HedgeRehedge && strategy.Hedge.Mode != HedgeAlert {
+
+			report(strings.Join([]string{path, `hedge`, `mode`}, `.`), fmt.Sprintf(`hedge mode must be %[1]q or %[2]q`, HedgeRehedge, HedgeAlert))
+		}
+
+		if strategy.Hedge.Aggressiveness < 0.0 || strategy.Hedge.Aggressiveness >= 0.1 {
+
+			report(strings.Join([]string{path, `hedge`, `aggressiveness`}, `.`), `aggressiveness must be in [0, 0.1)`)
+		}
+
+		if strategy.Hedge.Attempts < 0 {
+
+			report(strings.Join([]string{path, `hedge`, `attempts`}, `.`), `attempts must not be negative`)
+		}
+
+		if strategy.Hedge.Settle.Duration < 0 {
+
+			report(strings.Join([]string{path, `hedge`, `settle`}, `.`), `settle must not be negative`)
+		}
+
+		if strategy.Hedge.Timeout.Duration < 0 {
+
+			report(strings.Join([]string{path, `hedge`, `timeout`}, `.`), `timeout must not be negative`)
+		}
+	}
+
+	if strategy.Paper && strategy.ExecuteTrade {
+
+		report(strings.Join([]string{path, `paper`}, `.`), `paper and executetrade are mutually exclusive`)
+	}
+}
+
+func (config Config) AccountStrategy(account AccountConfig) (strategy StrategyConfig) {
+
+	strategy = config.Strategy
+
+	if account.Strategy != nil {
+
+		strategy = *account.Strategy
+	}
+
+	return
+}
+
+func (strategy StrategyConfig) HedgeConfig() (hedgeconfig HedgeConfig) {
+
+	hedgeconfig = DefaultHedgeConfig
+
+	if strategy.Hedge == nil {
+
+		return
+	}
+
+	hedgeconfig.Mode = strategy.Hedge.Mode
+	hedgeconfig.Aggressiveness = strategy.Hedge.Aggressiveness
+	hedgeconfig.Webhook = strategy.Hedge.Webhook
+
+	if strategy.Hedge.Attempts > 0 {
+
+		hedgeconfig.Attempts = strategy.Hedge.Attempts
+	}
+
+	if strategy.Hedge.Settle.Duration > 0 {
+
+		hedgeconfig.Settle = strategy.Hedge.Settle
+	}
+
+	if strategy.Hedge.Timeout.Duration > 0 {
+
+		hedgeconfig.Timeout = strategy.Hedge.Timeout
+	}
+
+	return
+}
+
+func ConfigPositions(content []byte) (positions map[string]int64, err error) {
+
+	positions = map[string]int64{}
+
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(content))
+
+	err = WalkConfigPositions(decoder, content, ``, positions)
+
+	return
+}
+
+func WalkConfigPositions(decoder *json.Decoder, content []byte, path string, positions map[string]int64) (err error) {
+
+	if _, found := positions[path]; !found {
+
+		positions[path] = SkipJsonSeparators(content, decoder.InputOffset())
+	}
+
+	var token json.Token
+
+	if token, err = decoder.Token(); err != nil {
+
+		return
+	}
+
+	var delimiter json.Delim
+	var isdelimiter bool
+
+	if delimiter, isdelimiter = token.(json.Delim); !isdelimiter {
+
+		return
+	}
+
+	var index int = 0
+
+	for index = 0; decoder.More(); index++ {
+
+		var childpath string = fmt.Sprintf(`%[1]v[%[2]v]`, path, index)
+
+		if delimiter == '{' {
+
+			var keyoffset int64 = SkipJsonSeparators(content, decoder.InputOffset())
+
+			var keytoken json.Token
+
+			if keytoken, err = decoder.Token(); err != nil {
+
+				return
+			}
+
+			childpath = strings.TrimPrefix(strings.Join([]string{path, keytoken.(string)}, `.`), `.`)
+
+			positions[childpath] = keyoffset
+		}
+
+		if err = WalkConfigPositions(decoder, content, childpath, positions); err != nil {
+
+			return
+		}
+	}
+
+	_, err = decoder.Token()
+
+	return
+}
+
+func SkipJsonSeparators(content []byte, offset int64) int64 {
+
+	for offset < int64(len(content)) && strings.IndexByte(" \t\r\n,:", content[offset]) >= 0 {
+
+		offset++
+	}
+
+	return offset
+}
+
+func ConfigLineColumn(content []byte, offset int64) (line int, column int) {
+
+	if offset > int64(len(content)) {
+
+		offset = int64(len(content))
+	}
+
+	var preceding []byte = content[:offset]
+
+	line = bytes.Count(preceding, []byte{'\n'}) + 1
+	column = int(offset) - bytes.LastIndexByte(preceding, '\n')
+
+	return
+}
+
+func RunConvert(arguments []string) (err error) {
+
+	var flagset *flag.FlagSet = flag.NewFlagSet(`convert`, flag.ContinueOnError)
+
+	var reverse bool
+
+	flagset.BoolVar(&reverse, `reverse`, false, `also add the reverse route, buying on valr and selling on bitstamp, which the csv never traded`)
+
+	flagset.Usage = func() {
+
+		fmt.Fprintln(flagset.Output(), `usage: algo convert [-reverse] accounts.csv`)
+
+		flagset.PrintDefaults()
+	}
+
+	if err = flagset.Parse(arguments); err != nil {
+
+		if !errors.Is(err, flag.ErrHelp) {
+
+			err = fmt.Errorf(`%[1]w: %[2]w`, ErrUsage, err)
+		}
+
+		return
+	}
+
+	if flagset.NArg() != 1 {
+
+		flagset.Usage()
+
+		err = fmt.Errorf(`%[1]w: convert needs exactly one accounts csv`, ErrUsage)
+
+		return
+	}
+
+	var accounts [][]string
+
+	if accounts, err = ReadCsv(flagset.Arg(0)); err != nil {
+
+		return
+	}
+
+	var config Config
+
+	if config, err = ConvertCsvConfig(accounts, reverse); err != nil {
+
+		return
+	}
+
+	err = WriteConfig(os.Stdout, config)
+
+	return
+}
+
+func ConvertCsvConfig(accounts [][]string, reverse bool) (config Config, err error) {
+
+	config = Config{
+		Venues:   DefaultVenues,
+		Accounts: []AccountConfig{},
+	}
+
+	var index int = 0
+
+	for index = range accounts {
+
+		var account []string = accounts[index]
+
+		if len(account) < 8 {
+
+			err = fmt.Errorf(`csv line %[1]v: expected 8 columns, found %[2]v`, index+1, len(account))
+
+			return
+		}
+
+		var strategy StrategyConfig
+
+		var dollarlimit Decimal
+
+		if dollarlimit, err = ParseDecimal(account[5]); err != nil {
+
+			err = fmt.Errorf(`csv line %[1]v: dollar limit: %[2]w`, index+1, err)
+
+			return
+		}
+
+		if strategy.ProfitMargin, err = strconv.ParseFloat(account[6], 64); err != nil {
+
+			err = fmt.Errorf(`csv line %[1]v: profit margin: %[2]w`, index+1, err)
+
+			return
+		}
+
+		if strategy.ExecuteTrade, err = strconv.ParseBool(account[7]); err != nil {
+
+			err = fmt.Errorf(`csv line %[1]v: execute trade: %[2]w`, index+1, err)
+
+			return
+		}
+
+		var routes []RouteConfig = []RouteConfig{
+			{Buy: `bitstamp`, BuyPair: BitstampBtcUsd.Symbol, Sell: `valr`, SellPair: ValrBtcZar.Symbol, Limit: dollarlimit, LimitCurrency: `usd`},
+		}
+
+		if reverse {
+
+			routes = append(routes, RouteConfig{Buy: `valr`, BuyPair: ValrBtcZar.Symbol, Sell: `bitstamp`, SellPair: BitstampBtcUsd.Symbol, Limit: dollarlimit, LimitCurrency: `usd`})
+		}
+
+		config.Accounts = append(config.Accounts, AccountConfig{
+			Name: fmt.Sprintf(`account%[1]v`, index+1),
+			Credentials: map[string]CredentialConfig{
+				`bitstamp`: {Key: account[0], Secret: account[1], Customer: account[2]},
+				`valr`:     {Key: account[3], Secret: account[4]},
+			},
+			Routes:   routes,
+			Strategy: &strategy,
+		})
+	}
+
+	return
+}
+
+func WriteConfig(writer io.Writer, config Config) (err error) {
+
+	var encoder *json.Encoder = json.NewEncoder(writer)
+
+	encoder.SetIndent(``, `	`)
+
+	err = encoder.Encode(config)
+
+	return
+}
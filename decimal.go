@@ -0,0 +1,366 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+type Decimal struct {
+	coefficient *big.Int
+	scale       int32
+}
+
+var DecimalZero Decimal = Decimal{}
+
+var DecimalOne Decimal = NewDecimal(1, 0)
+
+func NewDecimal(coefficient int64, scale int32) Decimal {
+
+	return Decimal{coefficient: big.NewInt(coefficient), scale: scale}
+}
+
+func DecimalFromFloat(value float64) (decimal Decimal) {
+
+	decimal, _ = ParseDecimal(strconv.FormatFloat(value, 'f', -1, 64))
+
+	return
+}
+
+func ParseDecimal(text string) (decimal Decimal, err error) {
+
+	var mantissa string = strings.TrimSpace(text)
+	var exponent int64 = 0
+
+	if index := strings.IndexAny(mantissa, `eE`); index >= 0 {
+
+		if exponent, err = strconv.ParseInt(mantissa[index+1:], 10, 32); err != nil {
+
+			err = ParseError(err)
+
+			return
+		}
+
+		mantissa = mantissa[:index]
+	}
+
+	var integer string = mantissa
+	var fraction string = ``
+
+	if index := strings.IndexByte(mantissa, '.'); index >= 0 {
+
+		integer = mantissa[:index]
+		fraction = mantissa[index+1:]
+	}
+
+	var coefficient *big.Int = new(big.Int)
+
+	if _, parsed := coefficient.SetString(strings.Join([]string{integer, fraction}, ``), 10); !parsed {
+
+		err = ParseError(errors.New(strings.Join([]string{`decimal: invalid syntax`, strconv.Quote(text)}, ` `)))
+
+		return
+	}
+
+	var scale int64 = int64(len(fraction)) - exponent
+
+	if scale < 0 {
+
+		coefficient.Mul(coefficient, DecimalPower(-scale))
+
+		scale = 0
+	}
+
+	decimal = Decimal{coefficient: coefficient, scale: int32(scale)}
+
+	return
+}
+
+func MustParseDecimal(text string) (decimal Decimal) {
+
+	var err error
+
+	if decimal, err = ParseDecimal(text); err != nil {
+
+		panic(err)
+	}
+
+	return
+}
+
+func DecimalPower(exponent int64) *big.Int {
+
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(exponent), nil)
+}
+
+func (decimal Decimal) Coefficient() *big.Int {
+
+	if decimal.coefficient == nil {
+
+		return new(big.Int)
+	}
+
+	return new(big.Int).Set(decimal.coefficient)
+}
+
+func (decimal Decimal) Scale() uint {
+
+	return uint(decimal.scale)
+}
+
+func (decimal Decimal) Rescale(scale int32) *big.Int {
+
+	var coefficient *big.Int = decimal.Coefficient()
+
+	if scale > decimal.scale {
+
+		coefficient.Mul(coefficient, DecimalPower(int64(scale-decimal.scale)))
+	}
+
+	return coefficient
+}
+
+func (decimal Decimal) Add(addend Decimal) Decimal {
+
+	var scale int32 = max(decimal.scale, addend.scale)
+
+	var sum *big.Int = decimal.Rescale(scale)
+
+	sum.Add(sum, addend.Rescale(scale))
+
+	return Decimal{coefficient: sum, scale: scale}
+}
+
+func (decimal Decimal) Sub(subtrahend Decimal) Decimal {
+
+	return decimal.Add(subtrahend.Neg())
+}
+
+func (decimal Decimal) Mul(multiplier Decimal) Decimal {
+
+	var product *big.Int = decimal.Coefficient()
+
+	product.Mul(product, multiplier.Coefficient())
+
+	return Decimal{coefficient: product, scale: decimal.scale + multiplier.scale}
+}
+
+func (decimal Decimal) Div(divisor Decimal, places uint) Decimal {
+
+	if divisor.IsZero() {
+
+		panic(`decimal: division by zero`)
+	}
+
+	var numerator *big.Int = decimal.Coefficient()
+	var denominator *big.Int = divisor.Coefficient()
+
+	var exponent int64 = int64(places) + int64(divisor.scale) - int64(decimal.scale)
+
+	if exponent >= 0 {
+
+		numerator.Mul(numerator, DecimalPower(exponent))
+
+	} else {
+
+		denominator.Mul(denominator, DecimalPower(-exponent))
+	}
+
+	return Decimal{coefficient: DecimalQuotient(numerator, denominator, true), scale: int32(places)}
+}
+
+func DecimalQuotient(numerator *big.Int, denominator *big.Int, round bool) *big.Int {
+
+	var remainder *big.Int = new(big.Int)
+
+	var quotient *big.Int = new(big.Int)
+
+	quotient.QuoRem(numerator, denominator, remainder)
+
+	if round && new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(new(big.Int).Abs(denominator)) >= 0 {
+
+		quotient.Add(quotient, big.NewInt(int64(numerator.Sign()*denominator.Sign())))
+	}
+
+	return quotient
+}
+
+func (decimal Decimal) Round(places uint) Decimal {
+
+	if decimal.scale <= int32(places) {
+
+		return decimal
+	}
+
+	return Decimal{coefficient: DecimalQuotient(decimal.Coefficient(), DecimalPower(int64(decimal.scale)-int64(places)), true), scale: int32(places)}
+}
+
+func (decimal Decimal) Truncate(places uint) Decimal {
+
+	if decimal.scale <= int32(places) {
+
+		return decimal
+	}
+
+	return Decimal{coefficient: DecimalQuotient(decimal.Coefficient(), DecimalPower(int64(decimal.scale)-int64(places)), false), scale: int32(places)}
+}
+
+func (decimal Decimal) Normalize() Decimal {
+
+	var coefficient *big.Int = decimal.Coefficient()
+	var scale int32 = decimal.scale
+
+	var remainder *big.Int = new(big.Int)
+	var quotient *big.Int = new(big.Int)
+
+	for scale > 0 && coefficient.Sign() != 0 {
+
+		if quotient.QuoRem(coefficient, big.NewInt(10), remainder); remainder.Sign() != 0 {
+
+			break
+		}
+
+		coefficient.Set(quotient)
+
+		scale -= 1
+	}
+
+	if coefficient.Sign() == 0 {
+
+		scale = 0
+	}
+
+	return Decimal{coefficient: coefficient, scale: scale}
+}
+
+func (decimal Decimal) Neg() Decimal {
+
+	var negated *big.Int = decimal.Coefficient()
+
+	return Decimal{coefficient: negated.Neg(negated), scale: decimal.scale}
+}
+
+func (decimal Decimal) Abs() Decimal {
+
+	var absolute *big.Int = decimal.Coefficient()
+
+	return Decimal{coefficient: absolute.Abs(absolute), scale: decimal.scale}
+}
+
+func (decimal Decimal) Cmp(other Decimal) int {
+
+	var scale int32 = max(decimal.scale, other.scale)
+
+	return decimal.Rescale(scale).Cmp(other.Rescale(scale))
+}
+
+func (decimal Decimal) Sign() int {
+
+	if decimal.coefficient == nil {
+
+		return 0
+	}
+
+	return decimal.coefficient.Sign()
+}
+
+func (decimal Decimal) IsZero() bool {
+
+	return decimal.Sign() == 0
+}
+
+func (decimal Decimal) Equal(other Decimal) bool {
+
+	return decimal.Cmp(other) == 0
+}
+
+func (decimal Decimal) LessThan(other Decimal) bool {
+
+	return decimal.Cmp(other) < 0
+}
+
+func (decimal Decimal) GreaterThan(other Decimal) bool {
+
+	return decimal.Cmp(other) > 0
+}
+
+func MinDecimal(first Decimal, second Decimal) Decimal {
+
+	if second.LessThan(first) {
+
+		return second
+	}
+
+	return first
+}
+
+func MaxDecimal(first Decimal, second Decimal) Decimal {
+
+	if second.GreaterThan(first) {
+
+		return second
+	}
+
+	return first
+}
+
+func (decimal Decimal) Float64() (value float64) {
+
+	value, _ = strconv.ParseFloat(decimal.String(), 64)
+
+	return
+}
+
+func (decimal Decimal) String() string {
+
+	var digits string = new(big.Int).Abs(decimal.Coefficient()).String()
+
+	if decimal.scale > 0 {
+
+		if len(digits) <= int(decimal.scale) {
+
+			digits = strings.Join([]string{strings.Repeat(`0`, int(decimal.scale)-len(digits)+1), digits}, ``)
+		}
+
+		digits = strings.Join([]string{digits[:len(digits)-int(decimal.scale)], digits[len(digits)-int(decimal.scale):]}, `.`)
+	}
+
+	if decimal.Sign() < 0 {
+
+		digits = strings.Join([]string{`-`, digits}, ``)
+	}
+
+	return digits
+}
+
+func (decimal Decimal) StringFixed(places uint) string {
+
+	var rounded Decimal = decimal.Round(places)
+
+	return Decimal{coefficient: rounded.Rescale(int32(places)), scale: int32(places)}.String()
+}
+
+func (decimal Decimal) MarshalJSON() ([]byte, error) {
+
+	return []byte(strconv.Quote(decimal.String())), nil
+}
+
+func (decimal *Decimal) UnmarshalJSON(data []byte) (err error) {
+
+	var text string = string(data)
+
+	if text == `null` {
+
+		return
+	}
+
+	if unquoted, unquoteerr := strconv.Unquote(text); unquoteerr == nil {
+
+		text = unquoted
+	}
+
+	*decimal, err = ParseDecimal(text)
+
+	return
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const EcbDailyUrl string = `https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml`
+
+const EcbHistoryUrl string = `https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist.xml`
+
+const EcbPublicationOffset time.Duration = 15 * time.Hour
+
+type EcbClient struct {
+	Url        string
+	CachePath  string
+	MaxAge     time.Duration
+	HttpClient *http.Client
+	Rates      []EcbRates
+	Fetched    time.Time
+}
+
+type EcbRates struct {
+	Date  time.Time
+	Rates map[string]float64
+}
+
+type EcbEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Subject string   `xml:"subject"`
+	Sender  string   `xml:"Sender>name"`
+	Days    []EcbDay `xml:"Cube>Cube"`
+}
+
+type EcbDay struct {
+	Time  string    `xml:"time,attr"`
+	Rates []EcbRate `xml:"Cube"`
+}
+
+type EcbRate struct {
+	Currency string `xml:"currency,attr"`
+	Rate     string `xml:"rate,attr"`
+}
+
+func (ecbclient *EcbClient) GetRates() (ecbrates []EcbRates, err error) {
+
+	if ecbclient.Rates != nil && time.Since(ecbclient.Fetched) < ecbclient.MaxAge {
+
+		ecbrates = ecbclient.Rates
+
+		return
+	}
+
+	var document []byte
+
+	var fileinfo os.FileInfo
+
+	if ecbclient.CachePath != `` {
+
+		if fileinfo, err = os.Stat(ecbclient.CachePath); err == nil && time.Since(fileinfo.ModTime()) < ecbclient.MaxAge {
+
+			document, err = os.ReadFile(ecbclient.CachePath)
+		}
+	}
+
+	if document == nil {
+
+		if document, err = ecbclient.Fetch(); err != nil {
+
+			if ecbclient.CachePath == `` {
+
+				return
+			}
+
+			log.Printf(`Error('%+[1]v')`, err.Error())
+
+			if document, err = os.ReadFile(ecbclient.CachePath); err != nil {
+
+				return
+			}
+
+			log.Printf(`ecb: using stale cache %+[1]v`, ecbclient.CachePath)
+
+		} else if ecbclient.CachePath != `` {
+
+			if err = WriteFileAtomic(ecbclient.CachePath, document); err != nil {
+
+				return
+			}
+		}
+	}
+
+	if ecbrates, err = ParseEcbRates(document); err != nil {
+
+		return
+	}
+
+	if ecbclient.Rates == nil || !ecbclient.Rates[0].Date.Equal(ecbrates[0].Date) {
+
+		log.Printf(`ecb: reference rates for %+[1]v`, ecbrates[0].Date.Format(time.DateOnly))
+	}
+
+	ecbclient.Rates = ecbrates
+	ecbclient.Fetched = time.Now()
+
+	return
+}
+
+func (ecbclient *EcbClient) GetLatestRates() (ecbrates EcbRates, err error) {
+
+	var ecbrateslist []EcbRates
+
+	if ecbrateslist, err = ecbclient.GetRates(); err != nil {
+
+		return
+	}
+
+	ecbrates = ecbrateslist[0]
+
+	return
+}
+
+func (ecbclient *EcbClient) Fetch() (document []byte, err error) {
+
+	if !strings.HasPrefix(ecbclient.Url, `http://`) && !strings.HasPrefix(ecbclient.Url, `https://`) {
+
+		document, err = os.ReadFile(ecbclient.Url)
+
+		return
+	}
+
+	var httpclient *http.Client = ecbclient.HttpClient
+
+	if httpclient == nil {
+
+		httpclient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	var httpresponse *http.Response
+
+	if httpresponse, err = httpclient.Get(ecbclient.Url); err != nil {
+
+		return
+	}
+
+	defer httpresponse.Body.Close()
+
+	var responsebuffer *bytes.Buffer = new(bytes.Buffer)
+
+	if _, err = responsebuffer.ReadFrom(httpresponse.Body); err != nil {
+
+		return
+	}
+
+	if httpresponse.StatusCode != http.StatusOK {
+
+		err = errors.New(strings.Join([]string{`ecb:`, httpresponse.Status, ecbclient.Url}, ` `))
+
+		return
+	}
+
+	document = responsebuffer.Bytes()
+
+	return
+}
+
+func ParseEcbRates(document []byte) (ecbrates []EcbRates, err error) {
+
+	var ecbenvelope EcbEnvelope
+
+	if err = xml.Unmarshal(document, &ecbenvelope); err != nil {
+
+		return
+	}
+
+	if len(ecbenvelope.Days) == 0 {
+
+		err = errors.New(`ecb: document contains no reference rates`)
+
+		return
+	}
+
+	var dayindex int = 0
+	var daylength int = len(ecbenvelope.Days)
+
+	for dayindex = 0; dayindex < daylength; dayindex++ {
+
+		var ecbday EcbDay = ecbenvelope.Days[dayindex]
+
+		var rates EcbRates = EcbRates{
+			Rates: map[string]float64{`EUR`: 1.0},
+		}
+
+		if rates.Date, err = time.Parse(time.DateOnly, ecbday.Time); err != nil {
+
+			return
+		}
+
+		var rateindex int = 0
+		var ratelength int = len(ecbday.Rates)
+
+		for rateindex = 0; rateindex < ratelength; rateindex++ {
+
+			var rate float64
+
+			if rate, err = strconv.ParseFloat(ecbday.Rates[rateindex].Rate, 64); err != nil {
+
+				return
+			}
+
+			if math.IsNaN(rate) || math.IsInf(rate, 0) || rate <= 0 {
+
+				err = errors.New(strings.Join([]string{`ecb: invalid reference rate`, ecbday.Rates[rateindex].Rate, `for`, ecbday.Rates[rateindex].Currency, `on`, ecbday.Time}, ` `))
+
+				return
+			}
+
+			rates.Rates[strings.ToUpper(ecbday.Rates[rateindex].Currency)] = rate
+		}
+
+		ecbrates = append(ecbrates, rates)
+	}
+
+	sort.Slice(ecbrates, func(i int, j int) bool { return ecbrates[i].Date.After(ecbrates[j].Date) })
+
+	return
+}
+
+func (ecbrates EcbRates) Published() time.Time {
+
+	return ecbrates.Date.Add(EcbPublicationOffset)
+}
+
+func (ecbrates EcbRates) Rate(fromcurrency string, tocurrency string) (rate float64, err error) {
+
+	var fromrate float64
+	var torate float64
+	var found bool
+
+	if fromrate, found = ecbrates.Rates[strings.ToUpper(fromcurrency)]; !found {
+
+		err = errors.New(strings.Join([]string{`ecb: no reference rate for`, fromcurrency}, ` `))
+
+		return
+	}
+
+	if torate, found = ecbrates.Rates[strings.ToUpper(tocurrency)]; !found {
+
+		err = errors.New(strings.Join([]string{`ecb: no reference rate for`, tocurrency}, ` `))
+
+		return
+	}
+
+	rate = torate / fromrate
+
+	if math.IsNaN(rate) || math.IsInf(rate, 0) || rate <= 0 {
+
+		err = errors.New(strings.Join([]string{`ecb: invalid rate from`, fromcurrency, `to`, tocurrency}, ` `))
+
+		rate = 0
+	}
+
+	return
+}
+
+func WriteFileAtomic(filename string, content []byte) (err error) {
+
+	var file *os.File
+
+	if file, err = os.CreateTemp(filepath.Dir(filename), strings.Join([]string{`.`, filepath.Base(filename), `.*`}, ``)); err != nil {
+
+		return
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(content); err != nil {
+
+		file.Close()
+
+		return
+	}
+
+	if err = file.Close(); err != nil {
+
+		return
+	}
+
+	err = os.Rename(file.Name(), filename)
+
+	return
+}
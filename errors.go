@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	ActionRetry       = `retry`
+	ActionSkipRoute   = `skiproute`
+	ActionSkipAccount = `skipaccount`
+	ActionHalt        = `halt`
+)
+
+var (
+	ErrNetwork           error = errors.New(`network error`)
+	ErrAuth              error = errors.New(`authentication error`)
+	ErrRateLimit         error = errors.New(`rate limited`)
+	ErrInsufficientFunds error = errors.New(`insufficient funds`)
+	ErrInvalidOrder      error = errors.New(`invalid order`)
+	ErrParse             error = errors.New(`parse error`)
+	ErrExchange          error = errors.New(`exchange error`)
+	ErrInterrupted       error = errors.New(`arbitrage interrupted with orders placed`)
+	ErrStopping          error = errors.New(`stopping`)
+	ErrUsage             error = errors.New(`usage error`)
+)
+
+var ErrorKinds []error = []error{ErrInterrupted, ErrNetwork, ErrAuth, ErrRateLimit, ErrInsufficientFunds, ErrInvalidOrder, ErrParse, ErrStaleOrderBook, ErrExchange}
+
+type ApiError struct {
+	Venue   string
+	Method  string
+	Path    string
+	Status  int
+	Kind    error
+	Message string
+}
+
+func NewApiError(venue string, method string, path string, status int, message string, transport bool) *ApiError {
+
+	var apierror *ApiError = &ApiError{
+		Venue:   venue,
+		Method:  method,
+		Path:    path,
+		Status:  status,
+		Message: strings.TrimSpace(message),
+	}
+
+	if transport {
+
+		apierror.Kind = ErrNetwork
+
+		return apierror
+	}
+
+	apierror.Kind = ClassifyApiError(status, message)
+
+	return apierror
+}
+
+func ClassifyApiError(status int, message string) error {
+
+	var lower string = strings.ToLower(message)
+
+	var contains func(...string) bool = func(fragments ...string) bool {
+
+		var fragmentindex int = 0
+		var fragmentlength int = len(fragments)
+
+		for fragmentindex = 0; fragmentindex < fragmentlength; fragmentindex++ {
+
+			if strings.Contains(lower, fragments[fragmentindex]) {
+
+				return true
+			}
+		}
+
+		return false
+	}
+
+	switch {
+
+	case status == 401 || status == 403 || contains(`api key`, `signature`, `unauthori`, `permission`, `invalid nonce`):
+
+		return ErrAuth
+
+	case status == 429 || contains(`rate limit`, `ratelimit`, `too many requests`):
+
+		return ErrRateLimit
+
+	case contains(`insufficient`, `not enough`, `you have only`, `exceeds available`):
+
+		return ErrInsufficientFunds
+
+	case status >= 500:
+
+		return ErrExchange
+
+	case status == 400 || status == 422 || contains(`minimum`, `invalid`, `precision`):
+
+		return ErrInvalidOrder
+	}
+
+	return ErrExchange
+}
+
+func (apierror *ApiError) Error() string {
+
+	if apierror.Status == 0 {
+
+		return fmt.Sprintf(`%[1]v: %[2]v: %[3]v %[4]v: %[5]v`, apierror.Venue, apierror.Kind, apierror.Method, apierror.Path, apierror.Message)
+	}
+
+	return fmt.Sprintf(`%[1]v: %[2]v: %[3]v %[4]v: %[5]v %[6]v`, apierror.Venue, apierror.Kind, apierror.Method, apierror.Path, apierror.Status, apierror.Message)
+}
+
+func (apierror *ApiError) Unwrap() error {
+
+	return apierror.Kind
+}
+
+func ParseError(err error) error {
+
+	if err == nil || errors.Is(err, ErrParse) {
+
+		return err
+	}
+
+	return fmt.Errorf(`%[1]w: %[2]w`, ErrParse, err)
+}
+
+func ErrorKind(err error) string {
+
+	var kindindex int = 0
+	var kindlength int = len(ErrorKinds)
+
+	for kindindex = 0; kindindex < kindlength; kindindex++ {
+
+		if errors.Is(err, ErrorKinds[kindindex]) {
+
+			return ErrorKinds[kindindex].Error()
+		}
+	}
+
+	return `other`
+}
+
+func ErrorAction(err error) string {
+
+	switch {
+
+	case errors.Is(err, ErrInterrupted):
+
+		return ActionHalt
+
+	case errors.Is(err, ErrAuth), errors.Is(err, ErrRateLimit):
+
+		return ActionSkipAccount
+
+	case errors.Is(err, ErrNetwork), errors.Is(err, ErrExchange), errors.Is(err, ErrStaleOrderBook):
+
+		return ActionRetry
+	}
+
+	return ActionSkipRoute
+}
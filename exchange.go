@@ -0,0 +1,777 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	Buy  = `BUY`
+	Sell = `SELL`
+)
+
+const (
+	OrderOpen            = `OPEN`
+	OrderFilled          = `FILLED`
+	OrderPartiallyFilled = `PARTIALLY_FILLED`
+	OrderCancelled       = `CANCELLED`
+	OrderFailed          = `FAILED`
+)
+
+type Exchange interface {
+	Name() string
+	Pair() Pair
+	GetDepth(ctx context.Context, depthtype int) (depth Depth, err error)
+	GetBalance(ctx context.Context, currency string) (balance Decimal, err error)
+	PostLimitOrder(ctx context.Context, order Order) (orderid string, err error)
+	CancelOrder(ctx context.Context, orderid string) (err error)
+	GetOrderStatus(ctx context.Context, orderid string) (orderstatus OrderStatus, err error)
+	GetOrderStatusByClientOrderId(ctx context.Context, clientorderid string) (orderstatus OrderStatus, err error)
+	GetFees(ctx context.Context) (feeschedule FeeSchedule, err error)
+}
+
+type Pair struct {
+	Symbol         string
+	BaseCurrency   string
+	QuoteCurrency  string
+	BasePrecision  uint
+	QuotePrecision uint
+	PricePrecision uint
+	FeeInQuote     bool
+}
+
+type Order struct {
+	Side          string
+	BaseAmount    Decimal
+	Price         Decimal
+	TimeInForce   string
+	PostOnly      bool
+	ClientOrderId string
+}
+
+type OrderStatus struct {
+	Id            string
+	ClientOrderId string
+	Status        string
+	BaseAmount    Decimal
+	BaseFilled    Decimal
+	BaseRemaining Decimal
+	AveragePrice  Decimal
+	Notional      Decimal
+	Fee           Decimal
+	FeeCurrency   string
+	Reason        string
+}
+
+var BitstampBtcUsd Pair = Pair{
+	Symbol:         `btcusd`,
+	BaseCurrency:   `btc`,
+	QuoteCurrency:  `usd`,
+	BasePrecision:  8,
+	QuotePrecision: 2,
+	PricePrecision: 0,
+	FeeInQuote:     true,
+}
+
+var ValrBtcZar Pair = Pair{
+	Symbol:         `btczar`,
+	BaseCurrency:   `btc`,
+	QuoteCurrency:  `zar`,
+	BasePrecision:  8,
+	QuotePrecision: 2,
+	PricePrecision: 0,
+}
+
+func (pair Pair) FeeCurrency(side string) string {
+
+	if side == Buy && !pair.FeeInQuote {
+
+		return pair.BaseCurrency
+	}
+
+	return pair.QuoteCurrency
+}
+
+func (pair Pair) AveragePrice(notional Decimal, basefilled Decimal) Decimal {
+
+	if basefilled.Sign() <= 0 {
+
+		return DecimalZero
+	}
+
+	return notional.Div(basefilled, pair.PricePrecision+pair.QuotePrecision)
+}
+
+func (pair Pair) FeeFactor(side string, fee float64) Decimal {
+
+	if side == Buy && pair.FeeInQuote {
+
+		return DecimalOne.Div(DecimalOne.Add(DecimalFromFloat(fee)), 18)
+	}
+
+	return DecimalOne.Sub(DecimalFromFloat(fee))
+}
+
+var ExchangePairs map[string]map[string]Pair = map[string]map[string]Pair{
+	`bitstamp`: {BitstampBtcUsd.Symbol: BitstampBtcUsd},
+	`valr`:     {ValrBtcZar.Symbol: ValrBtcZar},
+}
+
+func NewExchange(venue VenueConfig, credential CredentialConfig, symbol string, streamregistry *StreamRegistry) (exchange Exchange, err error) {
+
+	var pair Pair
+	var found bool
+
+	if pair, found = ExchangePairs[venue.Exchange][symbol]; !found {
+
+		err = errors.New(strings.Join([]string{`unknown pair`, venue.Exchange, symbol}, ` `))
+
+		return
+	}
+
+	switch venue.Exchange {
+
+	case `bitstamp`:
+
+		exchange = &BitstampExchange{
+			Key:          credential.Key,
+			Secret:       credential.Secret,
+			Customer:     credential.Customer,
+			Host:         venue.Host,
+			CurrencyPair: pair,
+			Stream:       streamregistry.GetStream(venue, credential, pair),
+		}
+
+	case `valr`:
+
+		exchange = &ValrExchange{
+			Key:          credential.Key,
+			Secret:       credential.Secret,
+			Host:         venue.Host,
+			CurrencyPair: pair,
+			Stream:       streamregistry.GetStream(venue, credential, pair),
+		}
+	}
+
+	return
+}
+
+func FillStatus(open bool, baseamount Decimal, basefilled Decimal) (status string) {
+
+	switch {
+
+	case open:
+
+		status = OrderOpen
+
+	case basefilled.Sign() > 0 && basefilled.LessThan(baseamount):
+
+		status = OrderPartiallyFilled
+
+	case basefilled.Sign() > 0:
+
+		status = OrderFilled
+
+	default:
+
+		status = OrderCancelled
+	}
+
+	return
+}
+
+type BitstampExchange struct {
+	Key          string
+	Secret       string
+	Customer     string
+	Host         string
+	CurrencyPair Pair
+	Stream       DepthStream
+}
+
+func (bitstampexchange *BitstampExchange) Name() string {
+
+	return `bitstamp`
+}
+
+func (bitstampexchange *BitstampExchange) Pair() Pair {
+
+	return bitstampexchange.CurrencyPair
+}
+
+func (bitstampexchange *BitstampExchange) GetDepth(ctx context.Context, depthtype int) (depth Depth, err error) {
+
+	if bitstampexchange.Stream != nil {
+
+		if depth, err = bitstampexchange.Stream.GetDepth(depthtype); err == nil {
+
+			return
+		}
+
+		log.Printf(`Error('bitstamp %[1]v: %[2]v, using rest order book')`, bitstampexchange.CurrencyPair.Symbol, err)
+	}
+
+	depth = Depth{
+		Type:          depthtype,
+		BaseCurrency:  bitstampexchange.CurrencyPair.BaseCurrency,
+		QuoteCurrency: bitstampexchange.CurrencyPair.QuoteCurrency,
+		Levels:        []Level{},
+	}
+
+	var bitstamporderbook BitstampOrderBook
+
+	if bitstamporderbook, err = GetBitstampOrderBook(
+		ctx,
+		bitstampexchange.Key,
+		bitstampexchange.Secret,
+		bitstampexchange.Customer,
+		bitstampexchange.Host,
+		bitstampexchange.CurrencyPair.Symbol,
+	); err != nil {
+
+		return
+	}
+
+	var entries [][]string = bitstamporderbook.Bids
+
+	if depthtype == Ask {
+
+		entries = bitstamporderbook.Asks
+	}
+
+	var entryindex int = 0
+	var entrylength int = len(entries)
+
+	for entryindex = 0; entryindex < entrylength; entryindex++ {
+
+		var level Level = Level{}
+
+		if level.BaseAmount, err = ParseDecimal(entries[entryindex][1]); err != nil {
+
+			return
+		}
+
+		if level.QuoteAmount, err = ParseDecimal(entries[entryindex][0]); err != nil {
+
+			return
+		}
+
+		depth.Levels = append(depth.Levels, level)
+	}
+
+	return
+}
+
+func (bitstampexchange *BitstampExchange) GetBalance(ctx context.Context, currency string) (balance Decimal, err error) {
+
+	var bitstampbalance BitstampBalance
+
+	if bitstampbalance, err = PostBitstampAccountBalance(
+		ctx,
+		bitstampexchange.Key,
+		bitstampexchange.Secret,
+		bitstampexchange.Customer,
+		bitstampexchange.Host,
+		strings.ToLower(currency),
+	); err != nil {
+
+		return
+	}
+
+	balance, err = ParseDecimal(bitstampbalance.Available)
+
+	return
+}
+
+func (bitstampexchange *BitstampExchange) PostLimitOrder(ctx context.Context, order Order) (orderid string, err error) {
+
+	var postlimitorder func(context.Context, string, string, string, string, string, Decimal, Decimal, bool, bool, bool, string) (BitstampOrder, error)
+
+	switch order.Side {
+
+	case Buy:
+
+		postlimitorder = PostBitstampBuyLimitOrder
+
+	case Sell:
+
+		postlimitorder = PostBitstampSellLimitOrder
+
+	default:
+
+		err = errors.New(strings.Join([]string{`bitstamp: unsupported order side`, order.Side}, ` `))
+
+		return
+	}
+
+	var bitstamporder BitstampOrder
+
+	if bitstamporder, err = postlimitorder(
+		ctx,
+		bitstampexchange.Key,
+		bitstampexchange.Secret,
+		bitstampexchange.Customer,
+		bitstampexchange.Host,
+		bitstampexchange.CurrencyPair.Symbol,
+		order.BaseAmount.Round(bitstampexchange.CurrencyPair.BasePrecision),
+		order.Price.Round(bitstampexchange.CurrencyPair.PricePrecision),
+		order.TimeInForce == `DAY`,
+		order.TimeInForce == `IOC`,
+		order.TimeInForce == `FOK`,
+		order.ClientOrderId,
+	); err != nil {
+
+		return
+	}
+
+	orderid = bitstamporder.Id
+
+	return
+}
+
+func (bitstampexchange *BitstampExchange) CancelOrder(ctx context.Context, orderid string) (err error) {
+
+	_, err = PostBitstampCancelOrder(
+		ctx,
+		bitstampexchange.Key,
+		bitstampexchange.Secret,
+		bitstampexchange.Customer,
+		bitstampexchange.Host,
+		orderid,
+	)
+
+	return
+}
+
+func (bitstampexchange *BitstampExchange) GetOrderStatus(ctx context.Context, orderid string) (orderstatus OrderStatus, err error) {
+
+	orderstatus, err = bitstampexchange.OrderStatus(ctx, orderid, ``)
+
+	return
+}
+
+func (bitstampexchange *BitstampExchange) GetOrderStatusByClientOrderId(ctx context.Context, clientorderid string) (orderstatus OrderStatus, err error) {
+
+	if orderstatus, err = bitstampexchange.OrderStatus(ctx, ``, clientorderid); err != nil && strings.Contains(strings.ToLower(err.Error()), `not found`) {
+
+		err = errors.Join(ErrOrderNotFound, err)
+	}
+
+	if err == nil && orderstatus.Id == `` {
+
+		err = ErrOrderNotFound
+	}
+
+	return
+}
+
+func (bitstampexchange *BitstampExchange) OrderStatus(ctx context.Context, orderid string, clientorderid string) (orderstatus OrderStatus, err error) {
+
+	var bitstamporderstatus BitstampOrderStatus
+
+	if bitstamporderstatus, err = PostBitstampOrderStatus(
+		ctx,
+		bitstampexchange.Key,
+		bitstampexchange.Secret,
+		bitstampexchange.Customer,
+		bitstampexchange.Host,
+		orderid,
+		clientorderid,
+	); err != nil {
+
+		return
+	}
+
+	var pair Pair = bitstampexchange.CurrencyPair
+
+	orderstatus = OrderStatus{
+		Id:            bitstamporderstatus.Id,
+		ClientOrderId: bitstamporderstatus.ClientOrderId,
+		FeeCurrency:   pair.QuoteCurrency,
+	}
+
+	if bitstamporderstatus.AmountRemaining != `` {
+
+		if orderstatus.BaseRemaining, err = ParseDecimal(bitstamporderstatus.AmountRemaining); err != nil {
+
+			return
+		}
+	}
+
+	var transactionindex int = 0
+	var transactionlength int = len(bitstamporderstatus.Transactions)
+
+	for transactionindex = 0; transactionindex < transactionlength; transactionindex++ {
+
+		var bitstamptransaction BitstampTransaction = bitstamporderstatus.Transactions[transactionindex]
+
+		var basefilled Decimal
+		var notional Decimal
+		var fee Decimal
+
+		if basefilled, err = ParseDecimal(bitstamptransaction.Btc); err != nil {
+
+			return
+		}
+
+		if notional, err = ParseDecimal(bitstamptransaction.Usd); err != nil {
+
+			return
+		}
+
+		if fee, err = ParseDecimal(bitstamptransaction.Fee); err != nil {
+
+			return
+		}
+
+		orderstatus.BaseFilled = orderstatus.BaseFilled.Add(basefilled)
+		orderstatus.Notional = orderstatus.Notional.Add(notional)
+		orderstatus.Fee = orderstatus.Fee.Add(fee)
+	}
+
+	orderstatus.AveragePrice = pair.AveragePrice(orderstatus.Notional, orderstatus.BaseFilled)
+
+	orderstatus.BaseAmount = orderstatus.BaseFilled.Add(orderstatus.BaseRemaining)
+	orderstatus.Status = FillStatus(bitstamporderstatus.Status == `Open`, orderstatus.BaseAmount, orderstatus.BaseFilled)
+
+	return
+}
+
+func (bitstampexchange *BitstampExchange) GetFees(ctx context.Context) (feeschedule FeeSchedule, err error) {
+
+	var bitstamptradingfee BitstampTradingFee
+
+	if bitstamptradingfee, err = PostBitstampTradingFees(
+		ctx,
+		bitstampexchange.Key,
+		bitstampexchange.Secret,
+		bitstampexchange.Customer,
+		bitstampexchange.Host,
+		bitstampexchange.CurrencyPair.Symbol,
+	); err != nil {
+
+		return
+	}
+
+	if feeschedule.Maker, err = strconv.ParseFloat(bitstamptradingfee.Fees.Maker, 64); err != nil {
+
+		err = ParseError(err)
+
+		return
+	}
+
+	if feeschedule.Taker, err = strconv.ParseFloat(bitstamptradingfee.Fees.Taker, 64); err != nil {
+
+		err = ParseError(err)
+
+		return
+	}
+
+	feeschedule.Maker /= 100.0
+	feeschedule.Taker /= 100.0
+
+	return
+}
+
+type ValrExchange struct {
+	Key          string
+	Secret       string
+	Host         string
+	CurrencyPair Pair
+	Stream       DepthStream
+}
+
+func (valrexchange *ValrExchange) Name() string {
+
+	return `valr`
+}
+
+func (valrexchange *ValrExchange) Pair() Pair {
+
+	return valrexchange.CurrencyPair
+}
+
+func (valrexchange *ValrExchange) GetDepth(ctx context.Context, depthtype int) (depth Depth, err error) {
+
+	if valrexchange.Stream != nil {
+
+		if depth, err = valrexchange.Stream.GetDepth(depthtype); err == nil {
+
+			return
+		}
+
+		log.Printf(`Error('valr %[1]v: %[2]v, using rest order book')`, valrexchange.CurrencyPair.Symbol, err)
+	}
+
+	depth = Depth{
+		Type:          depthtype,
+		BaseCurrency:  valrexchange.CurrencyPair.BaseCurrency,
+		QuoteCurrency: valrexchange.CurrencyPair.QuoteCurrency,
+		Levels:        []Level{},
+	}
+
+	var valrorderbook ValrOrderBook
+
+	if valrorderbook, err = GetValrOrderBook(
+		ctx,
+		valrexchange.Key,
+		valrexchange.Secret,
+		valrexchange.Host,
+		valrexchange.CurrencyPair.Symbol,
+	); err != nil {
+
+		return
+	}
+
+	var entries []ValrOrder = valrorderbook.Bids
+
+	if depthtype == Ask {
+
+		entries = valrorderbook.Asks
+	}
+
+	var entryindex int = 0
+	var entrylength int = len(entries)
+
+	for entryindex = 0; entryindex < entrylength; entryindex++ {
+
+		var level Level = Level{}
+
+		if level.BaseAmount, err = ParseDecimal(entries[entryindex].Quantity); err != nil {
+
+			return
+		}
+
+		if level.QuoteAmount, err = ParseDecimal(entries[entryindex].Price); err != nil {
+
+			return
+		}
+
+		depth.Levels = append(depth.Levels, level)
+	}
+
+	return
+}
+
+func (valrexchange *ValrExchange) GetBalance(ctx context.Context, currency string) (balance Decimal, err error) {
+
+	var valrbalancelist []ValrBalance
+
+	if valrbalancelist, err = GetValrBalanceList(ctx, valrexchange.Key, valrexchange.Secret, valrexchange.Host); err != nil {
+
+		return
+	}
+
+	var valrbalanceindex int = 0
+	var valrbalancelength int = len(valrbalancelist)
+
+	for valrbalanceindex = 0; valrbalanceindex < valrbalancelength; valrbalanceindex++ {
+
+		var valrbalance ValrBalance = valrbalancelist[valrbalanceindex]
+
+		if strings.EqualFold(valrbalance.Currency, currency) {
+
+			if balance, err = ParseDecimal(valrbalance.Available); err != nil {
+
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (valrexchange *ValrExchange) PostLimitOrder(ctx context.Context, order Order) (orderid string, err error) {
+
+	var postonly string = `False`
+
+	if order.PostOnly {
+
+		postonly = `True`
+	}
+
+	var valrorderid ValrOrderId
+
+	if valrorderid, err = PostValrLimitOrder(
+		ctx,
+		valrexchange.Key,
+		valrexchange.Secret,
+		valrexchange.Host,
+		ValrLimitOrder{
+			Side:            order.Side,
+			Quantity:        order.BaseAmount.StringFixed(valrexchange.CurrencyPair.BasePrecision),
+			Price:           order.Price.StringFixed(valrexchange.CurrencyPair.PricePrecision),
+			Pair:            strings.ToUpper(valrexchange.CurrencyPair.Symbol),
+			PostOnly:        postonly,
+			CustomerOrderId: order.ClientOrderId,
+			TimeInForce:     order.TimeInForce,
+		},
+	); err != nil {
+
+		return
+	}
+
+	orderid = valrorderid.Id
+
+	return
+}
+
+func (valrexchange *ValrExchange) CancelOrder(ctx context.Context, orderid string) (err error) {
+
+	err = DeleteValrOrder(
+		ctx,
+		valrexchange.Key,
+		valrexchange.Secret,
+		valrexchange.Host,
+		ValrCancelOrder{
+			OrderId: orderid,
+			Pair:    strings.ToUpper(valrexchange.CurrencyPair.Symbol),
+		},
+	)
+
+	return
+}
+
+func (valrexchange *ValrExchange) GetOrderStatus(ctx context.Context, orderid string) (orderstatus OrderStatus, err error) {
+
+	var valrorderstatus ValrOrderStatus
+
+	if valrorderstatus, err = GetValrOrderStatus(
+		ctx,
+		valrexchange.Key,
+		valrexchange.Secret,
+		valrexchange.Host,
+		valrexchange.CurrencyPair.Symbol,
+		orderid,
+	); err != nil {
+
+		return
+	}
+
+	orderstatus, err = ValrExchangeOrderStatus(valrexchange.CurrencyPair, valrorderstatus)
+
+	return
+}
+
+func (valrexchange *ValrExchange) GetOrderStatusByClientOrderId(ctx context.Context, clientorderid string) (orderstatus OrderStatus, err error) {
+
+	var valrorderstatus ValrOrderStatus
+
+	if valrorderstatus, err = GetValrOrderStatusByCustomerOrderId(
+		ctx,
+		valrexchange.Key,
+		valrexchange.Secret,
+		valrexchange.Host,
+		valrexchange.CurrencyPair.Symbol,
+		clientorderid,
+	); err != nil {
+
+		if strings.Contains(strings.ToLower(err.Error()), `not found`) {
+
+			err = errors.Join(ErrOrderNotFound, err)
+		}
+
+		return
+	}
+
+	orderstatus, err = ValrExchangeOrderStatus(valrexchange.CurrencyPair, valrorderstatus)
+
+	return
+}
+
+func ValrExchangeOrderStatus(pair Pair, valrorderstatus ValrOrderStatus) (orderstatus OrderStatus, err error) {
+
+	orderstatus = OrderStatus{
+		Id:            valrorderstatus.OrderId,
+		ClientOrderId: valrorderstatus.CustomerOrderId,
+		FeeCurrency:   strings.ToLower(valrorderstatus.FeeCurrency),
+		Reason:        valrorderstatus.FailedReason,
+	}
+
+	if orderstatus.FeeCurrency == `` {
+
+		orderstatus.FeeCurrency = pair.FeeCurrency(strings.ToUpper(valrorderstatus.OrderSide))
+	}
+
+	if orderstatus.BaseAmount, err = ParseDecimal(valrorderstatus.OriginalQuantity); err != nil {
+
+		return
+	}
+
+	if orderstatus.BaseRemaining, err = ParseDecimal(valrorderstatus.RemainingQuantity); err != nil {
+
+		return
+	}
+
+	orderstatus.BaseFilled = orderstatus.BaseAmount.Sub(orderstatus.BaseRemaining)
+
+	if valrorderstatus.AveragePrice != `` {
+
+		if orderstatus.AveragePrice, err = ParseDecimal(valrorderstatus.AveragePrice); err != nil {
+
+			return
+		}
+	}
+
+	if valrorderstatus.Total != `` {
+
+		if orderstatus.Notional, err = ParseDecimal(valrorderstatus.Total); err != nil {
+
+			return
+		}
+	}
+
+	if valrorderstatus.TotalFee != `` {
+
+		if orderstatus.Fee, err = ParseDecimal(valrorderstatus.TotalFee); err != nil {
+
+			return
+		}
+	}
+
+	switch valrorderstatus.OrderStatusType {
+
+	case `Failed`:
+
+		orderstatus.Status = OrderFailed
+
+	default:
+
+		orderstatus.Status = FillStatus(valrorderstatus.OrderStatusType == `Placed` || valrorderstatus.OrderStatusType == `Active`, orderstatus.BaseAmount, orderstatus.BaseFilled)
+	}
+
+	return
+}
+
+func (valrexchange *ValrExchange) GetFees(ctx context.Context) (feeschedule FeeSchedule, err error) {
+
+	var valrtradefeelist []ValrTradeFee
+
+	if valrtradefeelist, err = GetValrTradeFees(ctx, valrexchange.Key, valrexchange.Secret, valrexchange.Host); err != nil {
+
+		return
+	}
+
+	var valrtradefeeindex int = 0
+	var valrtradefeelength int = len(valrtradefeelist)
+
+	for valrtradefeeindex = 0; valrtradefeeindex < valrtradefeelength; valrtradefeeindex++ {
+
+		var valrtradefee ValrTradeFee = valrtradefeelist[valrtradefeeindex]
+
+		if strings.EqualFold(valrtradefee.CurrencyPair, valrexchange.CurrencyPair.Symbol) {
+
+			feeschedule.Maker = valrtradefee.MakerPercentage / 100.0
+			feeschedule.Taker = valrtradefee.TakerPercentage / 100.0
+
+			return
+		}
+	}
+
+	err = errors.New(strings.Join([]string{`valr: no trade fees for`, valrexchange.CurrencyPair.Symbol}, ` `))
+
+	return
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type FeeSchedule struct {
+	Maker float64   `json:"maker"`
+	Taker float64   `json:"taker"`
+	Tiers []FeeTier `json:"tiers,omitempty"`
+}
+
+type FeeTier struct {
+	Volume float64 `json:"volume"`
+	Maker  float64 `json:"maker"`
+	Taker  float64 `json:"taker"`
+}
+
+type FeeCache struct {
+	MaxAge    time.Duration
+	Schedules map[string]FeeSchedule
+	Fetched   map[string]time.Time
+}
+
+func (feeschedule FeeSchedule) Rates(volume float64) (maker float64, taker float64) {
+
+	maker = feeschedule.Maker
+	taker = feeschedule.Taker
+
+	var tierindex int = 0
+	var tierlength int = len(feeschedule.Tiers)
+	var tiervolume float64 = -1.0
+
+	for tierindex = 0; tierindex < tierlength; tierindex++ {
+
+		var feetier FeeTier = feeschedule.Tiers[tierindex]
+
+		if feetier.Volume <= volume && feetier.Volume > tiervolume {
+
+			maker = feetier.Maker
+			taker = feetier.Taker
+
+			tiervolume = feetier.Volume
+		}
+	}
+
+	return
+}
+
+func (feecache *FeeCache) GetFeeSchedule(ctx context.Context, venue VenueConfig, credential CredentialConfig, exchange Exchange) (feeschedule FeeSchedule, err error) {
+
+	if !venue.FetchFees {
+
+		if venue.Fees != nil {
+
+			feeschedule = *venue.Fees
+		}
+
+		return
+	}
+
+	if feecache.Schedules == nil {
+
+		feecache.Schedules = map[string]FeeSchedule{}
+		feecache.Fetched = map[string]time.Time{}
+	}
+
+	var cachekey string = strings.Join([]string{exchange.Name(), credential.Key, exchange.Pair().Symbol}, `/`)
+
+	var found bool
+
+	if feeschedule, found = feecache.Schedules[cachekey]; found && time.Since(feecache.Fetched[cachekey]) < feecache.MaxAge {
+
+		return
+	}
+
+	if feeschedule, err = exchange.GetFees(ctx); err != nil {
+
+		return
+	}
+
+	feecache.Schedules[cachekey] = feeschedule
+	feecache.Fetched[cachekey] = time.Now()
+
+	return
+}
+
+func (feecache *FeeCache) GetTakerFee(ctx context.Context, venue VenueConfig, credential CredentialConfig, exchange Exchange) (taker float64, err error) {
+
+	var feeschedule FeeSchedule
+
+	if feeschedule, err = feecache.GetFeeSchedule(ctx, venue, credential, exchange); err != nil {
+
+		return
+	}
+
+	_, taker = feeschedule.Rates(credential.Volume)
+
+	return
+}
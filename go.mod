@@ -0,0 +1,3 @@
+module algo
+
+go 1.21
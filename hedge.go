@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HedgeRehedge = `rehedge`
+	HedgeAlert   = `alert`
+)
+
+const (
+	HedgePending  = `PENDING`
+	HedgeBalanced = `BALANCED`
+	HedgeResidual = `RESIDUAL`
+	HedgeHedged   = `HEDGED`
+	HedgeAlerted  = `ALERTED`
+)
+
+type HedgeConfig struct {
+	Mode           string   `json:"mode"`
+	Aggressiveness float64  `json:"aggressiveness,omitempty"`
+	Attempts       int      `json:"attempts,omitempty"`
+	Settle         Duration `json:"settle,omitempty"`
+	Timeout        Duration `json:"timeout,omitempty"`
+	Webhook        string   `json:"webhook,omitempty"`
+}
+
+type Hedge struct {
+	HedgeConfig  HedgeConfig
+	Account      string
+	ArbitrageId  string
+	BuyExchange  Exchange
+	SellExchange Exchange
+	BuyTrade     Trade
+	SellTrade    Trade
+	BuyFee       float64
+	State        string
+	Residual     Decimal
+	Attempt      int
+	Orders       []HedgeOrder
+	Reason       string
+}
+
+type HedgeOrder struct {
+	Venue       string
+	Side        string
+	Price       Decimal
+	OrderStatus OrderStatus
+}
+
+var DefaultHedgeConfig HedgeConfig = HedgeConfig{Mode: HedgeAlert, Attempts: 3, Settle: Duration{2 * time.Second}, Timeout: Duration{time.Minute}}
+
+func (hedge *Hedge) Run(ctx context.Context, buyorderstatus OrderStatus, sellorderstatus OrderStatus) {
+
+	var basepair Pair = hedge.BuyExchange.Pair()
+
+	hedge.State = HedgePending
+
+	for {
+
+		log.Printf(`hedge: %[1]v residual %[2]v attempt %[3]v`, hedge.State, hedge.Residual, hedge.Attempt)
+
+		switch hedge.State {
+
+		case HedgePending:
+
+			var buydeviation Decimal = buyorderstatus.BaseFilled.Sub(hedge.BuyTrade.BaseAmount)
+			var selldeviation Decimal = sellorderstatus.BaseFilled.Sub(hedge.SellTrade.BaseAmount)
+
+			if basepair.FeeCurrency(Buy) == basepair.BaseCurrency {
+
+				buydeviation = buydeviation.Mul(basepair.FeeFactor(Buy, hedge.BuyFee))
+			}
+
+			hedge.Residual = buydeviation.Sub(selldeviation).Round(basepair.BasePrecision)
+
+			hedge.State = HedgeResidual
+
+			if hedge.Residual.IsZero() {
+
+				hedge.State = HedgeBalanced
+			}
+
+		case HedgeResidual:
+
+			if hedge.HedgeConfig.Mode != HedgeRehedge {
+
+				hedge.Alert(`hedging disabled`)
+
+				continue
+			}
+
+			if hedge.Attempt >= hedge.HedgeConfig.Attempts {
+
+				hedge.Alert(`hedge attempts exhausted`)
+
+				continue
+			}
+
+			if err := hedge.Step(ctx); err != nil {
+
+				hedge.Alert(err.Error())
+
+				continue
+			}
+
+			if hedge.Residual.IsZero() {
+
+				hedge.State = HedgeHedged
+			}
+
+		default:
+
+			return
+		}
+	}
+}
+
+func (hedge *Hedge) Step(ctx context.Context) (err error) {
+
+	hedge.Attempt += 1
+
+	var exchange Exchange = hedge.SellExchange
+	var side string = Sell
+	var depthtype int = Bid
+	var amount Decimal = hedge.Residual
+	var concession Decimal = DecimalOne.Sub(DecimalFromFloat(hedge.HedgeConfig.Aggressiveness * float64(hedge.Attempt)))
+
+	if hedge.Residual.Sign() < 0 {
+
+		exchange = hedge.BuyExchange
+		side = Buy
+		depthtype = Ask
+		amount = hedge.Residual.Neg()
+		concession = DecimalOne.Add(DecimalFromFloat(hedge.HedgeConfig.Aggressiveness * float64(hedge.Attempt)))
+	}
+
+	var pair Pair = exchange.Pair()
+
+	var depth Depth
+
+	if depth, err = exchange.GetDepth(ctx, depthtype); err != nil {
+
+		return
+	}
+
+	var price Decimal
+	var found bool
+
+	if price, found = HedgePrice(depth, amount); !found {
+
+		err = fmt.Errorf(`hedge: not enough %[1]v %[2]v liquidity for %[3]v`, exchange.Name(), pair.Symbol, amount)
+
+		return
+	}
+
+	price = price.Mul(concession).Round(pair.PricePrecision)
+
+	if side == Sell {
+
+		amount = amount.Truncate(pair.BasePrecision)
+	}
+
+	var orderid string
+
+	if orderid, err = PlaceOrder(ctx, exchange, Order{
+		Side:          side,
+		BaseAmount:    amount,
+		Price:         price,
+		TimeInForce:   `IOC`,
+		ClientOrderId: ClientOrderId(hedge.Account, hedge.ArbitrageId, strings.Join([]string{`hedge`, strconv.Itoa(hedge.Attempt)}, ``)),
+	}); err != nil {
+
+		return
+	}
+
+	var orderstatus OrderStatus
+
+	if orderstatus, err = SettleOrderStatus(ctx, exchange, orderid, hedge.HedgeConfig.Settle.Duration); err != nil {
+
+		return
+	}
+
+	log.Printf(`hedgeorderstatus: %+[1]v`, orderstatus)
+
+	hedge.Orders = append(hedge.Orders, HedgeOrder{Venue: exchange.Name(), Side: side, Price: price, OrderStatus: orderstatus})
+
+	if side == Sell {
+
+		hedge.Residual = hedge.Residual.Sub(orderstatus.BaseFilled)
+
+	} else {
+
+		hedge.Residual = hedge.Residual.Add(orderstatus.BaseFilled)
+	}
+
+	hedge.Residual = hedge.Residual.Round(pair.BasePrecision)
+
+	return
+}
+
+func (hedge *Hedge) Alert(reason string) {
+
+	hedge.State = HedgeAlerted
+	hedge.Reason = reason
+
+	var message string = fmt.Sprintf(`unhedged %[1]v %[2]v on account %[3]v after buy %[4]v / sell %[5]v: %[6]v`,
+		hedge.Residual, hedge.BuyExchange.Pair().BaseCurrency, hedge.Account, hedge.BuyExchange.Name(), hedge.SellExchange.Name(), reason)
+
+	SendAlert(hedge.HedgeConfig.Webhook, message)
+}
+
+func HedgePrice(depth Depth, amount Decimal) (price Decimal, found bool) {
+
+	var cumulative Decimal = DecimalZero
+
+	var levelindex int = 0
+	var levellength int = len(depth.Levels)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		cumulative = cumulative.Add(depth.Levels[levelindex].BaseAmount)
+
+		if !cumulative.LessThan(amount) {
+
+			price = depth.Levels[levelindex].QuoteAmount
+			found = true
+
+			return
+		}
+	}
+
+	return
+}
+
+func SettleOrderStatus(ctx context.Context, exchange Exchange, orderid string, settle time.Duration) (orderstatus OrderStatus, err error) {
+
+	var deadline time.Time = time.Now().Add(settle)
+
+	for {
+
+		if orderstatus, err = exchange.GetOrderStatus(ctx, orderid); err != nil {
+
+			return
+		}
+
+		if orderstatus.Status != OrderOpen {
+
+			return
+		}
+
+		if !time.Now().Before(deadline) {
+
+			break
+		}
+
+		if err = Sleep(ctx, 250*time.Millisecond); err != nil {
+
+			return
+		}
+	}
+
+	if err = exchange.CancelOrder(ctx, orderid); err != nil {
+
+		return
+	}
+
+	orderstatus, err = exchange.GetOrderStatus(ctx, orderid)
+
+	return
+}
+
+func SendAlert(webhook string, message string) {
+
+	log.Printf(`Alert('%[1]v')`, message)
+
+	if webhook == `` {
+
+		return
+	}
+
+	var payload []byte
+	var err error
+
+	if payload, err = json.Marshal(map[string]string{`text`: message}); err != nil {
+
+		return
+	}
+
+	var httpclient *http.Client = &http.Client{Timeout: 10 * time.Second}
+
+	var httpresponse *http.Response
+
+	if httpresponse, err = httpclient.Post(webhook, `application/json`, bytes.NewReader(payload)); err != nil {
+
+		log.Printf(`Error('alert webhook: %+[1]v')`, err)
+
+		return
+	}
+
+	httpresponse.Body.Close()
+
+	if httpresponse.StatusCode >= 300 {
+
+		log.Printf(`Error('alert webhook: %+[1]v')`, strings.TrimSpace(httpresponse.Status))
+	}
+}
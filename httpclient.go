@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ApiTimeout               time.Duration = 30 * time.Second
+	ApiDialTimeout           time.Duration = 10 * time.Second
+	ApiKeepAlive             time.Duration = 30 * time.Second
+	ApiTLSHandshakeTimeout   time.Duration = 10 * time.Second
+	ApiResponseHeaderTimeout time.Duration = 20 * time.Second
+	ApiIdleConnTimeout       time.Duration = 90 * time.Second
+	ApiMaxIdleConnsPerHost   int           = 16
+)
+
+type ApiClient struct {
+	Proxy   string
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+type ApiClientRegistry struct {
+	Mutex   sync.Mutex
+	Clients map[string]*ApiClient
+}
+
+var ApiClients *ApiClientRegistry = &ApiClientRegistry{Clients: map[string]*ApiClient{}}
+
+func ApiClientKey(venue string, host string) string {
+
+	return strings.Join([]string{venue, strings.ToLower(host)}, `/`)
+}
+
+func ApiHost(host string) (scheme string, hostname string) {
+
+	scheme = `https://`
+	hostname = host
+
+	var index int = strings.Index(host, `://`)
+
+	if index >= 0 {
+
+		scheme = strings.ToLower(host[:index+3])
+		hostname = host[index+3:]
+	}
+
+	return
+}
+
+func NewApiClient(proxy string, timeout time.Duration) (apiclient *ApiClient, err error) {
+
+	if timeout <= 0 {
+
+		timeout = ApiTimeout
+	}
+
+	var proxyfunc func(*http.Request) (*url.URL, error) = http.ProxyFromEnvironment
+
+	if proxy != `` {
+
+		var proxyurl *url.URL
+
+		if proxyurl, err = url.Parse(proxy); err != nil {
+
+			return
+		}
+
+		proxyfunc = http.ProxyURL(proxyurl)
+	}
+
+	var dialer *net.Dialer = &net.Dialer{Timeout: ApiDialTimeout, KeepAlive: ApiKeepAlive}
+
+	var transport *http.Transport = &http.Transport{
+		Proxy:                 proxyfunc,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          4 * ApiMaxIdleConnsPerHost,
+		MaxIdleConnsPerHost:   ApiMaxIdleConnsPerHost,
+		IdleConnTimeout:       ApiIdleConnTimeout,
+		TLSHandshakeTimeout:   ApiTLSHandshakeTimeout,
+		ResponseHeaderTimeout: ApiResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	apiclient = &ApiClient{
+		Proxy:   proxy,
+		Timeout: timeout,
+		Client:  &http.Client{Transport: transport, Timeout: timeout},
+	}
+
+	return
+}
+
+func (apiclientregistry *ApiClientRegistry) Configure(venue string, host string, proxy string, timeout time.Duration) (err error) {
+
+	apiclientregistry.Mutex.Lock()
+
+	defer apiclientregistry.Mutex.Unlock()
+
+	var key string = ApiClientKey(venue, host)
+
+	if timeout <= 0 {
+
+		timeout = ApiTimeout
+	}
+
+	if apiclient, found := apiclientregistry.Clients[key]; found && apiclient.Proxy == proxy && apiclient.Timeout == timeout {
+
+		return
+	}
+
+	var apiclient *ApiClient
+
+	if apiclient, err = NewApiClient(proxy, timeout); err != nil {
+
+		return
+	}
+
+	if previous, found := apiclientregistry.Clients[key]; found {
+
+		previous.Client.CloseIdleConnections()
+	}
+
+	apiclientregistry.Clients[key] = apiclient
+
+	return
+}
+
+func (apiclientregistry *ApiClientRegistry) Get(venue string, host string) *http.Client {
+
+	apiclientregistry.Mutex.Lock()
+
+	defer apiclientregistry.Mutex.Unlock()
+
+	var key string = ApiClientKey(venue, host)
+
+	if apiclient, found := apiclientregistry.Clients[key]; found {
+
+		return apiclient.Client
+	}
+
+	var apiclient *ApiClient
+
+	apiclient, _ = NewApiClient(``, 0)
+
+	apiclientregistry.Clients[key] = apiclient
+
+	return apiclient.Client
+}
+
+func ConfigureApiClients(config Config) (err error) {
+
+	var venue VenueConfig
+
+	for _, venue = range config.Venues {
+
+		if err = ApiClients.Configure(venue.Exchange, venue.Host, venue.Proxy, venue.Timeout.Duration); err != nil {
+
+			return
+		}
+	}
+
+	return
+}
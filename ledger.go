@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const LedgerDepthLevels int = 10
+
+const LedgerDateLayout string = `2006-01-02`
+
+type Ledger struct {
+	Dir   string
+	Mutex sync.Mutex
+}
+
+type LedgerEntry struct {
+	Time              time.Time          `json:"time"`
+	Account           string             `json:"account"`
+	ArbitrageId       string             `json:"arbitrageid,omitempty"`
+	Paper             bool               `json:"paper,omitempty"`
+	BuyVenue          string             `json:"buyvenue"`
+	BuySymbol         string             `json:"buysymbol"`
+	SellVenue         string             `json:"sellvenue"`
+	SellSymbol        string             `json:"sellsymbol"`
+	Asks              []RecordLevel      `json:"asks"`
+	Bids              []RecordLevel      `json:"bids"`
+	LimitRate         Decimal            `json:"limitrate"`
+	ExchangeRate      Decimal            `json:"exchangerate"`
+	BuyLimit          Decimal            `json:"buylimit"`
+	BuyFee            float64            `json:"buyfee"`
+	SellFee           float64            `json:"sellfee"`
+	ProfitMargin      float64            `json:"profitmargin"`
+	BuyQuoteBalance   Decimal            `json:"buyquotebalance"`
+	SellBaseBalance   Decimal            `json:"sellbasebalance"`
+	Opportunity       bool               `json:"opportunity"`
+	Executed          bool               `json:"executed"`
+	GrossPercent      float64            `json:"grosspercent"`
+	NetPercent        float64            `json:"netpercent"`
+	BuyShortfall      Decimal            `json:"buyshortfall"`
+	SellShortfall     Decimal            `json:"sellshortfall"`
+	Scaled            bool               `json:"scaled,omitempty"`
+	Orders            []LedgerOrder      `json:"orders,omitempty"`
+	HedgeState        string             `json:"hedgestate,omitempty"`
+	Residual          Decimal            `json:"residual"`
+	Pnl               map[string]Decimal `json:"pnl,omitempty"`
+	Realised          Decimal            `json:"realised"`
+	RealisedIn        string             `json:"realisedin"`
+	EstimatedPnl      map[string]Decimal `json:"estimatedpnl,omitempty"`
+	EstimatedRealised *Decimal           `json:"estimatedrealised,omitempty"`
+}
+
+type LedgerOrder struct {
+	Leg               string   `json:"leg"`
+	Venue             string   `json:"venue"`
+	Symbol            string   `json:"symbol"`
+	Side              string   `json:"side"`
+	OrderId           string   `json:"orderid,omitempty"`
+	ClientOrderId     string   `json:"clientorderid,omitempty"`
+	Status            string   `json:"status"`
+	Reason            string   `json:"reason,omitempty"`
+	BaseAmount        Decimal  `json:"baseamount"`
+	Price             Decimal  `json:"price"`
+	BaseFilled        Decimal  `json:"basefilled"`
+	AveragePrice      Decimal  `json:"averageprice"`
+	Notional          Decimal  `json:"notional"`
+	Fee               Decimal  `json:"fee"`
+	FeeCurrency       string   `json:"feecurrency"`
+	EstimatedNotional *Decimal `json:"estimatednotional,omitempty"`
+	EstimatedFee      *Decimal `json:"estimatedfee,omitempty"`
+}
+
+func NewLedgerEntry(route RouteConfig, arbitragerequest ArbitrageRequest, arbitrageresponse ArbitrageResponse, now time.Time) (ledgerentry LedgerEntry) {
+
+	var buypair Pair = arbitragerequest.BuyExchange.Pair()
+	var sellpair Pair = arbitragerequest.SellExchange.Pair()
+
+	var evaluation Evaluation = arbitrageresponse.Evaluation
+
+	ledgerentry = LedgerEntry{
+		Time:            now.UTC(),
+		Account:         arbitragerequest.Account,
+		ArbitrageId:     arbitrageresponse.ArbitrageId,
+		Paper:           arbitrageresponse.Paper,
+		BuyVenue:        route.Buy,
+		BuySymbol:       buypair.Symbol,
+		SellVenue:       route.Sell,
+		SellSymbol:      sellpair.Symbol,
+		Asks:            RecordLevels(LedgerLevels(arbitrageresponse.Buyable.Levels)),
+		Bids:            RecordLevels(LedgerLevels(arbitrageresponse.Sellable.Levels)),
+		LimitRate:       arbitragerequest.LimitRate,
+		ExchangeRate:    arbitragerequest.ExchangeRate,
+		BuyLimit:        arbitragerequest.BuyLimit,
+		BuyFee:          arbitragerequest.BuyFee,
+		SellFee:         arbitragerequest.SellFee,
+		ProfitMargin:    arbitragerequest.ProfitMargin,
+		BuyQuoteBalance: arbitrageresponse.BuyQuoteBalance,
+		SellBaseBalance: arbitrageresponse.SellBaseBalance,
+		Opportunity:     evaluation.Opportunity,
+		Executed:        arbitrageresponse.Executed,
+		GrossPercent:    evaluation.GrossPercent,
+		NetPercent:      evaluation.NetPercent,
+		BuyShortfall:    evaluation.BuyShortfall,
+		SellShortfall:   evaluation.SellShortfall,
+		Scaled:          evaluation.Scaled,
+		HedgeState:      arbitrageresponse.Hedge.State,
+		Residual:        arbitrageresponse.Hedge.Residual,
+		RealisedIn:      sellpair.QuoteCurrency,
+	}
+
+	if !arbitrageresponse.Executed {
+
+		return
+	}
+
+	ledgerentry.Orders = append(ledgerentry.Orders, NewLedgerOrder(`buy`, route.Buy, buypair, Buy, evaluation.BuyTrade.QuoteAmount, arbitragerequest.BuyFee, arbitrageresponse.BuyOrderStatus))
+	ledgerentry.Orders = append(ledgerentry.Orders, NewLedgerOrder(`sell`, route.Sell, sellpair, Sell, evaluation.SellTrade.QuoteAmount, arbitragerequest.SellFee, arbitrageresponse.SellOrderStatus))
+
+	var hedgeindex int = 0
+	var hedgelength int = len(arbitrageresponse.Hedge.Orders)
+
+	for hedgeindex = 0; hedgeindex < hedgelength; hedgeindex++ {
+
+		var hedgeorder HedgeOrder = arbitrageresponse.Hedge.Orders[hedgeindex]
+
+		var leg string = strings.Join([]string{`hedge`, strconv.Itoa(hedgeindex + 1)}, ``)
+
+		if hedgeorder.Side == Buy {
+
+			ledgerentry.Orders = append(ledgerentry.Orders, NewLedgerOrder(leg, route.Buy, buypair, Buy, hedgeorder.Price, arbitragerequest.BuyFee, hedgeorder.OrderStatus))
+
+		} else {
+
+			ledgerentry.Orders = append(ledgerentry.Orders, NewLedgerOrder(leg, route.Sell, sellpair, Sell, hedgeorder.Price, arbitragerequest.SellFee, hedgeorder.OrderStatus))
+		}
+	}
+
+	var pnl map[string]Decimal = map[string]Decimal{}
+	var estimated bool = false
+
+	var orderindex int = 0
+	var orderlength int = len(ledgerentry.Orders)
+
+	for orderindex = 0; orderindex < orderlength; orderindex++ {
+
+		var ledgerorder LedgerOrder = ledgerentry.Orders[orderindex]
+
+		var pair Pair = buypair
+
+		if ledgerorder.Side == Sell {
+
+			pair = sellpair
+		}
+
+		var notional Decimal = ledgerorder.Notional
+		var fee Decimal = ledgerorder.Fee
+
+		if ledgerorder.EstimatedNotional != nil {
+
+			notional = *ledgerorder.EstimatedNotional
+			fee = *ledgerorder.EstimatedFee
+
+			estimated = true
+		}
+
+		if ledgerorder.Side == Buy {
+
+			pnl[pair.BaseCurrency] = pnl[pair.BaseCurrency].Add(ledgerorder.BaseFilled)
+			pnl[pair.QuoteCurrency] = pnl[pair.QuoteCurrency].Sub(notional)
+
+		} else {
+
+			pnl[pair.BaseCurrency] = pnl[pair.BaseCurrency].Sub(ledgerorder.BaseFilled)
+			pnl[pair.QuoteCurrency] = pnl[pair.QuoteCurrency].Add(notional)
+		}
+
+		pnl[ledgerorder.FeeCurrency] = pnl[ledgerorder.FeeCurrency].Sub(fee)
+	}
+
+	var realised Decimal = pnl[sellpair.QuoteCurrency]
+
+	if buypair.QuoteCurrency != sellpair.QuoteCurrency {
+
+		realised = realised.Add(pnl[buypair.QuoteCurrency].Mul(arbitragerequest.ExchangeRate))
+	}
+
+	realised = realised.Round(sellpair.QuotePrecision)
+
+	if estimated {
+
+		ledgerentry.EstimatedPnl = pnl
+		ledgerentry.EstimatedRealised = &realised
+
+		return
+	}
+
+	ledgerentry.Pnl = pnl
+	ledgerentry.Realised = realised
+
+	return
+}
+
+func NewLedgerOrder(leg string, venue string, pair Pair, side string, price Decimal, fee float64, orderstatus OrderStatus) (ledgerorder LedgerOrder) {
+
+	ledgerorder = LedgerOrder{
+		Leg:           leg,
+		Venue:         venue,
+		Symbol:        pair.Symbol,
+		Side:          side,
+		OrderId:       orderstatus.Id,
+		ClientOrderId: orderstatus.ClientOrderId,
+		Status:        orderstatus.Status,
+		Reason:        orderstatus.Reason,
+		BaseAmount:    orderstatus.BaseAmount,
+		Price:         price,
+		BaseFilled:    orderstatus.BaseFilled,
+		AveragePrice:  orderstatus.AveragePrice,
+		Notional:      orderstatus.Notional,
+		Fee:           orderstatus.Fee,
+		FeeCurrency:   orderstatus.FeeCurrency,
+	}
+
+	if ledgerorder.FeeCurrency == `` {
+
+		ledgerorder.FeeCurrency = pair.FeeCurrency(side)
+	}
+
+	if orderstatus.BaseFilled.Sign() <= 0 || orderstatus.Notional.Sign() > 0 {
+
+		return
+	}
+
+	var estimatednotional Decimal = orderstatus.BaseFilled.Mul(price).Round(pair.QuotePrecision)
+	var estimatedfee Decimal = estimatednotional.Mul(DecimalFromFloat(fee)).Round(pair.QuotePrecision)
+
+	if ledgerorder.FeeCurrency == pair.BaseCurrency {
+
+		estimatedfee = orderstatus.BaseFilled.Mul(DecimalFromFloat(fee)).Round(pair.BasePrecision)
+	}
+
+	ledgerorder.EstimatedNotional = &estimatednotional
+	ledgerorder.EstimatedFee = &estimatedfee
+
+	return
+}
+
+func LedgerLevels(levels []Level) []Level {
+
+	if len(levels) > LedgerDepthLevels {
+
+		return levels[:LedgerDepthLevels]
+	}
+
+	return levels
+}
+
+func (ledger *Ledger) Filename(day time.Time) string {
+
+	return filepath.Join(ledger.Dir, strings.Join([]string{`ledger-`, day.UTC().Format(LedgerDateLayout), `.jsonl`}, ``))
+}
+
+func (ledger *Ledger) Record(ledgerentry LedgerEntry) (err error) {
+
+	if ledger.Dir == `` {
+
+		return
+	}
+
+	ledger.Mutex.Lock()
+
+	defer ledger.Mutex.Unlock()
+
+	var line []byte
+
+	if line, err = json.Marshal(ledgerentry); err != nil {
+
+		return
+	}
+
+	if err = os.MkdirAll(ledger.Dir, 0o755); err != nil {
+
+		return
+	}
+
+	var file *os.File
+
+	if file, err = os.OpenFile(ledger.Filename(ledgerentry.Time), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+
+		return
+	}
+
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+
+	return
+}
+
+func (ledger *Ledger) Query(account string, from time.Time, to time.Time) (ledgerentries []LedgerEntry, err error) {
+
+	ledger.Mutex.Lock()
+
+	defer ledger.Mutex.Unlock()
+
+	var filenames []string
+
+	if filenames, err = filepath.Glob(filepath.Join(ledger.Dir, `ledger-*.jsonl`)); err != nil {
+
+		return
+	}
+
+	sort.Strings(filenames)
+
+	var fromname string = ``
+	var toname string = ``
+
+	if !from.IsZero() {
+
+		fromname = ledger.Filename(from)
+	}
+
+	if !to.IsZero() {
+
+		toname = ledger.Filename(to)
+	}
+
+	var fileindex int = 0
+	var filelength int = len(filenames)
+
+	for fileindex = 0; fileindex < filelength; fileindex++ {
+
+		var filename string = filenames[fileindex]
+
+		if fromname != `` && filename < fromname || toname != `` && filename > toname {
+
+			continue
+		}
+
+		if err = ReadLedgerFile(filename, func(ledgerentry LedgerEntry) {
+
+			if account != `` && ledgerentry.Account != account {
+
+				return
+			}
+
+			if !from.IsZero() && ledgerentry.Time.Before(from) || !to.IsZero() && !ledgerentry.Time.Before(to) {
+
+				return
+			}
+
+			ledgerentries = append(ledgerentries, ledgerentry)
+
+		}); err != nil {
+
+			return
+		}
+	}
+
+	return
+}
+
+func ReadLedgerFile(filename string, read func(LedgerEntry)) (err error) {
+
+	var file *os.File
+
+	if file, err = os.Open(filename); err != nil {
+
+		return
+	}
+
+	defer file.Close()
+
+	var scanner *bufio.Scanner = bufio.NewScanner(file)
+
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var line int = 0
+
+	for scanner.Scan() {
+
+		line += 1
+
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+
+			continue
+		}
+
+		var ledgerentry LedgerEntry
+
+		if err = json.Unmarshal(scanner.Bytes(), &ledgerentry); err != nil {
+
+			err = errors.New(strings.Join([]string{filename, strconv.Itoa(line), err.Error()}, `: `))
+
+			return
+		}
+
+		read(ledgerentry)
+	}
+
+	err = scanner.Err()
+
+	return
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MetricCounter   = `counter`
+	MetricGauge     = `gauge`
+	MetricHistogram = `histogram`
+)
+
+type Metrics struct {
+	Mutex    sync.Mutex
+	Families []*MetricFamily
+}
+
+type MetricFamily struct {
+	Mutex   sync.Mutex
+	Name    string
+	Help    string
+	Type    string
+	Labels  []string
+	Buckets []float64
+	Series  map[string]*MetricSeries
+}
+
+type MetricSeries struct {
+	Values []string
+	Value  float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+var DefaultMetrics *Metrics = &Metrics{}
+
+var MetricLatencyBuckets []float64 = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	MetricApiRequests   *MetricFamily = DefaultMetrics.Register(`algo_api_requests_total`, `Exchange API requests by response status code, 0 for transport errors.`, MetricCounter, nil, `venue`, `method`, `endpoint`, `code`)
+	MetricApiErrors     *MetricFamily = DefaultMetrics.Register(`algo_api_errors_total`, `Exchange API requests that returned an error.`, MetricCounter, nil, `venue`, `method`, `endpoint`)
+	MetricApiLatency    *MetricFamily = DefaultMetrics.Register(`algo_api_request_duration_seconds`, `Exchange API request latency.`, MetricHistogram, MetricLatencyBuckets, `venue`, `method`, `endpoint`)
+	MetricApiRetries    *MetricFamily = DefaultMetrics.Register(`algo_api_retries_total`, `Exchange API requests retried after a transient error or 429.`, MetricCounter, nil, `venue`, `method`, `endpoint`)
+	MetricBalance       *MetricFamily = DefaultMetrics.Register(`algo_balance`, `Available balance read before the last evaluation.`, MetricGauge, nil, `account`, `venue`, `currency`)
+	MetricGrossPercent  *MetricFamily = DefaultMetrics.Register(`algo_spread_percent`, `Gross spread between the buy and sell books in the last evaluation.`, MetricGauge, nil, `account`, `buy`, `sell`)
+	MetricNetPercent    *MetricFamily = DefaultMetrics.Register(`algo_profit_percent`, `Net bitcoin profit percent after fees in the last evaluation.`, MetricGauge, nil, `account`, `buy`, `sell`)
+	MetricEvaluations   *MetricFamily = DefaultMetrics.Register(`algo_evaluations_total`, `Arbitrage evaluations.`, MetricCounter, nil, `account`)
+	MetricOpportunities *MetricFamily = DefaultMetrics.Register(`algo_opportunities_total`, `Evaluations above the profit margin.`, MetricCounter, nil, `account`)
+	MetricShortfalls    *MetricFamily = DefaultMetrics.Register(`algo_shortfalls_total`, `Evaluations where the book could not fill the notional, by side and whether the trade was scaled down.`, MetricCounter, nil, `account`, `side`, `scaled`)
+	MetricExecutions    *MetricFamily = DefaultMetrics.Register(`algo_executions_total`, `Executed arbitrages, live or paper.`, MetricCounter, nil, `account`, `mode`)
+	MetricUnhedged      *MetricFamily = DefaultMetrics.Register(`algo_unhedged_total`, `Executions left with an alerted residual position.`, MetricCounter, nil, `account`)
+	MetricFxRateAge     *MetricFamily = DefaultMetrics.Register(`algo_fx_rate_age_seconds`, `Age of the ECB reference rates used by the last cycle.`, MetricGauge, nil)
+	MetricLastCycle     *MetricFamily = DefaultMetrics.Register(`algo_last_cycle_timestamp_seconds`, `Unix time the last cycle finished.`, MetricGauge, nil)
+	MetricCycleDuration *MetricFamily = DefaultMetrics.Register(`algo_cycle_duration_seconds`, `Duration of the last cycle.`, MetricGauge, nil)
+	MetricErrors        *MetricFamily = DefaultMetrics.Register(`algo_errors_total`, `Route failures by error kind and the action taken.`, MetricCounter, nil, `account`, `kind`, `action`)
+)
+
+func (metrics *Metrics) Register(name string, help string, metrictype string, buckets []float64, labels ...string) (metricfamily *MetricFamily) {
+
+	metricfamily = &MetricFamily{
+		Name:    name,
+		Help:    help,
+		Type:    metrictype,
+		Labels:  labels,
+		Buckets: buckets,
+		Series:  map[string]*MetricSeries{},
+	}
+
+	metrics.Mutex.Lock()
+
+	defer metrics.Mutex.Unlock()
+
+	metrics.Families = append(metrics.Families, metricfamily)
+
+	return
+}
+
+func (metricfamily *MetricFamily) Get(values []string) (metricseries *MetricSeries) {
+
+	var key string = strings.Join(values, "\xff")
+
+	var found bool
+
+	if metricseries, found = metricfamily.Series[key]; !found {
+
+		metricseries = &MetricSeries{Values: append([]string{}, values...), Counts: make([]uint64, len(metricfamily.Buckets))}
+
+		metricfamily.Series[key] = metricseries
+	}
+
+	return
+}
+
+func (metricfamily *MetricFamily) Set(value float64, values ...string) {
+
+	metricfamily.Mutex.Lock()
+
+	defer metricfamily.Mutex.Unlock()
+
+	metricfamily.Get(values).Value = value
+}
+
+func (metricfamily *MetricFamily) Add(value float64, values ...string) {
+
+	metricfamily.Mutex.Lock()
+
+	defer metricfamily.Mutex.Unlock()
+
+	metricfamily.Get(values).Value += value
+}
+
+func (metricfamily *MetricFamily) Observe(value float64, values ...string) {
+
+	metricfamily.Mutex.Lock()
+
+	defer metricfamily.Mutex.Unlock()
+
+	var metricseries *MetricSeries = metricfamily.Get(values)
+
+	var bucketindex int = 0
+	var bucketlength int = len(metricfamily.Buckets)
+
+	for bucketindex = 0; bucketindex < bucketlength; bucketindex++ {
+
+		if value <= metricfamily.Buckets[bucketindex] {
+
+			metricseries.Counts[bucketindex] += 1
+		}
+	}
+
+	metricseries.Sum += value
+	metricseries.Count += 1
+}
+
+func (metrics *Metrics) Write(writer io.Writer) (err error) {
+
+	metrics.Mutex.Lock()
+
+	var families []*MetricFamily = append([]*MetricFamily{}, metrics.Families...)
+
+	metrics.Mutex.Unlock()
+
+	sort.Slice(families, func(first int, second int) bool {
+
+		return families[first].Name < families[second].Name
+	})
+
+	var bufferedwriter *bufio.Writer = bufio.NewWriter(writer)
+
+	var familyindex int = 0
+	var familylength int = len(families)
+
+	for familyindex = 0; familyindex < familylength; familyindex++ {
+
+		families[familyindex].Write(bufferedwriter)
+	}
+
+	err = bufferedwriter.Flush()
+
+	return
+}
+
+func (metricfamily *MetricFamily) Write(writer *bufio.Writer) {
+
+	metricfamily.Mutex.Lock()
+
+	defer metricfamily.Mutex.Unlock()
+
+	if len(metricfamily.Series) == 0 {
+
+		return
+	}
+
+	writer.WriteString(strings.Join([]string{`# HELP`, metricfamily.Name, metricfamily.Help}, ` `))
+	writer.WriteString("\n")
+	writer.WriteString(strings.Join([]string{`# TYPE`, metricfamily.Name, metricfamily.Type}, ` `))
+	writer.WriteString("\n")
+
+	var keys []string = make([]string, 0, len(metricfamily.Series))
+
+	var key string
+
+	for key = range metricfamily.Series {
+
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var keyindex int = 0
+	var keylength int = len(keys)
+
+	for keyindex = 0; keyindex < keylength; keyindex++ {
+
+		var metricseries *MetricSeries = metricfamily.Series[keys[keyindex]]
+
+		if metricfamily.Type != MetricHistogram {
+
+			WriteMetricSample(writer, metricfamily.Name, metricfamily.Labels, metricseries.Values, ``, ``, metricseries.Value)
+
+			continue
+		}
+
+		var bucketindex int = 0
+		var bucketlength int = len(metricfamily.Buckets)
+
+		for bucketindex = 0; bucketindex < bucketlength; bucketindex++ {
+
+			WriteMetricSample(writer, strings.Join([]string{metricfamily.Name, `bucket`}, `_`), metricfamily.Labels, metricseries.Values, `le`, FormatMetricValue(metricfamily.Buckets[bucketindex]), float64(metricseries.Counts[bucketindex]))
+		}
+
+		WriteMetricSample(writer, strings.Join([]string{metricfamily.Name, `bucket`}, `_`), metricfamily.Labels, metricseries.Values, `le`, `+Inf`, float64(metricseries.Count))
+		WriteMetricSample(writer, strings.Join([]string{metricfamily.Name, `sum`}, `_`), metricfamily.Labels, metricseries.Values, ``, ``, metricseries.Sum)
+		WriteMetricSample(writer, strings.Join([]string{metricfamily.Name, `count`}, `_`), metricfamily.Labels, metricseries.Values, ``, ``, float64(metricseries.Count))
+	}
+}
+
+func WriteMetricSample(writer *bufio.Writer, name string, labels []string, values []string, extralabel string, extravalue string, value float64) {
+
+	var pairs []string = []string{}
+
+	var labelindex int = 0
+	var labellength int = len(labels)
+
+	for labelindex = 0; labelindex < labellength; labelindex++ {
+
+		pairs = append(pairs, strings.Join([]string{labels[labelindex], `="`, EscapeMetricLabel(values[labelindex]), `"`}, ``))
+	}
+
+	if extralabel != `` {
+
+		pairs = append(pairs, strings.Join([]string{extralabel, `="`, extravalue, `"`}, ``))
+	}
+
+	writer.WriteString(name)
+
+	if len(pairs) > 0 {
+
+		writer.WriteString(strings.Join([]string{`{`, strings.Join(pairs, `,`), `}`}, ``))
+	}
+
+	writer.WriteString(` `)
+	writer.WriteString(FormatMetricValue(value))
+	writer.WriteString("\n")
+}
+
+func EscapeMetricLabel(value string) string {
+
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func FormatMetricValue(value float64) string {
+
+	switch {
+
+	case math.IsInf(value, 1):
+
+		return `+Inf`
+
+	case math.IsInf(value, -1):
+
+		return `-Inf`
+
+	case math.IsNaN(value):
+
+		return `NaN`
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func MetricEndpoint(path string) string {
+
+	var segments []string = strings.Split(strings.ToLower(path), `/`)
+
+	var segmentindex int = 0
+	var segmentlength int = len(segments)
+
+	for segmentindex = 0; segmentindex < segmentlength; segmentindex++ {
+
+		if strings.ContainsAny(segments[segmentindex], `0123456789`) && segments[segmentindex] != `v1` && segments[segmentindex] != `v2` {
+
+			segments[segmentindex] = `:id`
+		}
+	}
+
+	return strings.Join(segments, `/`)
+}
+
+func ObserveApiCall(venue string, method string, path string, statuscode int, failed bool, elapsed time.Duration) {
+
+	var endpoint string = MetricEndpoint(path)
+
+	MetricApiRequests.Add(1, venue, method, endpoint, strconv.Itoa(statuscode))
+	MetricApiLatency.Observe(elapsed.Seconds(), venue, method, endpoint)
+
+	if failed {
+
+		MetricApiErrors.Add(1, venue, method, endpoint)
+	}
+}
+
+func ObserveArbitrage(arbitragerequest ArbitrageRequest, arbitrageresponse ArbitrageResponse) {
+
+	var account string = arbitragerequest.Account
+
+	var buyexchange Exchange = arbitragerequest.BuyExchange
+	var sellexchange Exchange = arbitragerequest.SellExchange
+
+	MetricBalance.Set(arbitrageresponse.BuyQuoteBalance.Float64(), account, buyexchange.Name(), buyexchange.Pair().QuoteCurrency)
+	MetricBalance.Set(arbitrageresponse.SellBaseBalance.Float64(), account, sellexchange.Name(), sellexchange.Pair().BaseCurrency)
+
+	MetricGrossPercent.Set(arbitrageresponse.Evaluation.GrossPercent, account, buyexchange.Name(), sellexchange.Name())
+	MetricNetPercent.Set(arbitrageresponse.Evaluation.NetPercent, account, buyexchange.Name(), sellexchange.Name())
+
+	MetricEvaluations.Add(1, account)
+
+	if arbitrageresponse.Evaluation.Opportunity {
+
+		MetricOpportunities.Add(1, account)
+	}
+
+	var scaled string = strconv.FormatBool(arbitrageresponse.Evaluation.Scaled)
+
+	if arbitrageresponse.Evaluation.BuyShortfall.Sign() > 0 {
+
+		MetricShortfalls.Add(1, account, `buy`, scaled)
+	}
+
+	if arbitrageresponse.Evaluation.SellShortfall.Sign() > 0 {
+
+		MetricShortfalls.Add(1, account, `sell`, scaled)
+	}
+
+	if arbitrageresponse.Executed {
+
+		var mode string = `live`
+
+		if arbitrageresponse.Paper {
+
+			mode = `paper`
+		}
+
+		MetricExecutions.Add(1, account, mode)
+	}
+
+	if arbitrageresponse.Hedge.State == HedgeAlerted {
+
+		MetricUnhedged.Add(1, account)
+	}
+}
+
+func ServeMetrics(address string, metrics *Metrics) {
+
+	var servemux *http.ServeMux = http.NewServeMux()
+
+	servemux.HandleFunc(`/metrics`, func(responsewriter http.ResponseWriter, httprequest *http.Request) {
+
+		responsewriter.Header().Set(`Content-Type`, `text/plain; version=0.0.4; charset=utf-8`)
+
+		if err := metrics.Write(responsewriter); err != nil {
+
+			log.Printf(`Error('metrics: %+[1]v')`, err)
+		}
+	})
+
+	var httpserver *http.Server = &http.Server{Addr: address, Handler: servemux, ReadHeaderTimeout: 10 * time.Second}
+
+	log.Printf(`metrics: listening on %[1]v`, address)
+
+	if err := httpserver.ListenAndServe(); err != nil {
+
+		log.Printf(`Error('metrics: %+[1]v')`, err)
+	}
+}
@@ -0,0 +1,2142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const MockConfig string = `{
+	"venues": {
+		"bitstamp": {"exchange": "bitstamp", "host": "%[1]v", "fees": {"maker": 0.003, "taker": 0.004}},
+		"valr": {"exchange": "valr", "host": "%[2]v", "fees": {"maker": 0, "taker": 0.001}}
+	},
+	"strategy": {
+		"profitmargin": 0,
+		"executetrade": true,
+		"hedge": {"mode": "rehedge", "aggressiveness": 0.001, "attempts": 3}
+	},
+	"accounts": [
+		{
+			"name": "trader",
+			"credentials": {
+				"bitstamp": {"key": "BITSTAMP_KEY", "secret": "BITSTAMP_SECRET", "customer": "BITSTAMP_CUSTOMER"},
+				"valr": {"key": "VALR_KEY", "secret": "VALR_SECRET"}
+			},
+			"routes": [{"buy": "bitstamp", "buypair": "btcusd", "sell": "valr", "sellpair": "btczar", "limit": 1000, "limitcurrency": "usd"}]
+		},
+		{
+			"name": "badbitstamp",
+			"credentials": {
+				"bitstamp": {"key": "BITSTAMP_KEY", "secret": "WRONG_SECRET", "customer": "BITSTAMP_CUSTOMER"},
+				"valr": {"key": "VALR_KEY", "secret": "VALR_SECRET"}
+			},
+			"routes": [{"buy": "bitstamp", "buypair": "btcusd", "sell": "valr", "sellpair": "btczar", "limit": 1000, "limitcurrency": "usd"}]
+		},
+		{
+			"name": "badvalr",
+			"credentials": {
+				"bitstamp": {"key": "BITSTAMP_KEY", "secret": "BITSTAMP_SECRET", "customer": "BITSTAMP_CUSTOMER"},
+				"valr": {"key": "VALR_KEY", "secret": "WRONG_SECRET"}
+			},
+			"routes": [{"buy": "bitstamp", "buypair": "btcusd", "sell": "valr", "sellpair": "btczar", "limit": 1000, "limitcurrency": "usd"}]
+		}
+	]
+}`
+
+const (
+	MockBitstampWindow time.Duration = 150 * time.Second
+	MockValrWindow     time.Duration = 60 * time.Second
+)
+
+type MockLevel struct {
+	Price  Decimal
+	Amount Decimal
+}
+
+type MockBook struct {
+	Bids []MockLevel
+	Asks []MockLevel
+}
+
+type MockOrder struct {
+	Id            string
+	ClientOrderId string
+	Symbol        string
+	Side          string
+	Market        bool
+	TimeInForce   string
+	BaseAmount    Decimal
+	Price         Decimal
+	BaseFilled    Decimal
+	Notional      Decimal
+	Fee           Decimal
+	FeeCurrency   string
+	Status        string
+	Reason        string
+	Created       time.Time
+}
+
+type MockFailure struct {
+	Method     string
+	Path       string
+	Status     int
+	Body       string
+	RetryAfter string
+	Delay      time.Duration
+}
+
+type MockExchange struct {
+	Mutex    sync.Mutex
+	Venue    string
+	Key      string
+	Secret   string
+	Maker    float64
+	Taker    float64
+	Balances map[string]Decimal
+	Books    map[string]*MockBook
+	Orders   []*MockOrder
+	Nonces   map[string]time.Time
+	Failures []MockFailure
+	Requests []string
+	Clock    func() time.Time
+	Hook     func(*http.Request)
+}
+
+func NewMockExchange(venue string, key string, secret string) *MockExchange {
+
+	return &MockExchange{
+		Venue:    venue,
+		Key:      key,
+		Secret:   secret,
+		Balances: map[string]Decimal{},
+		Books:    map[string]*MockBook{},
+		Nonces:   map[string]time.Time{},
+	}
+}
+
+func NewMockServer(mockexchange *MockExchange) *httptest.Server {
+
+	return httptest.NewServer(mockexchange)
+}
+
+func (mockexchange *MockExchange) Now() time.Time {
+
+	if mockexchange.Clock != nil {
+
+		return mockexchange.Clock()
+	}
+
+	return time.Now()
+}
+
+func (mockexchange *MockExchange) SetBook(symbol string, bids []MockLevel, asks []MockLevel) {
+
+	mockexchange.Mutex.Lock()
+
+	defer mockexchange.Mutex.Unlock()
+
+	var mockbook *MockBook = &MockBook{
+		Bids: append([]MockLevel{}, bids...),
+		Asks: append([]MockLevel{}, asks...),
+	}
+
+	mockbook.Sort()
+
+	mockexchange.Books[strings.ToLower(symbol)] = mockbook
+}
+
+func (mockexchange *MockExchange) SetBalance(currency string, amount Decimal) {
+
+	mockexchange.Mutex.Lock()
+
+	defer mockexchange.Mutex.Unlock()
+
+	mockexchange.Balances[strings.ToLower(currency)] = amount
+}
+
+func (mockexchange *MockExchange) Balance(currency string) Decimal {
+
+	mockexchange.Mutex.Lock()
+
+	defer mockexchange.Mutex.Unlock()
+
+	return mockexchange.Balances[strings.ToLower(currency)]
+}
+
+func (mockexchange *MockExchange) Fail(mockfailure MockFailure) {
+
+	mockexchange.Mutex.Lock()
+
+	defer mockexchange.Mutex.Unlock()
+
+	mockexchange.Failures = append(mockexchange.Failures, mockfailure)
+}
+
+func (mockexchange *MockExchange) Order(id string) (mockorder MockOrder, found bool) {
+
+	mockexchange.Mutex.Lock()
+
+	defer mockexchange.Mutex.Unlock()
+
+	var order *MockOrder
+
+	if order, found = mockexchange.FindOrder(id, ``); found {
+
+		mockorder = *order
+	}
+
+	return
+}
+
+func (mockexchange *MockExchange) FindOrder(id string, clientorderid string) (mockorder *MockOrder, found bool) {
+
+	var orderindex int = 0
+	var orderlength int = len(mockexchange.Orders)
+
+	for orderindex = 0; orderindex < orderlength; orderindex++ {
+
+		mockorder = mockexchange.Orders[orderindex]
+
+		if id != `` && mockorder.Id == id || id == `` && clientorderid != `` && mockorder.ClientOrderId == clientorderid {
+
+			found = true
+
+			return
+		}
+	}
+
+	mockorder = nil
+
+	return
+}
+
+func (mockbook *MockBook) Sort() {
+
+	sort.SliceStable(mockbook.Bids, func(first int, second int) bool {
+
+		return mockbook.Bids[first].Price.GreaterThan(mockbook.Bids[second].Price)
+	})
+
+	sort.SliceStable(mockbook.Asks, func(first int, second int) bool {
+
+		return mockbook.Asks[first].Price.LessThan(mockbook.Asks[second].Price)
+	})
+}
+
+func (mockbook *MockBook) Fill(side string, baseamount Decimal, quoteamount Decimal, price Decimal, market bool, consume bool) (basefilled Decimal, notional Decimal) {
+
+	basefilled = DecimalZero
+	notional = DecimalZero
+
+	var levels []MockLevel = mockbook.Asks
+
+	if side == Sell {
+
+		levels = mockbook.Bids
+	}
+
+	var levelindex int = 0
+	var levellength int = len(levels)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		var level MockLevel = levels[levelindex]
+
+		if !market && (side == Buy && level.Price.GreaterThan(price) || side == Sell && level.Price.LessThan(price)) {
+
+			break
+		}
+
+		var take Decimal = MinDecimal(baseamount.Sub(basefilled), level.Amount)
+
+		if quoteamount.Sign() > 0 {
+
+			take = MinDecimal(quoteamount.Sub(notional).Div(level.Price, 8), level.Amount)
+		}
+
+		if take.Sign() <= 0 {
+
+			break
+		}
+
+		basefilled = basefilled.Add(take)
+		notional = notional.Add(take.Mul(level.Price))
+
+		if consume {
+
+			levels[levelindex].Amount = level.Amount.Sub(take)
+		}
+	}
+
+	if !consume {
+
+		return
+	}
+
+	var remaining []MockLevel = []MockLevel{}
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		if levels[levelindex].Amount.Sign() > 0 {
+
+			remaining = append(remaining, levels[levelindex])
+		}
+	}
+
+	if side == Sell {
+
+		mockbook.Bids = remaining
+
+	} else {
+
+		mockbook.Asks = remaining
+	}
+
+	return
+}
+
+func (mockexchange *MockExchange) Execute(mockorder *MockOrder, quoteamount Decimal, pair Pair, feeinbase bool) (err error) {
+
+	var mockbook *MockBook = mockexchange.Books[pair.Symbol]
+
+	if mockbook == nil {
+
+		mockbook = &MockBook{}
+
+		mockexchange.Books[pair.Symbol] = mockbook
+	}
+
+	var fee Decimal = DecimalFromFloat(mockexchange.Taker)
+
+	var basefilled Decimal
+	var notional Decimal
+
+	basefilled, notional = mockbook.Fill(mockorder.Side, mockorder.BaseAmount, quoteamount, mockorder.Price, mockorder.Market, false)
+
+	basefilled = basefilled.Truncate(pair.BasePrecision)
+	notional = notional.Round(pair.QuotePrecision)
+
+	if mockorder.TimeInForce == `FOK` && basefilled.LessThan(mockorder.BaseAmount) {
+
+		basefilled = DecimalZero
+		notional = DecimalZero
+	}
+
+	var required Decimal = mockorder.BaseAmount
+	var available Decimal = mockexchange.Balances[pair.BaseCurrency]
+	var currency string = pair.BaseCurrency
+
+	if mockorder.Side == Buy {
+
+		required = mockorder.BaseAmount.Mul(mockorder.Price)
+
+		if mockorder.Market {
+
+			required = notional
+		}
+
+		if !feeinbase {
+
+			required = required.Add(required.Mul(fee))
+		}
+
+		required = required.Round(pair.QuotePrecision)
+		available = mockexchange.Balances[pair.QuoteCurrency]
+		currency = pair.QuoteCurrency
+
+	} else if mockorder.Market {
+
+		required = basefilled
+	}
+
+	if required.GreaterThan(available) {
+
+		err = fmt.Errorf(`You need %[1]v %[2]v to open that order. You have only %[3]v %[2]v available. Check your account balance for details.`, required, strings.ToUpper(currency), available)
+
+		return
+	}
+
+	if basefilled.Sign() > 0 {
+
+		basefilled, notional = mockbook.Fill(mockorder.Side, basefilled, DecimalZero, mockorder.Price, true, true)
+
+		notional = notional.Round(pair.QuotePrecision)
+	}
+
+	mockorder.BaseFilled = basefilled
+	mockorder.Notional = notional
+	mockorder.FeeCurrency = pair.QuoteCurrency
+	mockorder.Fee = notional.Mul(fee).Round(pair.QuotePrecision)
+
+	if feeinbase && mockorder.Side == Buy {
+
+		mockorder.FeeCurrency = pair.BaseCurrency
+		mockorder.Fee = basefilled.Mul(fee).Round(pair.BasePrecision)
+	}
+
+	if mockorder.Side == Buy {
+
+		mockexchange.Balances[pair.QuoteCurrency] = mockexchange.Balances[pair.QuoteCurrency].Sub(notional)
+		mockexchange.Balances[pair.BaseCurrency] = mockexchange.Balances[pair.BaseCurrency].Add(basefilled)
+
+	} else {
+
+		mockexchange.Balances[pair.BaseCurrency] = mockexchange.Balances[pair.BaseCurrency].Sub(basefilled)
+		mockexchange.Balances[pair.QuoteCurrency] = mockexchange.Balances[pair.QuoteCurrency].Add(notional)
+	}
+
+	mockexchange.Balances[mockorder.FeeCurrency] = mockexchange.Balances[mockorder.FeeCurrency].Sub(mockorder.Fee)
+
+	var resting bool = !mockorder.Market && mockorder.TimeInForce != `IOC` && mockorder.TimeInForce != `FOK` && basefilled.LessThan(mockorder.BaseAmount)
+
+	if mockorder.Market {
+
+		mockorder.BaseAmount = basefilled
+	}
+
+	mockorder.Status = FillStatus(resting, mockorder.BaseAmount, basefilled)
+
+	return
+}
+
+func (mockexchange *MockExchange) PlaceOrder(mockorder *MockOrder, quoteamount Decimal, feeinbase bool) (err error) {
+
+	var pair Pair
+	var found bool
+
+	if pair, found = ExchangePairs[mockexchange.Venue][strings.ToLower(mockorder.Symbol)]; !found {
+
+		err = fmt.Errorf(`unknown currency pair %[1]v`, mockorder.Symbol)
+
+		return
+	}
+
+	mockorder.Symbol = pair.Symbol
+	mockorder.Created = mockexchange.Now().UTC()
+
+	if mockorder.Id == `` {
+
+		mockorder.Id = mockexchange.NextOrderId()
+	}
+
+	if err = mockexchange.Execute(mockorder, quoteamount, pair, feeinbase); err != nil {
+
+		return
+	}
+
+	mockexchange.Orders = append(mockexchange.Orders, mockorder)
+
+	return
+}
+
+func (mockexchange *MockExchange) NextOrderId() string {
+
+	var sequence int = len(mockexchange.Orders) + 1
+
+	if mockexchange.Venue == `valr` {
+
+		return fmt.Sprintf(`00000000-0000-4000-8000-%012[1]d`, sequence)
+	}
+
+	return strconv.Itoa(1000000000 + sequence)
+}
+
+func (mockexchange *MockExchange) ServeHTTP(responsewriter http.ResponseWriter, httprequest *http.Request) {
+
+	var body []byte
+
+	body, _ = io.ReadAll(httprequest.Body)
+
+	if mockexchange.Hook != nil {
+
+		mockexchange.Hook(httprequest)
+	}
+
+	var mockfailure MockFailure
+	var found bool
+
+	if mockfailure, found = mockexchange.Receive(httprequest); found {
+
+		select {
+
+		case <-time.After(mockfailure.Delay):
+
+		case <-httprequest.Context().Done():
+
+			return
+		}
+
+		if mockfailure.Status != 0 {
+
+			if mockfailure.RetryAfter != `` {
+
+				responsewriter.Header().Set(`Retry-After`, mockfailure.RetryAfter)
+			}
+
+			responsewriter.Header().Set(`Content-Type`, `application/json`)
+			responsewriter.WriteHeader(mockfailure.Status)
+			responsewriter.Write([]byte(mockfailure.Body))
+
+			return
+		}
+	}
+
+	mockexchange.Mutex.Lock()
+
+	defer mockexchange.Mutex.Unlock()
+
+	var status int
+	var value interface{}
+
+	switch mockexchange.Venue {
+
+	case `bitstamp`:
+
+		status, value = mockexchange.ServeBitstamp(httprequest, body)
+
+	case `valr`:
+
+		status, value = mockexchange.ServeValr(httprequest, body)
+
+	default:
+
+		status, value = http.StatusNotFound, map[string]string{`message`: `unknown venue`}
+	}
+
+	WriteMockResponse(responsewriter, status, value)
+}
+
+func (mockexchange *MockExchange) Receive(httprequest *http.Request) (mockfailure MockFailure, found bool) {
+
+	mockexchange.Mutex.Lock()
+
+	defer mockexchange.Mutex.Unlock()
+
+	mockexchange.Requests = append(mockexchange.Requests, strings.Join([]string{httprequest.Method, httprequest.URL.Path}, ` `))
+
+	var failureindex int = 0
+	var failurelength int = len(mockexchange.Failures)
+
+	for failureindex = 0; failureindex < failurelength; failureindex++ {
+
+		mockfailure = mockexchange.Failures[failureindex]
+
+		if (mockfailure.Method == `` || mockfailure.Method == httprequest.Method) && strings.HasPrefix(httprequest.URL.Path, mockfailure.Path) {
+
+			mockexchange.Failures = append(mockexchange.Failures[:failureindex], mockexchange.Failures[failureindex+1:]...)
+
+			found = true
+
+			return
+		}
+	}
+
+	mockfailure = MockFailure{}
+
+	return
+}
+
+func WriteMockResponse(responsewriter http.ResponseWriter, status int, value interface{}) {
+
+	if value == nil {
+
+		responsewriter.WriteHeader(status)
+
+		return
+	}
+
+	var responsebuffer *bytes.Buffer = new(bytes.Buffer)
+
+	json.NewEncoder(responsebuffer).Encode(value)
+
+	responsewriter.Header().Set(`Content-Type`, `application/json`)
+	responsewriter.WriteHeader(status)
+	responsewriter.Write(responsebuffer.Bytes())
+}
+
+func BitstampMockError(reason interface{}, code string) map[string]interface{} {
+
+	return map[string]interface{}{`status`: `error`, `reason`: reason, `code`: code}
+}
+
+func (mockexchange *MockExchange) VerifyBitstamp(httprequest *http.Request, body []byte) (status int, value interface{}) {
+
+	var authorisation string = httprequest.Header.Get(`X-Auth`)
+	var signature string = httprequest.Header.Get(`X-Auth-Signature`)
+	var nonce string = httprequest.Header.Get(`X-Auth-Nonce`)
+	var timestamp string = httprequest.Header.Get(`X-Auth-Timestamp`)
+	var version string = httprequest.Header.Get(`X-Auth-Version`)
+
+	if authorisation != strings.Join([]string{`BITSTAMP`, mockexchange.Key}, ` `) {
+
+		return http.StatusForbidden, BitstampMockError(`Missing key, signature and nonce parameters`, `API0001`)
+	}
+
+	if version != `v2` {
+
+		return http.StatusForbidden, BitstampMockError(`Wrong API version`, `API0004`)
+	}
+
+	var milliseconds int64
+	var err error
+
+	if milliseconds, err = strconv.ParseInt(timestamp, 10, 64); err != nil {
+
+		return http.StatusForbidden, BitstampMockError(`Invalid timestamp`, `API0017`)
+	}
+
+	var now time.Time = mockexchange.Now()
+
+	if skew := now.Sub(time.UnixMilli(milliseconds)); skew > MockBitstampWindow || skew < -MockBitstampWindow {
+
+		return http.StatusForbidden, BitstampMockError(`Timestamp too old`, `API0017`)
+	}
+
+	var nonceused time.Time
+	var found bool
+
+	if nonceused, found = mockexchange.Nonces[nonce]; len(nonce) != 36 || found && now.Sub(nonceused) <= MockBitstampWindow {
+
+		return http.StatusForbidden, BitstampMockError(`Invalid nonce`, `API0004`)
+	}
+
+	var query string = ``
+
+	if httprequest.URL.RawQuery != `` {
+
+		query = strings.Join([]string{`?`, httprequest.URL.RawQuery}, ``)
+	}
+
+	var contenttype string = httprequest.Header.Get(`Content-Type`)
+
+	if len(body) == 0 {
+
+		contenttype = ``
+	}
+
+	var hash hash.Hash = hmac.New(sha256.New, []byte(mockexchange.Secret))
+
+	hash.Write([]byte(authorisation))
+	hash.Write([]byte(httprequest.Method))
+	hash.Write([]byte(httprequest.Host))
+	hash.Write([]byte(httprequest.URL.Path))
+	hash.Write([]byte(query))
+	hash.Write([]byte(contenttype))
+	hash.Write([]byte(nonce))
+	hash.Write([]byte(timestamp))
+	hash.Write([]byte(version))
+	hash.Write(body)
+
+	if !hmac.Equal([]byte(strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))), []byte(signature)) {
+
+		return http.StatusForbidden, BitstampMockError(`Invalid signature`, `API0005`)
+	}
+
+	mockexchange.Nonces[nonce] = now
+
+	return
+}
+
+func (mockexchange *MockExchange) ServeBitstamp(httprequest *http.Request, body []byte) (status int, value interface{}) {
+
+	var segments []string = strings.Split(strings.Trim(httprequest.URL.Path, `/`), `/`)
+
+	if len(segments) < 3 || segments[0] != `api` || segments[1] != `v2` {
+
+		return http.StatusNotFound, BitstampMockError(`Not found`, `API0000`)
+	}
+
+	segments = segments[2:]
+
+	if segments[0] == `order_book` && len(segments) == 2 && httprequest.Method == http.MethodGet {
+
+		return mockexchange.BitstampOrderBook(segments[1])
+	}
+
+	if httprequest.Method != http.MethodPost {
+
+		return http.StatusMethodNotAllowed, BitstampMockError(`Method not allowed`, `API0000`)
+	}
+
+	if status, value = mockexchange.VerifyBitstamp(httprequest, body); status != 0 {
+
+		return
+	}
+
+	var form url.Values
+
+	form, _ = url.ParseQuery(string(body))
+
+	switch {
+
+	case segments[0] == `account_balances` && len(segments) == 1:
+
+		return mockexchange.BitstampBalances(``)
+
+	case segments[0] == `account_balances` && len(segments) == 2:
+
+		return mockexchange.BitstampBalances(segments[1])
+
+	case (segments[0] == `buy` || segments[0] == `sell`) && len(segments) == 2:
+
+		return mockexchange.BitstampOrder(segments[0], segments[1], false, form)
+
+	case (segments[0] == `buy` || segments[0] == `sell`) && len(segments) == 3 && segments[1] == `market`:
+
+		return mockexchange.BitstampOrder(segments[0], segments[2], true, form)
+
+	case segments[0] == `order_status` && len(segments) == 1:
+
+		return mockexchange.BitstampOrderStatus(form.Get(`id`), form.Get(`client_order_id`))
+
+	case segments[0] == `cancel_order` && len(segments) == 1:
+
+		return mockexchange.BitstampCancelOrder(form.Get(`id`))
+
+	case segments[0] == `fees` && len(segments) == 3 && segments[1] == `trading`:
+
+		return mockexchange.BitstampTradingFees(segments[2])
+	}
+
+	return http.StatusNotFound, BitstampMockError(`Not found`, `API0000`)
+}
+
+func (mockexchange *MockExchange) BitstampOrderBook(symbol string) (status int, value interface{}) {
+
+	var mockbook *MockBook = mockexchange.Books[symbol]
+
+	if mockbook == nil {
+
+		return http.StatusNotFound, BitstampMockError(`Currency pair not found`, `API0000`)
+	}
+
+	var now time.Time = mockexchange.Now()
+
+	var bitstamporderbook BitstampOrderBook = BitstampOrderBook{
+		Timestamp:      strconv.FormatInt(now.Unix(), 10),
+		Microtimestamp: strconv.FormatInt(now.UnixMicro(), 10),
+		Bids:           [][]string{},
+		Asks:           [][]string{},
+	}
+
+	var levelindex int = 0
+	var levellength int = len(mockbook.Bids)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		bitstamporderbook.Bids = append(bitstamporderbook.Bids, []string{mockbook.Bids[levelindex].Price.String(), mockbook.Bids[levelindex].Amount.String()})
+	}
+
+	levellength = len(mockbook.Asks)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		bitstamporderbook.Asks = append(bitstamporderbook.Asks, []string{mockbook.Asks[levelindex].Price.String(), mockbook.Asks[levelindex].Amount.String()})
+	}
+
+	return http.StatusOK, bitstamporderbook
+}
+
+func (mockexchange *MockExchange) BitstampBalances(currency string) (status int, value interface{}) {
+
+	var bitstampbalances []BitstampBalance = []BitstampBalance{}
+
+	var currencies []string = []string{}
+
+	for balancecurrency := range mockexchange.Balances {
+
+		currencies = append(currencies, balancecurrency)
+	}
+
+	sort.Strings(currencies)
+
+	var currencyindex int = 0
+	var currencylength int = len(currencies)
+
+	for currencyindex = 0; currencyindex < currencylength; currencyindex++ {
+
+		var balance Decimal = mockexchange.Balances[currencies[currencyindex]]
+
+		var bitstampbalance BitstampBalance = BitstampBalance{
+			Currency:  currencies[currencyindex],
+			Total:     balance.String(),
+			Available: balance.String(),
+			Reserved:  `0`,
+		}
+
+		if currency == currencies[currencyindex] {
+
+			return http.StatusOK, bitstampbalance
+		}
+
+		bitstampbalances = append(bitstampbalances, bitstampbalance)
+	}
+
+	if currency != `` {
+
+		return http.StatusOK, BitstampBalance{Currency: currency, Total: `0`, Available: `0`, Reserved: `0`}
+	}
+
+	return http.StatusOK, bitstampbalances
+}
+
+func (mockexchange *MockExchange) BitstampOrder(side string, symbol string, market bool, form url.Values) (status int, value interface{}) {
+
+	var mockorder *MockOrder = &MockOrder{
+		ClientOrderId: form.Get(`client_order_id`),
+		Symbol:        symbol,
+		Side:          strings.ToUpper(side),
+		Market:        market,
+		TimeInForce:   `GTC`,
+	}
+
+	var err error
+
+	if mockorder.BaseAmount, err = ParseDecimal(form.Get(`amount`)); err != nil || mockorder.BaseAmount.Sign() <= 0 {
+
+		return http.StatusOK, BitstampMockError(map[string][]string{`amount`: {`Ensure this value is greater than or equal to 1E-8.`}}, `API0002`)
+	}
+
+	if !market {
+
+		if mockorder.Price, err = ParseDecimal(form.Get(`price`)); err != nil || mockorder.Price.Sign() <= 0 {
+
+			return http.StatusOK, BitstampMockError(map[string][]string{`price`: {`Ensure this value is greater than or equal to 1E-8.`}}, `API0002`)
+		}
+	}
+
+	switch {
+
+	case form.Get(`ioc_order`) == `true`:
+
+		mockorder.TimeInForce = `IOC`
+
+	case form.Get(`fok_order`) == `true`:
+
+		mockorder.TimeInForce = `FOK`
+	}
+
+	if mockorder.ClientOrderId != `` {
+
+		if _, found := mockexchange.FindOrder(``, mockorder.ClientOrderId); found {
+
+			return http.StatusOK, BitstampMockError(map[string][]string{`__all__`: {`Client order id already used.`}}, `API0002`)
+		}
+	}
+
+	if err = mockexchange.PlaceOrder(mockorder, DecimalZero, false); err != nil {
+
+		return http.StatusOK, BitstampMockError(map[string][]string{`__all__`: {err.Error()}}, `API0003`)
+	}
+
+	var ordertype string = `0`
+
+	if mockorder.Side == Sell {
+
+		ordertype = `1`
+	}
+
+	return http.StatusOK, BitstampOrder{
+		Id:            mockorder.Id,
+		DateTime:      mockorder.Created.Format(`2006-01-02 15:04:05.000000`),
+		Type:          ordertype,
+		Price:         mockorder.Price.String(),
+		Amount:        mockorder.BaseAmount.String(),
+		ClientOrderId: mockorder.ClientOrderId,
+	}
+}
+
+func (mockexchange *MockExchange) BitstampOrderStatus(id string, clientorderid string) (status int, value interface{}) {
+
+	var mockorder *MockOrder
+	var found bool
+
+	if mockorder, found = mockexchange.FindOrder(id, clientorderid); !found {
+
+		return http.StatusOK, BitstampMockError(`Order not found.`, `API0013`)
+	}
+
+	var ordertype string = `0`
+
+	if mockorder.Side == Sell {
+
+		ordertype = `1`
+	}
+
+	var bitstampstatus string = `Finished`
+
+	switch mockorder.Status {
+
+	case OrderOpen:
+
+		bitstampstatus = `Open`
+
+	case OrderCancelled, OrderPartiallyFilled:
+
+		bitstampstatus = `Canceled`
+	}
+
+	var transactions []map[string]string = []map[string]string{}
+
+	if mockorder.BaseFilled.Sign() > 0 {
+
+		var pair Pair = ExchangePairs[mockexchange.Venue][mockorder.Symbol]
+
+		transactions = append(transactions, map[string]string{
+			`tid`:              strings.Join([]string{mockorder.Id, `1`}, ``),
+			`price`:            mockorder.Notional.Div(mockorder.BaseFilled, pair.QuotePrecision+2).String(),
+			`fee`:              mockorder.Fee.String(),
+			`datetime`:         mockorder.Created.Format(`2006-01-02 15:04:05`),
+			`type`:             `2`,
+			pair.BaseCurrency:  mockorder.BaseFilled.String(),
+			pair.QuoteCurrency: mockorder.Notional.String(),
+		})
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		`id`:               mockorder.Id,
+		`datetime`:         mockorder.Created.Format(`2006-01-02 15:04:05`),
+		`type`:             ordertype,
+		`status`:           bitstampstatus,
+		`market`:           strings.ToUpper(mockorder.Symbol),
+		`transactions`:     transactions,
+		`amount_remaining`: mockorder.BaseAmount.Sub(mockorder.BaseFilled).String(),
+		`client_order_id`:  mockorder.ClientOrderId,
+	}
+}
+
+func (mockexchange *MockExchange) BitstampCancelOrder(id string) (status int, value interface{}) {
+
+	var mockorder *MockOrder
+	var found bool
+
+	if mockorder, found = mockexchange.FindOrder(id, ``); !found || mockorder.Status != OrderOpen {
+
+		return http.StatusOK, BitstampMockError(`Order not found`, `API0013`)
+	}
+
+	mockorder.Status = FillStatus(false, mockorder.BaseAmount, mockorder.BaseFilled)
+
+	return http.StatusOK, BitstampOrder{
+		Id:     mockorder.Id,
+		Price:  mockorder.Price.String(),
+		Amount: mockorder.BaseAmount.Sub(mockorder.BaseFilled).String(),
+	}
+}
+
+func (mockexchange *MockExchange) BitstampTradingFees(symbol string) (status int, value interface{}) {
+
+	if _, found := ExchangePairs[mockexchange.Venue][symbol]; !found {
+
+		return http.StatusNotFound, BitstampMockError(`Currency pair not found`, `API0000`)
+	}
+
+	var bitstamptradingfee BitstampTradingFee = BitstampTradingFee{CurrencyPair: symbol, Market: symbol}
+
+	bitstamptradingfee.Fees.Maker = strconv.FormatFloat(mockexchange.Maker*100.0, 'f', 3, 64)
+	bitstamptradingfee.Fees.Taker = strconv.FormatFloat(mockexchange.Taker*100.0, 'f', 3, 64)
+
+	return http.StatusOK, bitstamptradingfee
+}
+
+func ValrMockError(code int, message string) map[string]interface{} {
+
+	return map[string]interface{}{`code`: code, `message`: message}
+}
+
+func (mockexchange *MockExchange) VerifyValr(httprequest *http.Request, body []byte) (status int, value interface{}) {
+
+	if httprequest.Header.Get(`X-VALR-API-KEY`) != mockexchange.Key {
+
+		return http.StatusUnauthorized, ValrMockError(-11252, `API key or secret is invalid`)
+	}
+
+	var timestamp string = httprequest.Header.Get(`X-VALR-TIMESTAMP`)
+
+	var milliseconds int64
+	var err error
+
+	if milliseconds, err = strconv.ParseInt(timestamp, 10, 64); err != nil {
+
+		return http.StatusUnauthorized, ValrMockError(-11252, `Request has an invalid timestamp`)
+	}
+
+	if skew := mockexchange.Now().Sub(time.UnixMilli(milliseconds)); skew > MockValrWindow || skew < -MockValrWindow {
+
+		return http.StatusUnauthorized, ValrMockError(-11252, `Request has expired`)
+	}
+
+	var signature string = ValrSignature(mockexchange.Secret, timestamp, httprequest.Method, httprequest.URL.RequestURI(), body)
+
+	if !hmac.Equal([]byte(signature), []byte(httprequest.Header.Get(`X-VALR-SIGNATURE`))) {
+
+		return http.StatusUnauthorized, ValrMockError(-11252, `Request has an invalid signature`)
+	}
+
+	return
+}
+
+func (mockexchange *MockExchange) ServeValr(httprequest *http.Request, body []byte) (status int, value interface{}) {
+
+	if status, value = mockexchange.VerifyValr(httprequest, body); status != 0 {
+
+		return
+	}
+
+	var segments []string = strings.Split(strings.Trim(httprequest.URL.Path, `/`), `/`)
+
+	if len(segments) < 2 || segments[0] != `v1` {
+
+		return http.StatusNotFound, ValrMockError(-1, `Not found`)
+	}
+
+	segments = segments[1:]
+
+	var route string = strings.Join([]string{httprequest.Method, strings.Join(segments, `/`)}, ` `)
+
+	switch {
+
+	case route == `GET account/balances`:
+
+		return mockexchange.ValrBalances()
+
+	case route == `GET account/fees/trade`:
+
+		return mockexchange.ValrTradeFees()
+
+	case httprequest.Method == http.MethodGet && len(segments) == 3 && segments[0] == `marketdata` && segments[2] == `orderbook`:
+
+		return mockexchange.ValrOrderBook(segments[1])
+
+	case route == `POST orders/limit`:
+
+		var valrlimitorder ValrLimitOrder
+
+		if err := json.Unmarshal(body, &valrlimitorder); err != nil {
+
+			return http.StatusBadRequest, ValrMockError(-1, `Invalid request body`)
+		}
+
+		return mockexchange.ValrLimitOrder(valrlimitorder)
+
+	case route == `POST orders/market`:
+
+		var valrmarketorder ValrMarketOrder
+
+		if err := json.Unmarshal(body, &valrmarketorder); err != nil {
+
+			return http.StatusBadRequest, ValrMockError(-1, `Invalid request body`)
+		}
+
+		return mockexchange.ValrMarketOrder(valrmarketorder)
+
+	case route == `DELETE orders/order`:
+
+		var valrcancelorder ValrCancelOrder
+
+		if err := json.Unmarshal(body, &valrcancelorder); err != nil {
+
+			return http.StatusBadRequest, ValrMockError(-1, `Invalid request body`)
+		}
+
+		return mockexchange.ValrCancelOrder(valrcancelorder)
+
+	case route == `GET orders/open`:
+
+		return mockexchange.ValrOpenOrders()
+
+	case httprequest.Method == http.MethodGet && len(segments) == 4 && segments[0] == `orders` && segments[2] == `orderid`:
+
+		return mockexchange.ValrOrderStatus(segments[3], ``)
+
+	case httprequest.Method == http.MethodGet && len(segments) == 4 && segments[0] == `orders` && segments[2] == `customerorderid`:
+
+		return mockexchange.ValrOrderStatus(``, segments[3])
+	}
+
+	return http.StatusNotFound, ValrMockError(-1, `Not found`)
+}
+
+func (mockexchange *MockExchange) ValrBalances() (status int, value interface{}) {
+
+	var valrbalances []ValrBalance = []ValrBalance{}
+
+	var updated string = mockexchange.Now().UTC().Format(time.RFC3339Nano)
+
+	for currency, balance := range mockexchange.Balances {
+
+		valrbalances = append(valrbalances, ValrBalance{
+			Currency:  strings.ToUpper(currency),
+			Available: balance.String(),
+			Reserved:  `0`,
+			Total:     balance.String(),
+			UpdatedAt: updated,
+		})
+	}
+
+	sort.Slice(valrbalances, func(first int, second int) bool {
+
+		return valrbalances[first].Currency < valrbalances[second].Currency
+	})
+
+	return http.StatusOK, valrbalances
+}
+
+func (mockexchange *MockExchange) ValrTradeFees() (status int, value interface{}) {
+
+	var valrtradefees []ValrTradeFee = []ValrTradeFee{}
+
+	for symbol := range ExchangePairs[mockexchange.Venue] {
+
+		valrtradefees = append(valrtradefees, ValrTradeFee{
+			CurrencyPair:    strings.ToUpper(symbol),
+			MakerPercentage: mockexchange.Maker * 100.0,
+			TakerPercentage: mockexchange.Taker * 100.0,
+		})
+	}
+
+	return http.StatusOK, valrtradefees
+}
+
+func (mockexchange *MockExchange) ValrOrderBook(symbol string) (status int, value interface{}) {
+
+	symbol = strings.ToLower(symbol)
+
+	var mockbook *MockBook = mockexchange.Books[symbol]
+
+	if mockbook == nil {
+
+		return http.StatusBadRequest, ValrMockError(-1, `Invalid currency pair`)
+	}
+
+	var valrorderbook ValrOrderBook = ValrOrderBook{
+		Bids:       []ValrOrder{},
+		Asks:       []ValrOrder{},
+		LastChange: mockexchange.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	var levelindex int = 0
+	var levellength int = len(mockbook.Bids)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		valrorderbook.Bids = append(valrorderbook.Bids, ValrOrder{
+			Side:         `buy`,
+			Quantity:     mockbook.Bids[levelindex].Amount.String(),
+			Price:        mockbook.Bids[levelindex].Price.String(),
+			CurrencyPair: strings.ToUpper(symbol),
+			OrderCount:   1,
+		})
+	}
+
+	levellength = len(mockbook.Asks)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		valrorderbook.Asks = append(valrorderbook.Asks, ValrOrder{
+			Side:         `sell`,
+			Quantity:     mockbook.Asks[levelindex].Amount.String(),
+			Price:        mockbook.Asks[levelindex].Price.String(),
+			CurrencyPair: strings.ToUpper(symbol),
+			OrderCount:   1,
+		})
+	}
+
+	return http.StatusOK, valrorderbook
+}
+
+func (mockexchange *MockExchange) ValrPlaceOrder(mockorder *MockOrder, quoteamount Decimal) (status int, value interface{}) {
+
+	if mockorder.ClientOrderId != `` {
+
+		if _, found := mockexchange.FindOrder(``, mockorder.ClientOrderId); found {
+
+			return http.StatusBadRequest, ValrMockError(-8, `Duplicate customer order id`)
+		}
+	}
+
+	if _, found := ExchangePairs[mockexchange.Venue][strings.ToLower(mockorder.Symbol)]; !found {
+
+		return http.StatusBadRequest, ValrMockError(-1, `Invalid currency pair`)
+	}
+
+	if err := mockexchange.PlaceOrder(mockorder, quoteamount, true); err != nil {
+
+		mockorder.Status = OrderFailed
+		mockorder.Reason = `Insufficient Balance`
+
+		mockexchange.Orders = append(mockexchange.Orders, mockorder)
+	}
+
+	return http.StatusAccepted, ValrOrderId{Id: mockorder.Id}
+}
+
+func (mockexchange *MockExchange) ValrLimitOrder(valrlimitorder ValrLimitOrder) (status int, value interface{}) {
+
+	var mockorder *MockOrder = &MockOrder{
+		Id:            mockexchange.NextOrderId(),
+		ClientOrderId: valrlimitorder.CustomerOrderId,
+		Symbol:        valrlimitorder.Pair,
+		Side:          strings.ToUpper(valrlimitorder.Side),
+		TimeInForce:   strings.ToUpper(valrlimitorder.TimeInForce),
+	}
+
+	var err error
+
+	if mockorder.BaseAmount, err = ParseDecimal(valrlimitorder.Quantity); err != nil || mockorder.BaseAmount.Sign() <= 0 {
+
+		return http.StatusBadRequest, ValrMockError(-1, `Invalid quantity`)
+	}
+
+	if mockorder.Price, err = ParseDecimal(valrlimitorder.Price); err != nil || mockorder.Price.Sign() <= 0 {
+
+		return http.StatusBadRequest, ValrMockError(-1, `Invalid price`)
+	}
+
+	if mockorder.TimeInForce == `` {
+
+		mockorder.TimeInForce = `GTC`
+	}
+
+	return mockexchange.ValrPlaceOrder(mockorder, DecimalZero)
+}
+
+func (mockexchange *MockExchange) ValrMarketOrder(valrmarketorder ValrMarketOrder) (status int, value interface{}) {
+
+	var mockorder *MockOrder = &MockOrder{
+		Id:            mockexchange.NextOrderId(),
+		ClientOrderId: valrmarketorder.CustomerOrderId,
+		Symbol:        valrmarketorder.Pair,
+		Side:          strings.ToUpper(valrmarketorder.Side),
+		Market:        true,
+		TimeInForce:   `IOC`,
+		BaseAmount:    DecimalZero,
+	}
+
+	var quoteamount Decimal = DecimalZero
+	var err error
+
+	switch {
+
+	case valrmarketorder.BaseAmount != ``:
+
+		mockorder.BaseAmount, err = ParseDecimal(valrmarketorder.BaseAmount)
+
+	case valrmarketorder.QuoteAmount != ``:
+
+		quoteamount, err = ParseDecimal(valrmarketorder.QuoteAmount)
+
+	default:
+
+		err = fmt.Errorf(`baseAmount or quoteAmount is required`)
+	}
+
+	if err != nil || mockorder.BaseAmount.Sign() < 0 || quoteamount.Sign() < 0 {
+
+		return http.StatusBadRequest, ValrMockError(-1, `Invalid amount`)
+	}
+
+	return mockexchange.ValrPlaceOrder(mockorder, quoteamount)
+}
+
+func (mockexchange *MockExchange) ValrCancelOrder(valrcancelorder ValrCancelOrder) (status int, value interface{}) {
+
+	var mockorder *MockOrder
+	var found bool
+
+	if mockorder, found = mockexchange.FindOrder(valrcancelorder.OrderId, valrcancelorder.CustomerOrderId); !found {
+
+		return http.StatusNotFound, ValrMockError(-1, `Order not found`)
+	}
+
+	if mockorder.Status == OrderOpen {
+
+		mockorder.Status = FillStatus(false, mockorder.BaseAmount, mockorder.BaseFilled)
+	}
+
+	return http.StatusOK, nil
+}
+
+func ValrMockStatus(mockorder *MockOrder) string {
+
+	switch mockorder.Status {
+
+	case OrderOpen:
+
+		if mockorder.BaseFilled.Sign() > 0 {
+
+			return `Partially Filled`
+		}
+
+		return `Placed`
+
+	case OrderFilled:
+
+		return `Filled`
+
+	case OrderFailed:
+
+		return `Failed`
+	}
+
+	return `Cancelled`
+}
+
+func (mockexchange *MockExchange) ValrOrderStatus(id string, clientorderid string) (status int, value interface{}) {
+
+	var mockorder *MockOrder
+	var found bool
+
+	if mockorder, found = mockexchange.FindOrder(id, clientorderid); !found {
+
+		return http.StatusNotFound, ValrMockError(-1, `Order not found`)
+	}
+
+	var ordertype string = `limit`
+
+	if mockorder.Market {
+
+		ordertype = `market`
+	}
+
+	var created string = mockorder.Created.Format(time.RFC3339Nano)
+
+	var pair Pair = ExchangePairs[mockexchange.Venue][mockorder.Symbol]
+
+	return http.StatusOK, ValrOrderStatus{
+		OrderId:           mockorder.Id,
+		OrderStatusType:   ValrMockStatus(mockorder),
+		CurrencyPair:      strings.ToUpper(mockorder.Symbol),
+		AveragePrice:      pair.AveragePrice(mockorder.Notional, mockorder.BaseFilled).String(),
+		OriginalPrice:     mockorder.Price.String(),
+		RemainingQuantity: mockorder.BaseAmount.Sub(mockorder.BaseFilled).String(),
+		OriginalQuantity:  mockorder.BaseAmount.String(),
+		Total:             mockorder.Notional.String(),
+		TotalFee:          mockorder.Fee.String(),
+		FeeCurrency:       strings.ToUpper(mockorder.FeeCurrency),
+		OrderSide:         strings.ToLower(mockorder.Side),
+		OrderType:         ordertype,
+		FailedReason:      mockorder.Reason,
+		CustomerOrderId:   mockorder.ClientOrderId,
+		OrderUpdatedAt:    created,
+		OrderCreatedAt:    created,
+		TimeInForce:       mockorder.TimeInForce,
+	}
+}
+
+func (mockexchange *MockExchange) ValrOpenOrders() (status int, value interface{}) {
+
+	var valropenorders []ValrOpenOrder = []ValrOpenOrder{}
+
+	var orderindex int = 0
+	var orderlength int = len(mockexchange.Orders)
+
+	for orderindex = 0; orderindex < orderlength; orderindex++ {
+
+		var mockorder *MockOrder = mockexchange.Orders[orderindex]
+
+		if mockorder.Status != OrderOpen {
+
+			continue
+		}
+
+		var created string = mockorder.Created.Format(time.RFC3339Nano)
+
+		valropenorders = append(valropenorders, ValrOpenOrder{
+			OrderId:           mockorder.Id,
+			Side:              strings.ToLower(mockorder.Side),
+			RemainingQuantity: mockorder.BaseAmount.Sub(mockorder.BaseFilled).String(),
+			Price:             mockorder.Price.String(),
+			CurrencyPair:      strings.ToUpper(mockorder.Symbol),
+			CreatedAt:         created,
+			OriginalQuantity:  mockorder.BaseAmount.String(),
+			FilledPercentage:  mockorder.BaseFilled.Mul(NewDecimal(100, 0)).Div(mockorder.BaseAmount, 2).String(),
+			CustomerOrderId:   mockorder.ClientOrderId,
+			UpdatedAt:         created,
+			Status:            ValrMockStatus(mockorder),
+			Type:              `limit`,
+			TimeInForce:       mockorder.TimeInForce,
+		})
+	}
+
+	return http.StatusOK, valropenorders
+}
+
+func NewMockVenues(t *testing.T) (bitstamp *MockExchange, valr *MockExchange, config Config) {
+
+	bitstamp = NewMockExchange(`bitstamp`, `BITSTAMP_KEY`, `BITSTAMP_SECRET`)
+
+	bitstamp.Maker = 0.003
+	bitstamp.Taker = 0.004
+
+	bitstamp.SetBalance(`usd`, MustParseDecimal(`10000`))
+	bitstamp.SetBalance(`btc`, MustParseDecimal(`1`))
+	bitstamp.SetBook(`btcusd`, []MockLevel{{Price: MustParseDecimal(`49900`), Amount: MustParseDecimal(`1`)}}, []MockLevel{{Price: MustParseDecimal(`50000`), Amount: MustParseDecimal(`0.5`)}})
+
+	valr = NewMockExchange(`valr`, `VALR_KEY`, `VALR_SECRET`)
+
+	valr.Taker = 0.001
+
+	valr.SetBalance(`zar`, MustParseDecimal(`200000`))
+	valr.SetBalance(`btc`, MustParseDecimal(`1`))
+	valr.SetBook(`btczar`, []MockLevel{{Price: MustParseDecimal(`1000000`), Amount: MustParseDecimal(`1`)}}, []MockLevel{{Price: MustParseDecimal(`1010000`), Amount: MustParseDecimal(`1`)}})
+
+	var bitstampserver *httptest.Server = NewMockServer(bitstamp)
+	var valrserver *httptest.Server = NewMockServer(valr)
+
+	t.Cleanup(bitstampserver.Close)
+	t.Cleanup(valrserver.Close)
+
+	var err error
+
+	if config, err = LoadConfig(`config.json`, []byte(fmt.Sprintf(MockConfig, bitstampserver.URL, valrserver.URL))); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if err = ConfigureApiClients(config); err != nil {
+
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func RunMockCycle(t *testing.T, ctx context.Context, config Config) (summary CycleSummary, ledger *Ledger, err error) {
+
+	var ecbrates EcbRates = EcbRates{Date: time.Now(), Rates: map[string]float64{`EUR`: 1, `USD`: 1, `ZAR`: 18}}
+
+	var feecache FeeCache = FeeCache{MaxAge: time.Hour}
+	var streamregistry StreamRegistry = StreamRegistry{}
+	var paperengine PaperEngine = PaperEngine{}
+	var recorder Recorder = Recorder{}
+
+	ledger = &Ledger{Dir: t.TempDir()}
+
+	summary, err = RunCycle(ctx, make(chan struct{}), config, ecbrates, &feecache, &streamregistry, &paperengine, &recorder, ledger)
+
+	return
+}
+
+func CheckMockBalances(t *testing.T, venues map[string]*MockExchange, balances map[string]string) {
+
+	for name, want := range balances {
+
+		var fields []string = strings.Fields(name)
+
+		var balance Decimal = venues[fields[0]].Balance(fields[1])
+
+		if !balance.Equal(MustParseDecimal(want)) {
+
+			t.Errorf(`%[1]v balance %[2]v, want %[3]v`, name, balance, want)
+		}
+	}
+}
+
+var MockTradedBalances map[string]string = map[string]string{
+	`bitstamp usd`: `8996`,
+	`bitstamp btc`: `1.02`,
+	`valr zar`:     `217982`,
+	`valr btc`:     `0.982`,
+}
+
+func TestRunCycleMock(t *testing.T) {
+
+	var bitstamp *MockExchange
+	var valr *MockExchange
+	var config Config
+
+	bitstamp, valr, config = NewMockVenues(t)
+
+	var summary CycleSummary
+	var ledger *Ledger
+	var err error
+
+	if summary, ledger, err = RunMockCycle(t, context.Background(), config); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if summary.Accounts != 3 || summary.Evaluated != 1 || summary.Opportunities != 1 || summary.Executed != 1 || summary.Unhedged != 0 || summary.Errors != 2 {
+
+		t.Errorf(`summary %+[1]v, want 3 accounts, 1 executed and 2 errors`, summary)
+	}
+
+	CheckMockBalances(t, map[string]*MockExchange{`bitstamp`: bitstamp, `valr`: valr}, MockTradedBalances)
+
+	var buyorder MockOrder
+	var found bool
+
+	if buyorder, found = bitstamp.Order(`1000000001`); !found || buyorder.Side != Buy || buyorder.TimeInForce != `IOC` || !buyorder.BaseFilled.Equal(MustParseDecimal(`0.02`)) {
+
+		t.Errorf(`bitstamp buy order %+[1]v`, buyorder)
+	}
+
+	if len(bitstamp.Orders) != 1 || len(valr.Orders) != 1 {
+
+		t.Errorf(`%[1]v bitstamp and %[2]v valr orders, want the buy and the sell only`, len(bitstamp.Orders), len(valr.Orders))
+	}
+
+	var ledgerentries []LedgerEntry
+
+	if ledgerentries, err = ledger.Query(``, time.Now().UTC().AddDate(0, 0, -1), time.Now().UTC().AddDate(0, 0, 1)); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if len(ledgerentries) != 1 || ledgerentries[0].Account != `trader` || !ledgerentries[0].Executed || ledgerentries[0].HedgeState != HedgeBalanced {
+
+		t.Fatalf(`ledger %+[1]v, want one executed and balanced trader entry`, ledgerentries)
+	}
+
+	var buyledgerorder LedgerOrder = ledgerentries[0].Orders[0]
+
+	if !buyledgerorder.AveragePrice.Equal(MustParseDecimal(`50000`)) || !buyledgerorder.Notional.Equal(MustParseDecimal(`1000`)) || !buyledgerorder.Fee.Equal(MustParseDecimal(`4`)) || buyledgerorder.FeeCurrency != `usd` || buyledgerorder.EstimatedNotional != nil {
+
+		t.Errorf(`buy ledger order %+[1]v, want 1000 usd at 50000 with a 4 usd fee`, buyledgerorder)
+	}
+
+	if !ledgerentries[0].Realised.Equal(MustParseDecimal(`-90`)) || ledgerentries[0].EstimatedRealised != nil || !ledgerentries[0].Pnl[`btc`].Equal(MustParseDecimal(`0.002`)) {
+
+		t.Errorf(`realised %[1]v pnl %[2]v, want -90 zar and a 0.002 btc gain`, ledgerentries[0].Realised, ledgerentries[0].Pnl)
+	}
+}
+
+func TestRunCycleMockPartialSell(t *testing.T) {
+
+	var bitstamp *MockExchange
+	var valr *MockExchange
+	var config Config
+
+	bitstamp, valr, config = NewMockVenues(t)
+
+	var thinned bool = false
+
+	valr.Hook = func(httprequest *http.Request) {
+
+		if httprequest.Method == http.MethodPost && strings.HasPrefix(httprequest.URL.Path, `/v1/orders/`) && !thinned {
+
+			thinned = true
+
+			valr.SetBook(`btczar`, []MockLevel{{Price: MustParseDecimal(`1000000`), Amount: MustParseDecimal(`0.01`)}, {Price: MustParseDecimal(`800000`), Amount: MustParseDecimal(`1`)}}, []MockLevel{{Price: MustParseDecimal(`1010000`), Amount: MustParseDecimal(`1`)}})
+		}
+	}
+
+	var summary CycleSummary
+	var ledger *Ledger
+	var err error
+
+	if summary, ledger, err = RunMockCycle(t, context.Background(), config); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if summary.Executed != 1 || summary.Unhedged != 0 {
+
+		t.Errorf(`summary %+[1]v, want 1 executed and hedged`, summary)
+	}
+
+	CheckMockBalances(t, map[string]*MockExchange{`bitstamp`: bitstamp, `valr`: valr}, map[string]string{
+		`bitstamp usd`: `8996`,
+		`bitstamp btc`: `1.02`,
+		`valr zar`:     `216383.6`,
+		`valr btc`:     `0.982`,
+	})
+
+	if len(valr.Orders) != 2 || valr.Orders[1].Side != Sell || !valr.Orders[1].BaseFilled.Equal(MustParseDecimal(`0.008`)) {
+
+		t.Errorf(`valr orders %+[1]v, want the partial sell and a 0.008 hedge sell`, valr.Orders)
+	}
+
+	var ledgerentries []LedgerEntry
+
+	if ledgerentries, err = ledger.Query(``, time.Now().UTC().AddDate(0, 0, -1), time.Now().UTC().AddDate(0, 0, 1)); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if len(ledgerentries) != 1 || ledgerentries[0].HedgeState != HedgeHedged || !ledgerentries[0].Residual.IsZero() || !ledgerentries[0].Pnl[`btc`].Equal(MustParseDecimal(`0.002`)) {
+
+		t.Errorf(`ledger %+[1]v, want a hedged entry that keeps the 0.002 btc edge`, ledgerentries)
+	}
+}
+
+func TestRunCycleCancelledAfterBuy(t *testing.T) {
+
+	var bitstamp *MockExchange
+	var valr *MockExchange
+	var config Config
+
+	bitstamp, valr, config = NewMockVenues(t)
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	ctx, cancel = context.WithCancel(context.Background())
+
+	defer cancel()
+
+	bitstamp.Hook = func(httprequest *http.Request) {
+
+		if strings.HasPrefix(httprequest.URL.Path, `/api/v2/buy/`) {
+
+			cancel()
+		}
+	}
+
+	var summary CycleSummary
+	var err error
+
+	summary, _, err = RunMockCycle(t, ctx, config)
+
+	if !errors.Is(err, ErrStopping) {
+
+		t.Errorf(`got %[1]v, want the cycle to stop after the route`, err)
+	}
+
+	if summary.Accounts != 1 || summary.Executed != 1 || summary.Unhedged != 0 || summary.Errors != 0 {
+
+		t.Errorf(`summary %+[1]v, want the live trade to settle and hedge`, summary)
+	}
+
+	CheckMockBalances(t, map[string]*MockExchange{`bitstamp`: bitstamp, `valr`: valr}, MockTradedBalances)
+}
+
+func TestMockSignatureRejected(t *testing.T) {
+
+	var config Config
+
+	_, _, config = NewMockVenues(t)
+
+	var credentials map[string]CredentialConfig = map[string]CredentialConfig{
+		`bitstamp`: {Key: `BITSTAMP_KEY`, Secret: `WRONG_SECRET`},
+		`valr`:     {Key: `VALR_KEY`, Secret: `WRONG_SECRET`},
+	}
+
+	var symbols map[string]string = map[string]string{`bitstamp`: `btcusd`, `valr`: `btczar`}
+
+	for venue, credential := range credentials {
+
+		var exchange Exchange
+		var err error
+
+		if exchange, err = NewExchange(config.Venues[venue], credential, symbols[venue], &StreamRegistry{}); err != nil {
+
+			t.Fatal(err)
+		}
+
+		_, err = exchange.GetBalance(context.Background(), `btc`)
+
+		if !errors.Is(err, ErrAuth) || ErrorAction(err) != ActionSkipAccount || !strings.Contains(err.Error(), `invalid signature`) && !strings.Contains(err.Error(), `Invalid signature`) {
+
+			t.Errorf(`%[1]v: got %[2]v, want an invalid signature auth error`, venue, err)
+		}
+	}
+}
+
+func MockFrame(opcode int, final bool, masked bool, payload []byte) (frame []byte) {
+
+	frame = []byte{byte(opcode)}
+
+	if final {
+
+		frame[0] |= 0x80
+	}
+
+	var maskbit byte = 0
+
+	if masked {
+
+		maskbit = 0x80
+	}
+
+	var length int = len(payload)
+
+	switch {
+
+	case length < 126:
+
+		frame = append(frame, maskbit|byte(length))
+
+	case length <= 0xffff:
+
+		frame = append(frame, maskbit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+
+	default:
+
+		frame = append(frame, maskbit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	if !masked {
+
+		return append(frame, payload...)
+	}
+
+	var mask []byte = []byte{0x12, 0x34, 0x56, 0x78}
+
+	frame = append(frame, mask...)
+
+	for index := range payload {
+
+		frame = append(frame, payload[index]^mask[index%4])
+	}
+
+	return
+}
+
+func MockWebsocketAccept(key string) string {
+
+	var digest hash.Hash = sha1.New()
+
+	digest.Write([]byte(key))
+	digest.Write([]byte(WebsocketGuid))
+
+	return base64.StdEncoding.EncodeToString(digest.Sum(nil))
+}
+
+func NewMockWebsocketServer(t *testing.T, accept func(string) string, handle func(*WebsocketConn)) (server *httptest.Server) {
+
+	server = httptest.NewServer(http.HandlerFunc(func(responsewriter http.ResponseWriter, httprequest *http.Request) {
+
+		if httprequest.Header.Get(`Upgrade`) != `websocket` || httprequest.Header.Get(`Sec-WebSocket-Version`) != `13` {
+
+			http.Error(responsewriter, `not a websocket request`, http.StatusBadRequest)
+
+			return
+		}
+
+		var conn net.Conn
+		var readwriter *bufio.ReadWriter
+		var err error
+
+		if conn, readwriter, err = http.NewResponseController(responsewriter).Hijack(); err != nil {
+
+			t.Error(err)
+
+			return
+		}
+
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %[1]v\r\n\r\n", accept(httprequest.Header.Get(`Sec-WebSocket-Key`)))
+
+		handle(&WebsocketConn{Conn: conn, Reader: readwriter.Reader})
+	}))
+
+	t.Cleanup(server.Close)
+
+	return
+}
+
+func WebsocketUrl(server *httptest.Server) string {
+
+	return strings.Replace(server.URL, `http://`, `ws://`, 1)
+}
+
+func ReadMockClientFrame(websocketconn *WebsocketConn) (opcode int, payload []byte, masked bool, err error) {
+
+	var header []byte
+
+	if header, err = websocketconn.Reader.Peek(2); err != nil {
+
+		return
+	}
+
+	masked = header[1]&0x80 != 0
+
+	opcode, _, payload, err = websocketconn.ReadFrame()
+
+	return
+}
+
+func TestWebsocketFrames(t *testing.T) {
+
+	var large []byte = bytes.Repeat([]byte(`x`), 300)
+
+	var received chan []string = make(chan []string, 1)
+
+	var server *httptest.Server = NewMockWebsocketServer(t, MockWebsocketAccept, func(websocketconn *WebsocketConn) {
+
+		var frames []string = []string{}
+
+		var opcode int
+		var payload []byte
+		var masked bool
+		var err error
+
+		if opcode, payload, masked, err = ReadMockClientFrame(websocketconn); err != nil || opcode != WebsocketText || !masked {
+
+			t.Errorf(`client frame opcode %[1]v masked %[2]v: %[3]v, want a masked text frame`, opcode, masked, err)
+		}
+
+		frames = append(frames, string(payload))
+
+		websocketconn.Conn.Write(MockFrame(WebsocketText, false, false, []byte(`hel`)))
+		websocketconn.Conn.Write(MockFrame(WebsocketPing, true, false, []byte(`beat`)))
+		websocketconn.Conn.Write(MockFrame(WebsocketContinuation, false, false, []byte(`lo `)))
+		websocketconn.Conn.Write(MockFrame(WebsocketContinuation, true, false, []byte(`world`)))
+		websocketconn.Conn.Write(MockFrame(WebsocketBinary, true, false, large))
+		websocketconn.Conn.Write(MockFrame(WebsocketText, true, true, []byte(`masked`)))
+
+		if opcode, payload, masked, err = ReadMockClientFrame(websocketconn); err != nil || opcode != WebsocketPong || !masked {
+
+			t.Errorf(`client frame opcode %[1]v masked %[2]v: %[3]v, want a masked pong`, opcode, masked, err)
+		}
+
+		frames = append(frames, string(payload))
+
+		websocketconn.Conn.Write(MockFrame(WebsocketClose, true, false, []byte{0x03, 0xe8}))
+
+		received <- frames
+	})
+
+	var websocketconn *WebsocketConn
+	var err error
+
+	if websocketconn, err = DialWebsocket(WebsocketUrl(server), nil, 5*time.Second); err != nil {
+
+		t.Fatal(err)
+	}
+
+	defer websocketconn.Close()
+
+	if err = websocketconn.WriteMessage(WebsocketText, []byte(`subscribe`)); err != nil {
+
+		t.Fatal(err)
+	}
+
+	var wants []string = []string{`hello world`, string(large), `masked`}
+	var opcodes []int = []int{WebsocketText, WebsocketBinary, WebsocketText}
+
+	var wantindex int = 0
+	var wantlength int = len(wants)
+
+	for wantindex = 0; wantindex < wantlength; wantindex++ {
+
+		var opcode int
+		var payload []byte
+
+		if opcode, payload, err = websocketconn.ReadMessage(); err != nil || opcode != opcodes[wantindex] || string(payload) != wants[wantindex] {
+
+			t.Errorf(`message %[1]v: opcode %[2]v %[3]q %[4]v, want %[5]v %[6]q`, wantindex, opcode, payload, err, opcodes[wantindex], wants[wantindex])
+		}
+	}
+
+	if _, _, err = websocketconn.ReadMessage(); !errors.Is(err, io.EOF) {
+
+		t.Errorf(`after close frame: %[1]v, want EOF`, err)
+	}
+
+	var frames []string = <-received
+
+	if frames[0] != `subscribe` || frames[1] != `beat` {
+
+		t.Errorf(`server received %[1]q, want the subscription and a pong echoing the ping`, frames)
+	}
+}
+
+func TestWebsocketHandshakeRejected(t *testing.T) {
+
+	var server *httptest.Server = NewMockWebsocketServer(t, func(key string) string { return MockWebsocketAccept(`other`) }, func(websocketconn *WebsocketConn) {})
+
+	if _, err := DialWebsocket(WebsocketUrl(server), nil, 5*time.Second); err == nil || !strings.Contains(err.Error(), `handshake failed`) {
+
+		t.Errorf(`wrong accept key: %[1]v, want a handshake error`, err)
+	}
+
+	var plain *httptest.Server = httptest.NewServer(http.NotFoundHandler())
+
+	defer plain.Close()
+
+	if _, err := DialWebsocket(WebsocketUrl(plain), nil, 5*time.Second); err == nil {
+
+		t.Errorf(`plain HTTP server: handshake succeeded`)
+	}
+}
+
+func BitstampStreamFrame(event string, microtimestamp int64, bids [][]string, asks [][]string) []byte {
+
+	var payload []byte
+
+	payload, _ = json.Marshal(map[string]interface{}{
+		`event`:   event,
+		`channel`: `diff_order_book_btcusd`,
+		`data`:    BitstampStreamBook{Microtimestamp: strconv.FormatInt(microtimestamp, 10), Bids: bids, Asks: asks},
+	})
+
+	return MockFrame(WebsocketText, true, false, payload)
+}
+
+func CheckOrderBook(t *testing.T, name string, orderbook *OrderBook, depthtype int, want [][]string) {
+
+	var levels []Level = orderbook.Levels(depthtype)
+
+	var got [][]string = [][]string{}
+
+	var levelindex int = 0
+	var levellength int = len(levels)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		got = append(got, []string{levels[levelindex].QuoteAmount.String(), levels[levelindex].BaseAmount.String()})
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+
+		t.Errorf(`%[1]v: book %[2]v, want %[3]v`, name, got, want)
+	}
+}
+
+func TestBitstampStreamSequencing(t *testing.T) {
+
+	var bitstamp *MockExchange = NewMockExchange(`bitstamp`, `BITSTAMP_KEY`, `BITSTAMP_SECRET`)
+
+	bitstamp.Clock = func() time.Time { return time.UnixMicro(1000) }
+
+	bitstamp.SetBook(`btcusd`, []MockLevel{{Price: MustParseDecimal(`49900`), Amount: MustParseDecimal(`1`)}}, []MockLevel{{Price: MustParseDecimal(`50000`), Amount: MustParseDecimal(`0.5`)}})
+
+	var restserver *httptest.Server = NewMockServer(bitstamp)
+
+	defer restserver.Close()
+
+	var subscribed chan string = make(chan string, 1)
+
+	var server *httptest.Server = NewMockWebsocketServer(t, MockWebsocketAccept, func(websocketconn *WebsocketConn) {
+
+		var payload []byte
+
+		_, payload, _, _ = ReadMockClientFrame(websocketconn)
+
+		subscribed <- string(payload)
+
+		websocketconn.Conn.Write(BitstampStreamFrame(`data`, 900, [][]string{{`49900`, `0`}}, nil))
+		websocketconn.Conn.Write(MockFrame(WebsocketText, true, false, []byte(`{"event":"bts:subscription_succeeded","channel":"diff_order_book_btcusd","data":{}}`)))
+		websocketconn.Conn.Write(BitstampStreamFrame(`data`, 1000, [][]string{{`49900`, `0`}}, nil))
+		websocketconn.Conn.Write(BitstampStreamFrame(`data`, 1100, [][]string{{`49950`, `0.25`}}, nil))
+		websocketconn.Conn.Write(BitstampStreamFrame(`data`, 1050, [][]string{{`49950`, `0`}}, [][]string{{`50000`, `0`}}))
+		websocketconn.Conn.Write(BitstampStreamFrame(`data`, 1200, nil, [][]string{{`50000`, `0.4`}, {`50100`, `2`}}))
+		websocketconn.Conn.Write(MockFrame(WebsocketClose, true, false, nil))
+	})
+
+	var bitstampstream *BitstampStream = &BitstampStream{
+		Url:          WebsocketUrl(server),
+		Host:         restserver.URL,
+		CurrencyPair: BitstampBtcUsd,
+		Channel:      `diff_order_book`,
+		StaleAfter:   30 * time.Second,
+		OrderBook:    NewOrderBook(),
+	}
+
+	if err := bitstampstream.Stream(); !errors.Is(err, io.EOF) {
+
+		t.Errorf(`stream ended with %[1]v, want EOF`, err)
+	}
+
+	if subscription := <-subscribed; !strings.Contains(subscription, `"channel":"diff_order_book_btcusd"`) || !strings.Contains(subscription, `"event":"bts:subscribe"`) {
+
+		t.Errorf(`subscription %[1]v`, subscription)
+	}
+
+	CheckOrderBook(t, `bitstamp bids`, bitstampstream.OrderBook, Bid, [][]string{{`49950`, `0.25`}, {`49900`, `1`}})
+	CheckOrderBook(t, `bitstamp asks`, bitstampstream.OrderBook, Ask, [][]string{{`50000`, `0.4`}, {`50100`, `2`}})
+
+	if !bitstampstream.OrderBook.Synced {
+
+		t.Errorf(`bitstamp book not synced after the snapshot`)
+	}
+}
+
+func ValrStreamFrame(kind string, sequence int64, bids [][]string, asks [][]string, checksum uint32) []byte {
+
+	var levels func([][]string) []map[string]interface{} = func(entries [][]string) (levels []map[string]interface{}) {
+
+		levels = []map[string]interface{}{}
+
+		for _, entry := range entries {
+
+			levels = append(levels, map[string]interface{}{`Price`: entry[0], `Orders`: []map[string]string{{`orderId`: `o`, `quantity`: entry[1]}}})
+		}
+
+		return
+	}
+
+	var payload []byte
+
+	payload, _ = json.Marshal(map[string]interface{}{
+		`type`:               kind,
+		`currencyPairSymbol`: `BTCZAR`,
+		`data`: map[string]interface{}{
+			`Bids`:           levels(bids),
+			`Asks`:           levels(asks),
+			`SequenceNumber`: sequence,
+			`Checksum`:       checksum,
+		},
+	})
+
+	return payload
+}
+
+func ValrBookChecksum(bids [][]string, asks [][]string) uint32 {
+
+	var orderbook *OrderBook = NewOrderBook()
+
+	for _, entry := range bids {
+
+		orderbook.Set(Bid, MustParseDecimal(entry[0]), MustParseDecimal(entry[1]))
+	}
+
+	for _, entry := range asks {
+
+		orderbook.Set(Ask, MustParseDecimal(entry[0]), MustParseDecimal(entry[1]))
+	}
+
+	return ValrChecksum(orderbook)
+}
+
+func ApplyValrFrame(valrstream *ValrStream, frame []byte) (err error) {
+
+	var message ValrStreamMessage
+
+	if err = json.Unmarshal(frame, &message); err != nil {
+
+		return
+	}
+
+	var valrstreambook ValrStreamBook
+
+	if err = json.Unmarshal(message.Data, &valrstreambook); err != nil {
+
+		return
+	}
+
+	return valrstream.Apply(valrstreambook, message.Type == `FULL_ORDERBOOK_SNAPSHOT`)
+}
+
+func TestValrChecksumFormat(t *testing.T) {
+
+	var want uint32 = crc32.ChecksumIEEE([]byte(`1000000:0.5:1010000:0.3:999000:1:1020000:2`))
+
+	if checksum := ValrBookChecksum([][]string{{`999000`, `1`}, {`1000000`, `0.5`}}, [][]string{{`1020000`, `2`}, {`1010000`, `0.3`}}); checksum != want {
+
+		t.Errorf(`checksum %[1]v, want %[2]v for interleaved best-first bid and ask levels`, checksum, want)
+	}
+}
+
+func TestValrStreamSequencing(t *testing.T) {
+
+	var valrstream *ValrStream = &ValrStream{CurrencyPair: ValrBtcZar, OrderBook: NewOrderBook()}
+
+	var snapshotbids [][]string = [][]string{{`1000000`, `0.5`}}
+	var snapshotasks [][]string = [][]string{{`1010000`, `0.3`}}
+
+	if err := ApplyValrFrame(valrstream, ValrStreamFrame(`FULL_ORDERBOOK_UPDATE`, 9, snapshotbids, snapshotasks, ValrBookChecksum(snapshotbids, snapshotasks))); err != nil || valrstream.OrderBook.Synced {
+
+		t.Errorf(`update before snapshot: %[1]v synced %[2]v, want it ignored`, err, valrstream.OrderBook.Synced)
+	}
+
+	if err := ApplyValrFrame(valrstream, ValrStreamFrame(`FULL_ORDERBOOK_SNAPSHOT`, 10, snapshotbids, snapshotasks, ValrBookChecksum(snapshotbids, snapshotasks))); err != nil || !valrstream.OrderBook.Synced {
+
+		t.Fatalf(`snapshot: %[1]v synced %[2]v`, err, valrstream.OrderBook.Synced)
+	}
+
+	var updatedbids [][]string = [][]string{{`1000000`, `0.5`}, {`999000`, `1`}}
+
+	if err := ApplyValrFrame(valrstream, ValrStreamFrame(`FULL_ORDERBOOK_UPDATE`, 11, [][]string{{`999000`, `1`}}, nil, ValrBookChecksum(updatedbids, snapshotasks))); err != nil {
+
+		t.Fatalf(`update 11: %[1]v`, err)
+	}
+
+	CheckOrderBook(t, `after update 11`, valrstream.OrderBook, Bid, [][]string{{`1000000`, `0.5`}, {`999000`, `1`}})
+
+	if err := ApplyValrFrame(valrstream, ValrStreamFrame(`FULL_ORDERBOOK_UPDATE`, 11, [][]string{{`999000`, `0`}}, nil, ValrBookChecksum(snapshotbids, snapshotasks))); !errors.Is(err, ErrValrSequenceGap) || valrstream.OrderBook.Synced {
+
+		t.Errorf(`replayed update 11: %[1]v, want a sequence gap`, err)
+	}
+
+	CheckOrderBook(t, `after replayed update`, valrstream.OrderBook, Bid, [][]string{{`1000000`, `0.5`}, {`999000`, `1`}})
+
+	if err := ApplyValrFrame(valrstream, ValrStreamFrame(`FULL_ORDERBOOK_UPDATE`, 13, nil, nil, ValrBookChecksum(updatedbids, snapshotasks))); err != nil || valrstream.OrderBook.Synced {
+
+		t.Errorf(`update while out of sync: %[1]v synced %[2]v, want it ignored`, err, valrstream.OrderBook.Synced)
+	}
+
+	var resyncbids [][]string = [][]string{{`998000`, `2`}}
+
+	if err := ApplyValrFrame(valrstream, ValrStreamFrame(`FULL_ORDERBOOK_SNAPSHOT`, 20, resyncbids, snapshotasks, ValrBookChecksum(resyncbids, snapshotasks))); err != nil || !valrstream.OrderBook.Synced {
+
+		t.Fatalf(`resync snapshot: %[1]v synced %[2]v`, err, valrstream.OrderBook.Synced)
+	}
+
+	CheckOrderBook(t, `after resync`, valrstream.OrderBook, Bid, [][]string{{`998000`, `2`}})
+
+	if err := ApplyValrFrame(valrstream, ValrStreamFrame(`FULL_ORDERBOOK_UPDATE`, 21, [][]string{{`997000`, `1`}}, nil, ValrBookChecksum(resyncbids, snapshotasks))); !errors.Is(err, ErrValrChecksum) || valrstream.OrderBook.Synced {
+
+		t.Errorf(`update with a stale checksum: %[1]v synced %[2]v, want a checksum mismatch`, err, valrstream.OrderBook.Synced)
+	}
+
+	if _, err := valrstream.GetDepth(Bid); !errors.Is(err, ErrStaleOrderBook) {
+
+		t.Errorf(`depth after checksum mismatch: %[1]v, want a stale book`, err)
+	}
+}
+
+func TestValrStreamGap(t *testing.T) {
+
+	var bids [][]string = [][]string{{`1000000`, `0.5`}}
+	var asks [][]string = [][]string{{`1010000`, `0.3`}}
+
+	var server *httptest.Server = NewMockWebsocketServer(t, MockWebsocketAccept, func(websocketconn *WebsocketConn) {
+
+		ReadMockClientFrame(websocketconn)
+
+		websocketconn.Conn.Write(MockFrame(WebsocketText, true, false, []byte(`{"type":"SUBSCRIBED"}`)))
+		websocketconn.Conn.Write(MockFrame(WebsocketText, true, false, ValrStreamFrame(`FULL_ORDERBOOK_SNAPSHOT`, 10, bids, asks, ValrBookChecksum(bids, asks))))
+		websocketconn.Conn.Write(MockFrame(WebsocketText, true, false, ValrStreamFrame(`FULL_ORDERBOOK_UPDATE`, 12, nil, nil, ValrBookChecksum(bids, asks))))
+
+		ReadMockClientFrame(websocketconn)
+	})
+
+	var valrstream *ValrStream = &ValrStream{
+		Url:          strings.Join([]string{WebsocketUrl(server), `/ws/trade`}, ``),
+		Key:          `VALR_KEY`,
+		Secret:       `VALR_SECRET`,
+		CurrencyPair: ValrBtcZar,
+		StaleAfter:   30 * time.Second,
+		OrderBook:    NewOrderBook(),
+	}
+
+	if err := valrstream.Stream(); !errors.Is(err, ErrValrSequenceGap) {
+
+		t.Errorf(`stream ended with %[1]v, want a sequence gap`, err)
+	}
+
+	if valrstream.OrderBook.Synced || valrstream.SequenceNumber != 10 {
+
+		t.Errorf(`synced %[1]v at sequence %[2]v, want out of sync after 10`, valrstream.OrderBook.Synced, valrstream.SequenceNumber)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type DepthStream interface {
+	Start()
+	GetDepth(depthtype int) (depth Depth, err error)
+}
+
+type OrderBook struct {
+	Mutex   sync.RWMutex
+	Bids    map[string]Level
+	Asks    map[string]Level
+	Synced  bool
+	Updated time.Time
+}
+
+type StreamRegistry struct {
+	Mutex    sync.Mutex
+	Streams  map[string]DepthStream
+	Recorder *Recorder
+}
+
+var ErrStaleOrderBook error = errors.New(`order book stream is stale`)
+
+func NewOrderBook() *OrderBook {
+
+	return &OrderBook{Bids: map[string]Level{}, Asks: map[string]Level{}}
+}
+
+func (orderbook *OrderBook) Reset() {
+
+	orderbook.Mutex.Lock()
+
+	defer orderbook.Mutex.Unlock()
+
+	orderbook.Bids = map[string]Level{}
+	orderbook.Asks = map[string]Level{}
+	orderbook.Synced = false
+}
+
+func (orderbook *OrderBook) Set(depthtype int, price Decimal, amount Decimal) {
+
+	var side map[string]Level = orderbook.Bids
+
+	if depthtype == Ask {
+
+		side = orderbook.Asks
+	}
+
+	var key string = price.Normalize().String()
+
+	if amount.Sign() <= 0 {
+
+		delete(side, key)
+
+		return
+	}
+
+	side[key] = Level{BaseAmount: amount, QuoteAmount: price}
+}
+
+func (orderbook *OrderBook) Depth(depthtype int, pair Pair, staleafter time.Duration) (depth Depth, err error) {
+
+	orderbook.Mutex.RLock()
+
+	defer orderbook.Mutex.RUnlock()
+
+	if !orderbook.Synced || time.Since(orderbook.Updated) > staleafter {
+
+		err = ErrStaleOrderBook
+
+		return
+	}
+
+	depth = Depth{
+		Type:          depthtype,
+		BaseCurrency:  pair.BaseCurrency,
+		QuoteCurrency: pair.QuoteCurrency,
+	}
+
+	depth.Levels = orderbook.Levels(depthtype)
+
+	return
+}
+
+func (orderbook *OrderBook) Levels(depthtype int) (levels []Level) {
+
+	var side map[string]Level = orderbook.Bids
+
+	if depthtype == Ask {
+
+		side = orderbook.Asks
+	}
+
+	levels = make([]Level, 0, len(side))
+
+	var level Level
+
+	for _, level = range side {
+
+		levels = append(levels, level)
+	}
+
+	sort.Slice(levels, func(i int, j int) bool {
+
+		if depthtype == Ask {
+
+			return levels[i].QuoteAmount.LessThan(levels[j].QuoteAmount)
+		}
+
+		return levels[i].QuoteAmount.GreaterThan(levels[j].QuoteAmount)
+	})
+
+	return
+}
+
+func RunStream(name string, orderbook *OrderBook, stream func() error) {
+
+	var backoff time.Duration = time.Second
+
+	for {
+
+		var started time.Time = time.Now()
+
+		var err error = stream()
+
+		orderbook.Reset()
+
+		if time.Since(started) > time.Minute {
+
+			backoff = time.Second
+		}
+
+		log.Printf(`Error('%[1]v stream: %[2]v, reconnecting in %[3]v')`, name, err, backoff)
+
+		time.Sleep(backoff)
+
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+func (streamregistry *StreamRegistry) GetStream(venue VenueConfig, credential CredentialConfig, pair Pair) (depthstream DepthStream) {
+
+	if !venue.Stream {
+
+		return
+	}
+
+	streamregistry.Mutex.Lock()
+
+	defer streamregistry.Mutex.Unlock()
+
+	if streamregistry.Streams == nil {
+
+		streamregistry.Streams = map[string]DepthStream{}
+	}
+
+	var streamkey string = strings.Join([]string{venue.Exchange, venue.StreamUrl, pair.Symbol}, `/`)
+
+	var found bool
+
+	if depthstream, found = streamregistry.Streams[streamkey]; found {
+
+		return
+	}
+
+	switch venue.Exchange {
+
+	case `bitstamp`:
+
+		depthstream = &BitstampStream{
+			Url:          venue.StreamUrl,
+			Host:         venue.Host,
+			CurrencyPair: pair,
+			StaleAfter:   venue.StaleAfter.Duration,
+			OrderBook:    NewOrderBook(),
+			Recorder:     streamregistry.Recorder,
+		}
+
+	case `valr`:
+
+		depthstream = &ValrStream{
+			Url:          venue.StreamUrl,
+			Key:          credential.Key,
+			Secret:       credential.Secret,
+			CurrencyPair: pair,
+			StaleAfter:   venue.StaleAfter.Duration,
+			OrderBook:    NewOrderBook(),
+			Recorder:     streamregistry.Recorder,
+		}
+	}
+
+	if depthstream == nil {
+
+		return
+	}
+
+	depthstream.Start()
+
+	streamregistry.Streams[streamkey] = depthstream
+
+	return
+}
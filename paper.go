@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PaperEngine struct {
+	Path   string
+	Mutex  sync.Mutex
+	Deltas map[string]Decimal
+	Orders map[string]OrderStatus
+	Fills  int
+	Clock  func() time.Time
+}
+
+type PaperExchange struct {
+	Exchange
+	Account     string
+	Venue       string
+	Balances    map[string]Decimal
+	Fee         float64
+	PaperEngine *PaperEngine
+}
+
+type PaperFill struct {
+	Time          time.Time `json:"time"`
+	Account       string    `json:"account"`
+	Venue         string    `json:"venue"`
+	Symbol        string    `json:"symbol"`
+	Side          string    `json:"side"`
+	OrderId       string    `json:"orderid"`
+	ClientOrderId string    `json:"clientorderid"`
+	BaseCurrency  string    `json:"basecurrency"`
+	QuoteCurrency string    `json:"quotecurrency"`
+	BaseAmount    Decimal   `json:"baseamount"`
+	Price         Decimal   `json:"price"`
+	BaseFilled    Decimal   `json:"basefilled"`
+	Notional      Decimal   `json:"notional"`
+	Fee           Decimal   `json:"fee"`
+	FeeCurrency   string    `json:"feecurrency"`
+	Status        string    `json:"status"`
+	Reason        string    `json:"reason,omitempty"`
+}
+
+func (paperengine *PaperEngine) Load() (err error) {
+
+	paperengine.Mutex.Lock()
+
+	defer paperengine.Mutex.Unlock()
+
+	paperengine.Deltas = map[string]Decimal{}
+	paperengine.Orders = map[string]OrderStatus{}
+	paperengine.Fills = 0
+
+	if paperengine.Path == `` {
+
+		return
+	}
+
+	var content []byte
+
+	if content, err = os.ReadFile(paperengine.Path); err != nil {
+
+		if errors.Is(err, os.ErrNotExist) {
+
+			err = nil
+		}
+
+		return
+	}
+
+	var scanner *bufio.Scanner = bufio.NewScanner(bytes.NewReader(content))
+
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var line int = 0
+
+	for scanner.Scan() {
+
+		line += 1
+
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+
+			continue
+		}
+
+		var paperfill PaperFill
+
+		if err = json.Unmarshal(scanner.Bytes(), &paperfill); err != nil {
+
+			err = errors.New(strings.Join([]string{paperengine.Path, strconv.Itoa(line), err.Error()}, `: `))
+
+			return
+		}
+
+		paperengine.Apply(paperfill)
+	}
+
+	err = scanner.Err()
+
+	return
+}
+
+func (paperengine *PaperEngine) Apply(paperfill PaperFill) {
+
+	var basekey string = PaperKey(paperfill.Account, paperfill.Venue, paperfill.BaseCurrency)
+	var quotekey string = PaperKey(paperfill.Account, paperfill.Venue, paperfill.QuoteCurrency)
+
+	switch paperfill.Side {
+
+	case Buy:
+
+		paperengine.Deltas[basekey] = paperengine.Deltas[basekey].Add(paperfill.BaseFilled)
+		paperengine.Deltas[quotekey] = paperengine.Deltas[quotekey].Sub(paperfill.Notional)
+
+	case Sell:
+
+		paperengine.Deltas[basekey] = paperengine.Deltas[basekey].Sub(paperfill.BaseFilled)
+		paperengine.Deltas[quotekey] = paperengine.Deltas[quotekey].Add(paperfill.Notional)
+	}
+
+	var feekey string = PaperKey(paperfill.Account, paperfill.Venue, paperfill.FeeCurrency)
+
+	paperengine.Deltas[feekey] = paperengine.Deltas[feekey].Sub(paperfill.Fee)
+
+	var pair Pair
+
+	pair, _ = LookupPair(paperfill.Symbol)
+
+	paperengine.Orders[paperfill.OrderId] = OrderStatus{
+		Id:            paperfill.OrderId,
+		ClientOrderId: paperfill.ClientOrderId,
+		Status:        paperfill.Status,
+		BaseAmount:    paperfill.BaseAmount,
+		BaseFilled:    paperfill.BaseFilled,
+		BaseRemaining: paperfill.BaseAmount.Sub(paperfill.BaseFilled),
+		AveragePrice:  pair.AveragePrice(paperfill.Notional, paperfill.BaseFilled),
+		Notional:      paperfill.Notional,
+		Fee:           paperfill.Fee,
+		FeeCurrency:   paperfill.FeeCurrency,
+		Reason:        paperfill.Reason,
+	}
+
+	paperengine.Fills += 1
+}
+
+func (paperengine *PaperEngine) Record(paperfill PaperFill) (orderid string, err error) {
+
+	paperengine.Mutex.Lock()
+
+	defer paperengine.Mutex.Unlock()
+
+	if paperfill.OrderId == `` {
+
+		paperfill.OrderId = strings.Join([]string{`paper`, strconv.FormatInt(paperfill.Time.UnixNano(), 10), strconv.Itoa(paperengine.Fills + 1)}, `-`)
+	}
+
+	orderid = paperfill.OrderId
+
+	if paperengine.Path != `` {
+
+		var line []byte
+
+		if line, err = json.Marshal(paperfill); err != nil {
+
+			return
+		}
+
+		var file *os.File
+
+		if file, err = os.OpenFile(paperengine.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+
+			return
+		}
+
+		defer file.Close()
+
+		if _, err = file.Write(append(line, '\n')); err != nil {
+
+			return
+		}
+	}
+
+	paperengine.Apply(paperfill)
+
+	return
+}
+
+func (paperengine *PaperEngine) Balance(account string, venue string, initial map[string]Decimal, currency string) Decimal {
+
+	paperengine.Mutex.Lock()
+
+	defer paperengine.Mutex.Unlock()
+
+	return initial[strings.ToLower(currency)].Add(paperengine.Deltas[PaperKey(account, venue, currency)])
+}
+
+func (paperengine *PaperEngine) Pnl(account string) (pnl map[string]Decimal) {
+
+	paperengine.Mutex.Lock()
+
+	defer paperengine.Mutex.Unlock()
+
+	pnl = map[string]Decimal{}
+
+	var prefix string = strings.Join([]string{account, ``}, `/`)
+
+	var key string
+	var delta Decimal
+
+	for key, delta = range paperengine.Deltas {
+
+		if !strings.HasPrefix(key, prefix) {
+
+			continue
+		}
+
+		var currency string = key[strings.LastIndex(key, `/`)+1:]
+
+		pnl[currency] = pnl[currency].Add(delta)
+	}
+
+	return
+}
+
+func (paperengine *PaperEngine) Now() time.Time {
+
+	if paperengine.Clock != nil {
+
+		return paperengine.Clock()
+	}
+
+	return time.Now()
+}
+
+func PaperKey(account string, venue string, currency string) string {
+
+	return strings.Join([]string{account, venue, strings.ToLower(currency)}, `/`)
+}
+
+func (paperengine *PaperEngine) Wrap(account string, venue string, balances map[string]Decimal, fee float64, exchange Exchange) *PaperExchange {
+
+	return &PaperExchange{
+		Exchange:    exchange,
+		Account:     account,
+		Venue:       venue,
+		Balances:    balances,
+		Fee:         fee,
+		PaperEngine: paperengine,
+	}
+}
+
+func (paperexchange *PaperExchange) GetBalance(ctx context.Context, currency string) (balance Decimal, err error) {
+
+	balance = paperexchange.PaperEngine.Balance(paperexchange.Account, paperexchange.Venue, paperexchange.Balances, currency)
+
+	return
+}
+
+func (paperexchange *PaperExchange) PostLimitOrder(ctx context.Context, order Order) (orderid string, err error) {
+
+	var pair Pair = paperexchange.Pair()
+
+	var depthtype int = Ask
+
+	if order.Side == Sell {
+
+		depthtype = Bid
+	}
+
+	var depth Depth
+
+	if depth, err = paperexchange.GetDepth(ctx, depthtype); err != nil {
+
+		return
+	}
+
+	var paperfill PaperFill = PaperFill{
+		Time:          paperexchange.PaperEngine.Now().UTC(),
+		Account:       paperexchange.Account,
+		Venue:         paperexchange.Venue,
+		Symbol:        pair.Symbol,
+		Side:          order.Side,
+		ClientOrderId: order.ClientOrderId,
+		BaseCurrency:  pair.BaseCurrency,
+		QuoteCurrency: pair.QuoteCurrency,
+		BaseAmount:    order.BaseAmount.Round(pair.BasePrecision),
+		Price:         order.Price.Round(pair.PricePrecision),
+		FeeCurrency:   pair.FeeCurrency(order.Side),
+	}
+
+	var available Decimal = paperexchange.PaperEngine.Balance(paperexchange.Account, paperexchange.Venue, paperexchange.Balances, pair.BaseCurrency)
+
+	if order.Side == Buy {
+
+		available = paperexchange.PaperEngine.Balance(paperexchange.Account, paperexchange.Venue, paperexchange.Balances, pair.QuoteCurrency)
+	}
+
+	var required Decimal = paperfill.BaseAmount
+
+	if order.Side == Buy {
+
+		required = paperfill.BaseAmount.Mul(paperfill.Price).Round(pair.QuotePrecision)
+
+		if pair.FeeInQuote {
+
+			required = required.Add(required.Mul(DecimalFromFloat(paperexchange.Fee)).Round(pair.QuotePrecision))
+		}
+	}
+
+	if required.GreaterThan(available) {
+
+		paperfill.Status = OrderFailed
+		paperfill.Reason = `insufficient paper balance`
+
+	} else {
+
+		paperfill.BaseFilled, paperfill.Notional = SimulateFill(depth, order.Side, paperfill.BaseAmount, paperfill.Price)
+
+		paperfill.BaseFilled = paperfill.BaseFilled.Round(pair.BasePrecision)
+		paperfill.Notional = paperfill.Notional.Round(pair.QuotePrecision)
+
+		paperfill.Fee = paperfill.Notional.Mul(DecimalFromFloat(paperexchange.Fee)).Round(pair.QuotePrecision)
+
+		if paperfill.FeeCurrency == pair.BaseCurrency {
+
+			paperfill.Fee = paperfill.BaseFilled.Mul(DecimalFromFloat(paperexchange.Fee)).Round(pair.BasePrecision)
+		}
+
+		paperfill.Status = FillStatus(false, paperfill.BaseAmount, paperfill.BaseFilled)
+	}
+
+	orderid, err = paperexchange.PaperEngine.Record(paperfill)
+
+	return
+}
+
+func SimulateFill(depth Depth, side string, baseamount Decimal, price Decimal) (basefilled Decimal, notional Decimal) {
+
+	basefilled = DecimalZero
+	notional = DecimalZero
+
+	var levelindex int = 0
+	var levellength int = len(depth.Levels)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		var level Level = depth.Levels[levelindex]
+
+		if side == Buy && level.QuoteAmount.GreaterThan(price) || side == Sell && level.QuoteAmount.LessThan(price) {
+
+			break
+		}
+
+		var remaining Decimal = baseamount.Sub(basefilled)
+
+		if remaining.Sign() <= 0 {
+
+			break
+		}
+
+		var take Decimal = MinDecimal(remaining, level.BaseAmount)
+
+		basefilled = basefilled.Add(take)
+		notional = notional.Add(take.Mul(level.QuoteAmount))
+	}
+
+	return
+}
+
+func (paperexchange *PaperExchange) CancelOrder(ctx context.Context, orderid string) (err error) {
+
+	if _, err = paperexchange.GetOrderStatus(ctx, orderid); err != nil {
+
+		return
+	}
+
+	return
+}
+
+func (paperexchange *PaperExchange) GetOrderStatus(ctx context.Context, orderid string) (orderstatus OrderStatus, err error) {
+
+	paperexchange.PaperEngine.Mutex.Lock()
+
+	defer paperexchange.PaperEngine.Mutex.Unlock()
+
+	var found bool
+
+	if orderstatus, found = paperexchange.PaperEngine.Orders[orderid]; !found {
+
+		err = errors.New(strings.Join([]string{`paper: unknown order`, orderid}, ` `))
+	}
+
+	return
+}
+
+func (paperexchange *PaperExchange) GetOrderStatusByClientOrderId(ctx context.Context, clientorderid string) (orderstatus OrderStatus, err error) {
+
+	paperexchange.PaperEngine.Mutex.Lock()
+
+	defer paperexchange.PaperEngine.Mutex.Unlock()
+
+	for _, orderstatus = range paperexchange.PaperEngine.Orders {
+
+		if clientorderid != `` && orderstatus.ClientOrderId == clientorderid {
+
+			return
+		}
+	}
+
+	orderstatus = OrderStatus{}
+
+	err = ErrOrderNotFound
+
+	return
+}
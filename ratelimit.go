@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ApiRetries int = 3
+
+const (
+	ApiBackoffBase time.Duration = 250 * time.Millisecond
+	ApiBackoffMax  time.Duration = 10 * time.Second
+)
+
+type RateLimit struct {
+	Rate  float64
+	Burst float64
+}
+
+var VenueRateLimits map[string]RateLimit = map[string]RateLimit{
+	`bitstamp`: {Rate: 10000.0 / 600.0, Burst: 400},
+	`valr`:     {Rate: 2000.0 / 60.0, Burst: 100},
+}
+
+type TokenBucket struct {
+	Mutex   sync.Mutex
+	Rate    float64
+	Burst   float64
+	Tokens  float64
+	Updated time.Time
+	Blocked time.Time
+}
+
+type ApiLimiterRegistry struct {
+	Mutex   sync.Mutex
+	Buckets map[string]*TokenBucket
+}
+
+type ApiAttempt struct {
+	Status     int
+	Transport  bool
+	RetryAfter time.Duration
+}
+
+var ApiLimiters *ApiLimiterRegistry = &ApiLimiterRegistry{Buckets: map[string]*TokenBucket{}}
+
+func (apilimiterregistry *ApiLimiterRegistry) Get(venue string, host string) (tokenbucket *TokenBucket) {
+
+	apilimiterregistry.Mutex.Lock()
+
+	defer apilimiterregistry.Mutex.Unlock()
+
+	var key string = strings.Join([]string{venue, strings.ToLower(host)}, `/`)
+
+	var found bool
+
+	if tokenbucket, found = apilimiterregistry.Buckets[key]; !found {
+
+		var ratelimit RateLimit = VenueRateLimits[venue]
+
+		tokenbucket = &TokenBucket{Rate: ratelimit.Rate, Burst: ratelimit.Burst, Tokens: ratelimit.Burst}
+
+		apilimiterregistry.Buckets[key] = tokenbucket
+	}
+
+	return
+}
+
+func (tokenbucket *TokenBucket) Wait(ctx context.Context) (err error) {
+
+	var delay time.Duration
+
+	for delay = tokenbucket.Reserve(); delay > 0; delay = tokenbucket.Reserve() {
+
+		if err = Sleep(ctx, delay); err != nil {
+
+			return
+		}
+	}
+
+	return
+}
+
+func Sleep(ctx context.Context, delay time.Duration) (err error) {
+
+	if ctx == nil {
+
+		time.Sleep(delay)
+
+		return
+	}
+
+	var timer *time.Timer = time.NewTimer(delay)
+
+	defer timer.Stop()
+
+	select {
+
+	case <-timer.C:
+
+	case <-ctx.Done():
+
+		err = ctx.Err()
+	}
+
+	return
+}
+
+func (tokenbucket *TokenBucket) Reserve() (delay time.Duration) {
+
+	tokenbucket.Mutex.Lock()
+
+	defer tokenbucket.Mutex.Unlock()
+
+	if tokenbucket.Rate <= 0 {
+
+		return
+	}
+
+	var now time.Time = time.Now()
+
+	if now.Before(tokenbucket.Blocked) {
+
+		delay = tokenbucket.Blocked.Sub(now)
+
+		return
+	}
+
+	if !tokenbucket.Updated.IsZero() {
+
+		tokenbucket.Tokens += now.Sub(tokenbucket.Updated).Seconds() * tokenbucket.Rate
+	}
+
+	if tokenbucket.Tokens > tokenbucket.Burst {
+
+		tokenbucket.Tokens = tokenbucket.Burst
+	}
+
+	tokenbucket.Updated = now
+
+	if tokenbucket.Tokens >= 1 {
+
+		tokenbucket.Tokens -= 1
+
+		return
+	}
+
+	delay = time.Duration((1 - tokenbucket.Tokens) / tokenbucket.Rate * float64(time.Second))
+
+	return
+}
+
+func (tokenbucket *TokenBucket) Block(duration time.Duration) {
+
+	tokenbucket.Mutex.Lock()
+
+	defer tokenbucket.Mutex.Unlock()
+
+	var until time.Time = time.Now().Add(duration)
+
+	if until.After(tokenbucket.Blocked) {
+
+		tokenbucket.Blocked = until
+	}
+
+	tokenbucket.Tokens = 0
+}
+
+func ApiBackoff(attempt int) time.Duration {
+
+	var backoff time.Duration = ApiBackoffBase << uint(attempt)
+
+	if backoff <= 0 || backoff > ApiBackoffMax {
+
+		backoff = ApiBackoffMax
+	}
+
+	return backoff/2 + time.Duration(mathrand.Int63n(int64(backoff/2)+1))
+}
+
+func ParseRetryAfter(header string, now time.Time) (retryafter time.Duration) {
+
+	header = strings.TrimSpace(header)
+
+	if header == `` {
+
+		return
+	}
+
+	var seconds int
+	var err error
+
+	if seconds, err = strconv.Atoi(header); err == nil {
+
+		retryafter = time.Duration(seconds) * time.Second
+
+		return
+	}
+
+	var moment time.Time
+
+	if moment, err = http.ParseTime(header); err == nil && moment.After(now) {
+
+		retryafter = moment.Sub(now)
+	}
+
+	return
+}
+
+func RetryApi(ctx context.Context, venue string, method string, path string, order bool, attempt int, apiattempt ApiAttempt, tokenbucket *TokenBucket) bool {
+
+	var ratelimited bool = apiattempt.Status == 429
+
+	var transient bool = apiattempt.Transport || apiattempt.Status >= 500
+
+	if !ratelimited && (order || !transient) || attempt >= ApiRetries || ctx != nil && ctx.Err() != nil {
+
+		return false
+	}
+
+	var delay time.Duration = ApiBackoff(attempt)
+
+	if apiattempt.RetryAfter > delay {
+
+		delay = apiattempt.RetryAfter
+	}
+
+	if ratelimited {
+
+		tokenbucket.Block(delay)
+	}
+
+	MetricApiRetries.Add(1, venue, method, MetricEndpoint(path))
+
+	log.Printf(`retry: %[1]v %[2]v %[3]v in %[4]v, attempt %[5]v status %[6]v`, venue, method, path, delay, attempt+1, apiattempt.Status)
+
+	return Sleep(ctx, delay) == nil
+}
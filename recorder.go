@@ -0,0 +1,271 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RecordDepth    = `depth`
+	RecordSnapshot = `snapshot`
+	RecordDiff     = `diff`
+	RecordRate     = `rate`
+)
+
+type Recorder struct {
+	Dir     string
+	MaxSize int64
+	MaxAge  time.Duration
+	Mutex   sync.Mutex
+	File    *os.File
+	Size    int64
+	Opened  time.Time
+}
+
+type BookRecord struct {
+	Time     time.Time     `json:"t"`
+	Kind     string        `json:"k"`
+	Venue    string        `json:"v,omitempty"`
+	Symbol   string        `json:"s,omitempty"`
+	Sequence int64         `json:"n,omitempty"`
+	Bids     []RecordLevel `json:"b,omitempty"`
+	Asks     []RecordLevel `json:"a,omitempty"`
+	From     string        `json:"f,omitempty"`
+	To       string        `json:"o,omitempty"`
+	Rate     *Decimal      `json:"r,omitempty"`
+}
+
+type RecordLevel [2]Decimal
+
+func RecordLevels(levels []Level) (recordlevels []RecordLevel) {
+
+	recordlevels = make([]RecordLevel, 0, len(levels))
+
+	var levelindex int = 0
+	var levellength int = len(levels)
+
+	for levelindex = 0; levelindex < levellength; levelindex++ {
+
+		recordlevels = append(recordlevels, RecordLevel{levels[levelindex].QuoteAmount, levels[levelindex].BaseAmount})
+	}
+
+	return
+}
+
+func (recordlevel RecordLevel) Level() Level {
+
+	return Level{QuoteAmount: recordlevel[0], BaseAmount: recordlevel[1]}
+}
+
+func (recorder *Recorder) Record(bookrecord BookRecord) {
+
+	if recorder == nil || recorder.Dir == `` {
+
+		return
+	}
+
+	if bookrecord.Time.IsZero() {
+
+		bookrecord.Time = time.Now().UTC()
+	}
+
+	var line []byte
+	var err error
+
+	if line, err = json.Marshal(bookrecord); err != nil {
+
+		log.Printf(`Error('recorder: %+[1]v')`, err)
+
+		return
+	}
+
+	line = append(line, '\n')
+
+	recorder.Mutex.Lock()
+
+	defer recorder.Mutex.Unlock()
+
+	if err = recorder.Rotate(int64(len(line))); err != nil {
+
+		log.Printf(`Error('recorder: %+[1]v')`, err)
+
+		return
+	}
+
+	var written int
+
+	written, err = recorder.File.Write(line)
+
+	recorder.Size += int64(written)
+
+	if err != nil {
+
+		log.Printf(`Error('recorder: %+[1]v')`, err)
+	}
+}
+
+func (recorder *Recorder) RecordDepth(venue string, symbol string, depth Depth) {
+
+	var bookrecord BookRecord = BookRecord{Kind: RecordDepth, Venue: venue, Symbol: symbol}
+
+	if depth.Type == Ask {
+
+		bookrecord.Asks = RecordLevels(depth.Levels)
+
+	} else {
+
+		bookrecord.Bids = RecordLevels(depth.Levels)
+	}
+
+	recorder.Record(bookrecord)
+}
+
+func (recorder *Recorder) RecordRate(from string, to string, rate Decimal) {
+
+	recorder.Record(BookRecord{Kind: RecordRate, From: strings.ToLower(from), To: strings.ToLower(to), Rate: &rate})
+}
+
+type RecordingExchange struct {
+	Exchange
+	Recorder *Recorder
+}
+
+func (recordingexchange *RecordingExchange) GetDepth(ctx context.Context, depthtype int) (depth Depth, err error) {
+
+	if depth, err = recordingexchange.Exchange.GetDepth(ctx, depthtype); err != nil {
+
+		return
+	}
+
+	recordingexchange.Recorder.RecordDepth(recordingexchange.Name(), recordingexchange.Pair().Symbol, depth)
+
+	return
+}
+
+func (recorder *Recorder) Rotate(next int64) (err error) {
+
+	var now time.Time = time.Now().UTC()
+
+	if recorder.File != nil {
+
+		var expired bool = recorder.MaxAge > 0 && now.Sub(recorder.Opened) >= recorder.MaxAge
+		var full bool = recorder.MaxSize > 0 && recorder.Size+next > recorder.MaxSize
+
+		if !expired && !full {
+
+			return
+		}
+
+		var closed string = recorder.File.Name()
+
+		recorder.File.Close()
+		recorder.File = nil
+
+		go CompressRecording(closed)
+	}
+
+	if err = os.MkdirAll(recorder.Dir, 0o755); err != nil {
+
+		return
+	}
+
+	var filename string = filepath.Join(recorder.Dir, strings.Join([]string{`books-`, now.Format(`20060102T150405.000000000Z`), `.jsonl`}, ``))
+
+	if recorder.File, err = os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+
+		return
+	}
+
+	recorder.Size = 0
+	recorder.Opened = now
+
+	log.Printf(`recording: %+[1]v`, filename)
+
+	return
+}
+
+func (recorder *Recorder) Close() (err error) {
+
+	if recorder == nil {
+
+		return
+	}
+
+	recorder.Mutex.Lock()
+
+	defer recorder.Mutex.Unlock()
+
+	if recorder.File == nil {
+
+		return
+	}
+
+	err = recorder.File.Close()
+
+	recorder.File = nil
+
+	return
+}
+
+func CompressRecording(filename string) {
+
+	var err error
+
+	var source *os.File
+
+	if source, err = os.Open(filename); err != nil {
+
+		log.Printf(`Error('recorder: %+[1]v')`, err)
+
+		return
+	}
+
+	defer source.Close()
+
+	var compressedname string = strings.Join([]string{filename, `.gz`}, ``)
+
+	var temporary *os.File
+
+	if temporary, err = os.CreateTemp(filepath.Dir(filename), strings.Join([]string{`.`, filepath.Base(compressedname), `.*`}, ``)); err != nil {
+
+		log.Printf(`Error('recorder: %+[1]v')`, err)
+
+		return
+	}
+
+	var writer *gzip.Writer = gzip.NewWriter(temporary)
+
+	if _, err = io.Copy(writer, source); err == nil {
+
+		err = writer.Close()
+	}
+
+	if closeerr := temporary.Close(); err == nil {
+
+		err = closeerr
+	}
+
+	if err == nil {
+
+		err = os.Rename(temporary.Name(), compressedname)
+	}
+
+	if err != nil {
+
+		os.Remove(temporary.Name())
+
+		log.Printf(`Error('recorder: %+[1]v')`, err)
+
+		return
+	}
+
+	os.Remove(filename)
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Report struct {
+	From     *time.Time   `json:"from,omitempty"`
+	To       *time.Time   `json:"to,omitempty"`
+	Accounts []*ReportRow `json:"accounts"`
+	Total    *ReportRow   `json:"total"`
+}
+
+type ReportRow struct {
+	Account           string             `json:"account"`
+	Cycles            int                `json:"cycles"`
+	Opportunities     int                `json:"opportunities"`
+	Executed          int                `json:"executed"`
+	Unhedged          int                `json:"unhedged"`
+	Estimated         int                `json:"estimated"`
+	Realised          map[string]Decimal `json:"realised"`
+	EstimatedRealised map[string]Decimal `json:"estimatedrealised"`
+	Volume            map[string]Decimal `json:"volume"`
+	Fees              map[string]Decimal `json:"fees"`
+	BaseAmount        Decimal            `json:"baseamount"`
+	BaseFilled        Decimal            `json:"basefilled"`
+	FillRatio         float64            `json:"fillratio"`
+	AverageEdge       float64            `json:"averageedge"`
+	AverageMargin     float64            `json:"averagemargin"`
+	AverageOverMargin float64            `json:"averageovermargin"`
+	EdgeSum           float64            `json:"-"`
+	MarginSum         float64            `json:"-"`
+}
+
+func RunReport(arguments []string) (err error) {
+
+	var flagset *flag.FlagSet = flag.NewFlagSet(`report`, flag.ContinueOnError)
+
+	var ledger Ledger = Ledger{}
+
+	var account string
+	var fromtext string
+	var totext string
+	var format string
+	var out string
+	var paper bool
+
+	flagset.StringVar(&ledger.Dir, `ledger`, `ledger`, `ledger directory written by the bot`)
+	flagset.StringVar(&account, `account`, ``, `only report this account`)
+	flagset.StringVar(&fromtext, `from`, ``, `first day (YYYY-MM-DD) or instant (RFC 3339) to include`)
+	flagset.StringVar(&totext, `to`, ``, `last day (YYYY-MM-DD) or instant (RFC 3339) to include`)
+	flagset.StringVar(&format, `format`, `json`, `output format, json or csv`)
+	flagset.StringVar(&out, `out`, ``, `output file, empty for stdout`)
+	flagset.BoolVar(&paper, `paper`, false, `report paper trading cycles instead of live ones`)
+
+	flagset.Usage = func() {
+
+		fmt.Fprintln(flagset.Output(), `usage: algo report [-ledger dir] [-account name] [-from date] [-to date] [-format json|csv] [-out file] [-paper]`)
+
+		flagset.PrintDefaults()
+	}
+
+	if err = flagset.Parse(arguments); err != nil {
+
+		if !errors.Is(err, flag.ErrHelp) {
+
+			err = fmt.Errorf(`%[1]w: %[2]w`, ErrUsage, err)
+		}
+
+		return
+	}
+
+	if flagset.NArg() != 0 || format != `json` && format != `csv` {
+
+		flagset.Usage()
+
+		err = fmt.Errorf(`%[1]w: report takes no arguments and -format json or csv`, ErrUsage)
+
+		return
+	}
+
+	var from time.Time
+	var to time.Time
+
+	if from, err = ParseReportTime(fromtext, false); err != nil {
+
+		return
+	}
+
+	if to, err = ParseReportTime(totext, true); err != nil {
+
+		return
+	}
+
+	var ledgerentries []LedgerEntry
+
+	if ledgerentries, err = ledger.Query(account, from, to); err != nil {
+
+		return
+	}
+
+	var report Report = NewReport(ledgerentries, paper)
+
+	if !from.IsZero() {
+
+		report.From = &from
+	}
+
+	if !to.IsZero() {
+
+		report.To = &to
+	}
+
+	var writer io.Writer = os.Stdout
+
+	if out != `` {
+
+		var file *os.File
+
+		if file, err = os.Create(out); err != nil {
+
+			return
+		}
+
+		defer file.Close()
+
+		writer = file
+	}
+
+	if format == `csv` {
+
+		err = report.WriteCsv(writer)
+
+		return
+	}
+
+	var encoder *json.Encoder = json.NewEncoder(writer)
+
+	encoder.SetIndent(``, "\t")
+
+	err = encoder.Encode(report)
+
+	return
+}
+
+func ParseReportTime(text string, end bool) (moment time.Time, err error) {
+
+	if text == `` {
+
+		return
+	}
+
+	if moment, err = time.Parse(LedgerDateLayout, text); err == nil {
+
+		if end {
+
+			moment = moment.AddDate(0, 0, 1)
+		}
+
+		return
+	}
+
+	if moment, err = time.Parse(time.RFC3339, text); err != nil {
+
+		err = errors.New(strings.Join([]string{`report: invalid date`, text}, ` `))
+	}
+
+	return
+}
+
+func NewReportRow(account string) *ReportRow {
+
+	return &ReportRow{
+		Account:           account,
+		Realised:          map[string]Decimal{},
+		EstimatedRealised: map[string]Decimal{},
+		Volume:            map[string]Decimal{},
+		Fees:              map[string]Decimal{},
+	}
+}
+
+func NewReport(ledgerentries []LedgerEntry, paper bool) (report Report) {
+
+	report.Total = NewReportRow(`total`)
+
+	var rows map[string]*ReportRow = map[string]*ReportRow{}
+
+	var entryindex int = 0
+	var entrylength int = len(ledgerentries)
+
+	for entryindex = 0; entryindex < entrylength; entryindex++ {
+
+		var ledgerentry LedgerEntry = ledgerentries[entryindex]
+
+		if ledgerentry.Paper != paper {
+
+			continue
+		}
+
+		var reportrow *ReportRow
+		var found bool
+
+		if reportrow, found = rows[ledgerentry.Account]; !found {
+
+			reportrow = NewReportRow(ledgerentry.Account)
+
+			rows[ledgerentry.Account] = reportrow
+
+			report.Accounts = append(report.Accounts, reportrow)
+		}
+
+		reportrow.Add(ledgerentry)
+		report.Total.Add(ledgerentry)
+	}
+
+	sort.Slice(report.Accounts, func(first int, second int) bool {
+
+		return report.Accounts[first].Account < report.Accounts[second].Account
+	})
+
+	var rowindex int = 0
+	var rowlength int = len(report.Accounts)
+
+	for rowindex = 0; rowindex < rowlength; rowindex++ {
+
+		report.Accounts[rowindex].Finish()
+	}
+
+	report.Total.Finish()
+
+	return
+}
+
+func (reportrow *ReportRow) Add(ledgerentry LedgerEntry) {
+
+	reportrow.Cycles += 1
+
+	if ledgerentry.Opportunity {
+
+		reportrow.Opportunities += 1
+	}
+
+	if !ledgerentry.Executed {
+
+		return
+	}
+
+	reportrow.Executed += 1
+
+	if ledgerentry.HedgeState == HedgeAlerted {
+
+		reportrow.Unhedged += 1
+	}
+
+	reportrow.EdgeSum += ledgerentry.NetPercent
+	reportrow.MarginSum += ledgerentry.ProfitMargin
+
+	if ledgerentry.EstimatedRealised != nil {
+
+		reportrow.Estimated += 1
+
+		AddRealised(reportrow.EstimatedRealised, ledgerentry, *ledgerentry.EstimatedRealised)
+
+	} else {
+
+		AddRealised(reportrow.Realised, ledgerentry, ledgerentry.Realised)
+	}
+
+	var found bool
+
+	var orderindex int = 0
+	var orderlength int = len(ledgerentry.Orders)
+
+	for orderindex = 0; orderindex < orderlength; orderindex++ {
+
+		var ledgerorder LedgerOrder = ledgerentry.Orders[orderindex]
+
+		var pair Pair
+
+		if pair, found = LookupPair(ledgerorder.Symbol); found {
+
+			reportrow.Volume[pair.BaseCurrency] = reportrow.Volume[pair.BaseCurrency].Add(ledgerorder.BaseFilled)
+			reportrow.Volume[pair.QuoteCurrency] = reportrow.Volume[pair.QuoteCurrency].Add(ledgerorder.Notional)
+		}
+
+		reportrow.Fees[ledgerorder.FeeCurrency] = reportrow.Fees[ledgerorder.FeeCurrency].Add(ledgerorder.Fee)
+
+		if ledgerorder.Leg == `buy` || ledgerorder.Leg == `sell` {
+
+			reportrow.BaseAmount = reportrow.BaseAmount.Add(ledgerorder.BaseAmount)
+			reportrow.BaseFilled = reportrow.BaseFilled.Add(ledgerorder.BaseFilled)
+		}
+	}
+}
+
+func AddRealised(amounts map[string]Decimal, ledgerentry LedgerEntry, realised Decimal) {
+
+	amounts[ledgerentry.RealisedIn] = amounts[ledgerentry.RealisedIn].Add(realised)
+
+	var buypair Pair
+	var found bool
+
+	if buypair, found = LookupPair(ledgerentry.BuySymbol); found && buypair.QuoteCurrency != ledgerentry.RealisedIn && ledgerentry.ExchangeRate.Sign() > 0 {
+
+		amounts[buypair.QuoteCurrency] = amounts[buypair.QuoteCurrency].Add(realised.Div(ledgerentry.ExchangeRate, buypair.QuotePrecision))
+	}
+}
+
+func (reportrow *ReportRow) Finish() {
+
+	if reportrow.BaseAmount.Sign() > 0 {
+
+		reportrow.FillRatio = reportrow.BaseFilled.Float64() / reportrow.BaseAmount.Float64()
+	}
+
+	if reportrow.Executed > 0 {
+
+		reportrow.AverageEdge = reportrow.EdgeSum / float64(reportrow.Executed)
+		reportrow.AverageMargin = reportrow.MarginSum / float64(reportrow.Executed)
+		reportrow.AverageOverMargin = reportrow.AverageEdge - reportrow.AverageMargin
+	}
+}
+
+func LookupPair(symbol string) (pair Pair, found bool) {
+
+	var pairs map[string]Pair
+
+	for _, pairs = range ExchangePairs {
+
+		if pair, found = pairs[symbol]; found {
+
+			return
+		}
+	}
+
+	return
+}
+
+func (report *Report) WriteCsv(writer io.Writer) (err error) {
+
+	var rows []*ReportRow = append(append([]*ReportRow{}, report.Accounts...), report.Total)
+
+	var realised []string = ReportCurrencies(rows, func(reportrow *ReportRow) map[string]Decimal { return reportrow.Realised })
+	var estimated []string = ReportCurrencies(rows, func(reportrow *ReportRow) map[string]Decimal { return reportrow.EstimatedRealised })
+	var volume []string = ReportCurrencies(rows, func(reportrow *ReportRow) map[string]Decimal { return reportrow.Volume })
+	var fees []string = ReportCurrencies(rows, func(reportrow *ReportRow) map[string]Decimal { return reportrow.Fees })
+
+	var header []string = []string{`account`, `cycles`, `opportunities`, `executed`, `unhedged`, `estimated`}
+
+	header = append(header, ReportColumns(`realised`, realised)...)
+	header = append(header, ReportColumns(`estimatedrealised`, estimated)...)
+	header = append(header, ReportColumns(`volume`, volume)...)
+	header = append(header, ReportColumns(`fees`, fees)...)
+	header = append(header, `fillratio`, `averageedge`, `averagemargin`, `averageovermargin`)
+
+	var csvwriter *csv.Writer = csv.NewWriter(writer)
+
+	csvwriter.Write(header)
+
+	var rowindex int = 0
+	var rowlength int = len(rows)
+
+	for rowindex = 0; rowindex < rowlength; rowindex++ {
+
+		var reportrow *ReportRow = rows[rowindex]
+
+		var record []string = []string{
+			reportrow.Account,
+			strconv.Itoa(reportrow.Cycles),
+			strconv.Itoa(reportrow.Opportunities),
+			strconv.Itoa(reportrow.Executed),
+			strconv.Itoa(reportrow.Unhedged),
+			strconv.Itoa(reportrow.Estimated),
+		}
+
+		record = append(record, ReportValues(reportrow.Realised, realised)...)
+		record = append(record, ReportValues(reportrow.EstimatedRealised, estimated)...)
+		record = append(record, ReportValues(reportrow.Volume, volume)...)
+		record = append(record, ReportValues(reportrow.Fees, fees)...)
+
+		record = append(record,
+			strconv.FormatFloat(reportrow.FillRatio, 'f', 4, 64),
+			strconv.FormatFloat(reportrow.AverageEdge, 'f', 4, 64),
+			strconv.FormatFloat(reportrow.AverageMargin, 'f', 4, 64),
+			strconv.FormatFloat(reportrow.AverageOverMargin, 'f', 4, 64),
+		)
+
+		csvwriter.Write(record)
+	}
+
+	csvwriter.Flush()
+
+	err = csvwriter.Error()
+
+	return
+}
+
+func ReportCurrencies(rows []*ReportRow, amounts func(*ReportRow) map[string]Decimal) (currencies []string) {
+
+	var seen map[string]bool = map[string]bool{}
+
+	var rowindex int = 0
+	var rowlength int = len(rows)
+
+	for rowindex = 0; rowindex < rowlength; rowindex++ {
+
+		var currency string
+
+		for currency = range amounts(rows[rowindex]) {
+
+			if !seen[currency] {
+
+				seen[currency] = true
+
+				currencies = append(currencies, currency)
+			}
+		}
+	}
+
+	sort.Strings(currencies)
+
+	return
+}
+
+func ReportColumns(prefix string, currencies []string) (columns []string) {
+
+	var currencyindex int = 0
+	var currencylength int = len(currencies)
+
+	for currencyindex = 0; currencyindex < currencylength; currencyindex++ {
+
+		columns = append(columns, strings.Join([]string{prefix, currencies[currencyindex]}, `_`))
+	}
+
+	return
+}
+
+func ReportValues(amounts map[string]Decimal, currencies []string) (values []string) {
+
+	var currencyindex int = 0
+	var currencylength int = len(currencies)
+
+	for currencyindex = 0; currencyindex < currencylength; currencyindex++ {
+
+		values = append(values, amounts[currencies[currencyindex]].String())
+	}
+
+	return
+}
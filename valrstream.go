@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ValrStreamUrl string = `wss://api.valr.com/ws/trade`
+
+const ValrChecksumDepth int = 25
+
+type ValrStream struct {
+	Url            string
+	Key            string
+	Secret         string
+	CurrencyPair   Pair
+	StaleAfter     time.Duration
+	OrderBook      *OrderBook
+	Recorder       *Recorder
+	SequenceNumber int64
+}
+
+type ValrStreamMessage struct {
+	Type               string          `json:"type"`
+	CurrencyPairSymbol string          `json:"currencyPairSymbol"`
+	Data               json.RawMessage `json:"data"`
+}
+
+type ValrStreamSubscription struct {
+	Type          string            `json:"type"`
+	Subscriptions []ValrStreamEvent `json:"subscriptions"`
+}
+
+type ValrStreamEvent struct {
+	Event string   `json:"event"`
+	Pairs []string `json:"pairs"`
+}
+
+type ValrStreamBook struct {
+	LastChange     json.RawMessage   `json:"LastChange"`
+	Asks           []ValrStreamLevel `json:"Asks"`
+	Bids           []ValrStreamLevel `json:"Bids"`
+	SequenceNumber int64             `json:"SequenceNumber"`
+	Checksum       int64             `json:"Checksum"`
+}
+
+type ValrStreamLevel struct {
+	Price  Decimal `json:"Price"`
+	Orders []struct {
+		OrderId  string  `json:"orderId"`
+		Quantity Decimal `json:"quantity"`
+	} `json:"Orders"`
+}
+
+var ErrValrSequenceGap error = errors.New(`valr stream: sequence gap`)
+
+var ErrValrChecksum error = errors.New(`valr stream: checksum mismatch`)
+
+func (valrstream *ValrStream) Start() {
+
+	if valrstream.Url == `` {
+
+		valrstream.Url = ValrStreamUrl
+	}
+
+	if valrstream.StaleAfter == 0 {
+
+		valrstream.StaleAfter = 30 * time.Second
+	}
+
+	go RunStream(strings.Join([]string{`valr`, valrstream.CurrencyPair.Symbol}, ` `), valrstream.OrderBook, valrstream.Stream)
+}
+
+func (valrstream *ValrStream) GetDepth(depthtype int) (depth Depth, err error) {
+
+	depth, err = valrstream.OrderBook.Depth(depthtype, valrstream.CurrencyPair, valrstream.StaleAfter)
+
+	return
+}
+
+func (valrstream *ValrStream) Stream() (err error) {
+
+	var timestamp string = strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	var path string = `/ws/trade`
+
+	if index := strings.Index(valrstream.Url, `/ws/`); index >= 0 {
+
+		path = valrstream.Url[index:]
+	}
+
+	var header http.Header = http.Header{}
+
+	header.Set(`X-VALR-API-KEY`, valrstream.Key)
+	header.Set(`X-VALR-SIGNATURE`, ValrSignature(valrstream.Secret, timestamp, `GET`, path, nil))
+	header.Set(`X-VALR-TIMESTAMP`, timestamp)
+
+	var websocketconn *WebsocketConn
+
+	if websocketconn, err = DialWebsocket(valrstream.Url, header, 10*time.Second); err != nil {
+
+		return
+	}
+
+	defer websocketconn.Close()
+
+	var subscription ValrStreamSubscription = ValrStreamSubscription{
+		Type: `SUBSCRIBE`,
+		Subscriptions: []ValrStreamEvent{
+			{Event: `FULL_ORDERBOOK_UPDATE`, Pairs: []string{strings.ToUpper(valrstream.CurrencyPair.Symbol)}},
+		},
+	}
+
+	var request []byte
+
+	if request, err = json.Marshal(subscription); err != nil {
+
+		return
+	}
+
+	if err = websocketconn.WriteMessage(WebsocketText, request); err != nil {
+
+		return
+	}
+
+	var ping []byte = []byte(`{"type":"PING"}`)
+
+	var stop chan struct{} = make(chan struct{})
+
+	defer close(stop)
+
+	go func() {
+
+		var ticker *time.Ticker = time.NewTicker(valrstream.StaleAfter / 3)
+
+		defer ticker.Stop()
+
+		for {
+
+			select {
+
+			case <-stop:
+
+				return
+
+			case <-ticker.C:
+
+				websocketconn.WriteMessage(WebsocketText, ping)
+			}
+		}
+	}()
+
+	for {
+
+		websocketconn.SetReadDeadline(time.Now().Add(valrstream.StaleAfter))
+
+		var payload []byte
+
+		if _, payload, err = websocketconn.ReadMessage(); err != nil {
+
+			return
+		}
+
+		var message ValrStreamMessage
+
+		if err = json.Unmarshal(payload, &message); err != nil {
+
+			return
+		}
+
+		switch message.Type {
+
+		case `SUBSCRIBED`:
+
+			log.Printf(`valr stream: subscribed %[1]v`, valrstream.CurrencyPair.Symbol)
+
+		case `PONG`:
+
+			valrstream.OrderBook.Mutex.Lock()
+
+			if valrstream.OrderBook.Synced {
+
+				valrstream.OrderBook.Updated = time.Now()
+			}
+
+			valrstream.OrderBook.Mutex.Unlock()
+
+		case `UNSUBSCRIBED`:
+
+			err = errors.New(`valr stream: unsubscribed`)
+
+			return
+
+		case `FULL_ORDERBOOK_SNAPSHOT`, `FULL_ORDERBOOK_UPDATE`:
+
+			if !strings.EqualFold(message.CurrencyPairSymbol, valrstream.CurrencyPair.Symbol) {
+
+				continue
+			}
+
+			var valrstreambook ValrStreamBook
+
+			if err = json.Unmarshal(message.Data, &valrstreambook); err != nil {
+
+				return
+			}
+
+			if err = valrstream.Apply(valrstreambook, message.Type == `FULL_ORDERBOOK_SNAPSHOT`); err != nil {
+
+				return
+			}
+		}
+	}
+}
+
+func (valrstream *ValrStream) Apply(valrstreambook ValrStreamBook, snapshot bool) (err error) {
+
+	var orderbook *OrderBook = valrstream.OrderBook
+
+	orderbook.Mutex.Lock()
+
+	defer orderbook.Mutex.Unlock()
+
+	if snapshot {
+
+		orderbook.Bids = map[string]Level{}
+		orderbook.Asks = map[string]Level{}
+
+	} else if !orderbook.Synced {
+
+		return
+
+	} else if valrstreambook.SequenceNumber != valrstream.SequenceNumber+1 {
+
+		orderbook.Synced = false
+
+		err = ErrValrSequenceGap
+
+		return
+	}
+
+	var sides map[int][]ValrStreamLevel = map[int][]ValrStreamLevel{
+		Bid: valrstreambook.Bids,
+		Ask: valrstreambook.Asks,
+	}
+
+	var recorded map[int][]Level = map[int][]Level{}
+
+	var depthtype int
+	var levels []ValrStreamLevel
+
+	for depthtype, levels = range sides {
+
+		var levelindex int = 0
+		var levellength int = len(levels)
+
+		for levelindex = 0; levelindex < levellength; levelindex++ {
+
+			var amount Decimal = DecimalZero
+
+			var orderindex int = 0
+			var orderlength int = len(levels[levelindex].Orders)
+
+			for orderindex = 0; orderindex < orderlength; orderindex++ {
+
+				amount = amount.Add(levels[levelindex].Orders[orderindex].Quantity)
+			}
+
+			orderbook.Set(depthtype, levels[levelindex].Price, amount)
+
+			recorded[depthtype] = append(recorded[depthtype], Level{QuoteAmount: levels[levelindex].Price, BaseAmount: amount})
+		}
+	}
+
+	if checksum := ValrChecksum(orderbook); checksum != uint32(valrstreambook.Checksum) {
+
+		orderbook.Synced = false
+
+		err = errors.Join(ErrValrChecksum, errors.New(strings.Join([]string{`expected`, strconv.FormatInt(valrstreambook.Checksum, 10), `calculated`, strconv.FormatUint(uint64(checksum), 10)}, ` `)))
+
+		return
+	}
+
+	valrstream.SequenceNumber = valrstreambook.SequenceNumber
+
+	var kind string = RecordDiff
+
+	if snapshot {
+
+		kind = RecordSnapshot
+	}
+
+	valrstream.Recorder.Record(BookRecord{
+		Kind:     kind,
+		Venue:    `valr`,
+		Symbol:   valrstream.CurrencyPair.Symbol,
+		Sequence: valrstreambook.SequenceNumber,
+		Bids:     RecordLevels(recorded[Bid]),
+		Asks:     RecordLevels(recorded[Ask]),
+	})
+
+	orderbook.Synced = true
+	orderbook.Updated = time.Now()
+
+	return
+}
+
+func ValrChecksum(orderbook *OrderBook) uint32 {
+
+	var bids []Level = orderbook.Levels(Bid)
+	var asks []Level = orderbook.Levels(Ask)
+
+	var fields []string = []string{}
+
+	var levelindex int = 0
+
+	for levelindex = 0; levelindex < ValrChecksumDepth; levelindex++ {
+
+		if levelindex < len(bids) {
+
+			fields = append(fields, bids[levelindex].QuoteAmount.String(), bids[levelindex].BaseAmount.String())
+		}
+
+		if levelindex < len(asks) {
+
+			fields = append(fields, asks[levelindex].QuoteAmount.String(), asks[levelindex].BaseAmount.String())
+		}
+	}
+
+	return crc32.ChecksumIEEE([]byte(strings.Join(fields, `:`)))
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WebsocketContinuation = 0x0
+	WebsocketText         = 0x1
+	WebsocketBinary       = 0x2
+	WebsocketClose        = 0x8
+	WebsocketPing         = 0x9
+	WebsocketPong         = 0xa
+)
+
+const WebsocketGuid string = `258EAFA5-E914-47DA-95CA-C5AB0DC85B11`
+
+const WebsocketMaxMessage int = 16 << 20
+
+type WebsocketConn struct {
+	Conn       net.Conn
+	Reader     *bufio.Reader
+	WriteMutex sync.Mutex
+}
+
+func DialWebsocket(rawurl string, header http.Header, timeout time.Duration) (websocketconn *WebsocketConn, err error) {
+
+	var websocketurl *url.URL
+
+	if websocketurl, err = url.Parse(rawurl); err != nil {
+
+		return
+	}
+
+	var address string = websocketurl.Host
+
+	if websocketurl.Port() == `` {
+
+		address = net.JoinHostPort(websocketurl.Hostname(), map[string]string{`ws`: `80`, `wss`: `443`}[websocketurl.Scheme])
+	}
+
+	var dialer *net.Dialer = &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+
+	var conn net.Conn
+
+	switch websocketurl.Scheme {
+
+	case `ws`:
+
+		conn, err = dialer.Dial(`tcp`, address)
+
+	case `wss`:
+
+		conn, err = tls.DialWithDialer(dialer, `tcp`, address, &tls.Config{ServerName: websocketurl.Hostname()})
+
+	default:
+
+		err = errors.New(strings.Join([]string{`websocket: unsupported scheme`, websocketurl.Scheme}, ` `))
+	}
+
+	if err != nil {
+
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var nonce []byte = make([]byte, 16)
+
+	rand.Reader.Read(nonce)
+
+	var key string = base64.StdEncoding.EncodeToString(nonce)
+
+	var httprequest *http.Request = &http.Request{
+		Method:     http.MethodGet,
+		URL:        websocketurl,
+		Proto:      `HTTP/1.1`,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Host:       websocketurl.Host,
+	}
+
+	for name, values := range header {
+
+		httprequest.Header[name] = values
+	}
+
+	httprequest.Header.Set(`Upgrade`, `websocket`)
+	httprequest.Header.Set(`Connection`, `Upgrade`)
+	httprequest.Header.Set(`Sec-WebSocket-Key`, key)
+	httprequest.Header.Set(`Sec-WebSocket-Version`, `13`)
+
+	if err = httprequest.Write(conn); err != nil {
+
+		conn.Close()
+
+		return
+	}
+
+	var reader *bufio.Reader = bufio.NewReader(conn)
+
+	var httpresponse *http.Response
+
+	if httpresponse, err = http.ReadResponse(reader, httprequest); err != nil {
+
+		conn.Close()
+
+		return
+	}
+
+	httpresponse.Body.Close()
+
+	var digest hash.Hash = sha1.New()
+
+	digest.Write([]byte(key))
+	digest.Write([]byte(WebsocketGuid))
+
+	if httpresponse.StatusCode != http.StatusSwitchingProtocols || httpresponse.Header.Get(`Sec-WebSocket-Accept`) != base64.StdEncoding.EncodeToString(digest.Sum(nil)) {
+
+		conn.Close()
+
+		err = errors.New(strings.Join([]string{`websocket: handshake failed`, httpresponse.Status}, ` `))
+
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	websocketconn = &WebsocketConn{Conn: conn, Reader: reader}
+
+	return
+}
+
+func (websocketconn *WebsocketConn) ReadMessage() (opcode int, payload []byte, err error) {
+
+	opcode = -1
+
+	for {
+
+		var frameopcode int
+		var final bool
+		var framepayload []byte
+
+		if frameopcode, final, framepayload, err = websocketconn.ReadFrame(); err != nil {
+
+			return
+		}
+
+		switch frameopcode {
+
+		case WebsocketPing:
+
+			if err = websocketconn.WriteMessage(WebsocketPong, framepayload); err != nil {
+
+				return
+			}
+
+			continue
+
+		case WebsocketPong:
+
+			continue
+
+		case WebsocketClose:
+
+			websocketconn.WriteMessage(WebsocketClose, framepayload)
+
+			err = io.EOF
+
+			return
+
+		case WebsocketContinuation:
+
+			if opcode < 0 {
+
+				err = errors.New(`websocket: unexpected continuation frame`)
+
+				return
+			}
+
+		default:
+
+			opcode = frameopcode
+		}
+
+		payload = append(payload, framepayload...)
+
+		if len(payload) > WebsocketMaxMessage {
+
+			err = errors.New(`websocket: message too large`)
+
+			return
+		}
+
+		if final {
+
+			return
+		}
+	}
+}
+
+func (websocketconn *WebsocketConn) ReadFrame() (opcode int, final bool, payload []byte, err error) {
+
+	var header []byte = make([]byte, 2)
+
+	if _, err = io.ReadFull(websocketconn.Reader, header); err != nil {
+
+		return
+	}
+
+	final = header[0]&0x80 != 0
+	opcode = int(header[0] & 0x0f)
+
+	var masked bool = header[1]&0x80 != 0
+	var length uint64 = uint64(header[1] & 0x7f)
+
+	switch length {
+
+	case 126:
+
+		var extended []byte = make([]byte, 2)
+
+		if _, err = io.ReadFull(websocketconn.Reader, extended); err != nil {
+
+			return
+		}
+
+		length = uint64(binary.BigEndian.Uint16(extended))
+
+	case 127:
+
+		var extended []byte = make([]byte, 8)
+
+		if _, err = io.ReadFull(websocketconn.Reader, extended); err != nil {
+
+			return
+		}
+
+		length = binary.BigEndian.Uint64(extended)
+	}
+
+	if length > uint64(WebsocketMaxMessage) {
+
+		err = errors.New(`websocket: frame too large`)
+
+		return
+	}
+
+	var mask []byte = make([]byte, 4)
+
+	if masked {
+
+		if _, err = io.ReadFull(websocketconn.Reader, mask); err != nil {
+
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+
+	if _, err = io.ReadFull(websocketconn.Reader, payload); err != nil {
+
+		return
+	}
+
+	if masked {
+
+		for index := range payload {
+
+			payload[index] ^= mask[index%4]
+		}
+	}
+
+	return
+}
+
+func (websocketconn *WebsocketConn) WriteMessage(opcode int, payload []byte) (err error) {
+
+	var frame []byte = []byte{0x80 | byte(opcode)}
+
+	var length int = len(payload)
+
+	switch {
+
+	case length < 126:
+
+		frame = append(frame, 0x80|byte(length))
+
+	case length <= 0xffff:
+
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+
+	default:
+
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	var mask []byte = make([]byte, 4)
+
+	rand.Reader.Read(mask)
+
+	frame = append(frame, mask...)
+
+	for index := range payload {
+
+		frame = append(frame, payload[index]^mask[index%4])
+	}
+
+	websocketconn.WriteMutex.Lock()
+
+	defer websocketconn.WriteMutex.Unlock()
+
+	_, err = websocketconn.Conn.Write(frame)
+
+	return
+}
+
+func (websocketconn *WebsocketConn) SetReadDeadline(deadline time.Time) error {
+
+	return websocketconn.Conn.SetReadDeadline(deadline)
+}
+
+func (websocketconn *WebsocketConn) Close() error {
+
+	websocketconn.WriteMessage(WebsocketClose, []byte{0x03, 0xe8})
+
+	return websocketconn.Conn.Close()
+}